@@ -14,9 +14,11 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/ranjankuldeep/fakeNumber/internal/database"
-	"github.com/ranjankuldeep/fakeNumber/internal/lib"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
 	"github.com/ranjankuldeep/fakeNumber/internal/routes"
 	"github.com/ranjankuldeep/fakeNumber/internal/runner"
+	"github.com/ranjankuldeep/fakeNumber/internal/services"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -32,6 +34,23 @@ func main() {
 		log.Fatalf("Error loading .env file: %v", err)
 	}
 	e := echo.New()
+	if simulatorURL := os.Getenv("PROVIDER_SIMULATOR_URL"); simulatorURL != "" {
+		log.Printf("Sending provider calls to simulator at %s", simulatorURL)
+		provider.Redirect(simulatorURL)
+	}
+	provider.OnBreakerChange(func(health provider.Health) {
+		err := services.ServerHealthTeleBot(services.ServerHealthDetails{
+			Server:              health.Server,
+			State:               health.State,
+			ErrorRate:           health.ErrorRate,
+			LatencyMs:           health.LatencyMs,
+			ConsecutiveFailures: health.ConsecutiveFailures,
+			LastError:           health.LastError,
+		})
+		if err != nil {
+			log.Printf("Error sending server health alert: %v", err)
+		}
+	})
 	databaseName := os.Getenv("MONGODB_DATABASE")
 	uri := os.Getenv("MONGODB_URI")
 
@@ -47,22 +66,22 @@ func main() {
 		log.Fatal("Error initializing MongoDB connection:", err)
 	}
 	db := client.Database(databaseName)
+	models.EnsureOrderIndexes(db)
+	models.EnsureOrderEventIndexes(db)
+	models.EnsureWebhookIndexes(db)
+	models.EnsureExchangeRateIndexes(db)
+	models.EnsureReconciliationIndexes(db)
+	models.EnsureRentalIndexes(db)
+	models.EnsureUpstreamAuditIndexes(db)
+	models.EnsureServerBalanceIndexes(db)
+	runner.StartUpstreamAudit(db)
 	stats, err := fetchDatabaseStats(db)
 	if err != nil {
 		log.Printf("Error fetching database stats: %v", err)
 	} else {
 		log.Printf("Database stats: %v", stats)
 	}
-	go func() {
-		for {
-			err := lib.UpdateServerToken(db)
-			if err != nil {
-				log.Printf("Error during token update: %v", err)
-			}
-			log.Println("Server token update task completed.")
-			time.Sleep(2 * time.Hour)
-		}
-	}()
+	go runner.StartCredentialRotation(db)
 
 	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -94,7 +113,13 @@ func main() {
 	}
 	go runner.StartUrlCallTicker(urls)
 	go runner.StartUpdateServerDataTicker(db)
+	go runner.StartBalanceMonitor(db)
 	go runner.StartSellingTicker(db)
+	go runner.StartRentalExpiry(db)
+	go runner.StartReconciler(db)
+	go runner.StartExchangeRateUpdater(db)
+	go runner.StartOtpPoller(db)
+	go runner.StartWebhookDispatcher(db)
 	e.Logger.Fatal(e.Start(":8000"))
 }
 
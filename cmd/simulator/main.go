@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/simulator"
+)
+
+// Runs the fake upstream provider. Start the app with PROVIDER_SIMULATOR_URL
+// pointing here to send every provider call to it instead of the live hosts.
+// The scenario can be changed at runtime with POST /simulator/scenario.
+func main() {
+	scenario := simulator.DefaultScenario()
+	addr := flag.String("addr", ":8081", "listen address")
+	sms := flag.String("sms", strings.Join(scenario.SMS, "|"), "SMS texts delivered in order, separated by |")
+	flag.BoolVar(&scenario.NoStock, "no-stock", false, "answer every purchase with no numbers")
+	flag.BoolVar(&scenario.BadKey, "bad-key", false, "reject every request as unauthorised")
+	flag.BoolVar(&scenario.EarlyCancelDenied, "early-cancel-denied", false, "refuse to cancel activations without SMS")
+	flag.DurationVar(&scenario.SMSDelay, "sms-delay", 0, "delay before each SMS is delivered")
+	flag.StringVar(&scenario.NextSMSAck, "next-sms-ack", scenario.NextSMSAck, "handler_api answer to a next SMS request")
+	flag.Float64Var(&scenario.Balance, "balance", scenario.Balance, "balance reported to every provider call")
+	flag.Parse()
+
+	scenario.SMS = []string{}
+	if *sms != "" {
+		scenario.SMS = strings.Split(*sms, "|")
+	}
+
+	log.Printf("Provider simulator listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, simulator.New(scenario)))
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WebhookDeliveryRetention is how long webhook deliveries are logged.
+const WebhookDeliveryRetention = 30 * 24 * time.Hour
+
+// Events customers can subscribe their webhooks to.
+const (
+	WebhookNumberPurchased  = "number.purchased"
+	WebhookOTPReceived      = "otp.received"
+	WebhookNumberCancelled  = "number.cancelled"
+	WebhookNumberExpired    = "number.expired"
+	WebhookRefundIssued     = "refund.issued"
+	WebhookRechargeCredited = "recharge.credited"
+)
+
+// WebhookEvents are all the events a webhook can be sent.
+var WebhookEvents = []string{
+	WebhookNumberPurchased,
+	WebhookOTPReceived,
+	WebhookNumberCancelled,
+	WebhookNumberExpired,
+	WebhookRefundIssued,
+	WebhookRechargeCredited,
+}
+
+// Statuses of a webhook delivery.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// CustomerWebhook is a URL a customer has us call on events of their
+// account. Payloads are signed with Secret. A webhook without Events is sent
+// every event.
+type CustomerWebhook struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"userId" json:"-"`
+	URL       string             `bson:"url" json:"url"`
+	Secret    string             `bson:"secret" json:"-"`
+	Events    []string           `bson:"events,omitempty" json:"events,omitempty"`
+	Enabled   bool               `bson:"enabled" json:"enabled"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// InitializeCustomerWebhookCollection initializes the collection for
+// "customerWebhooks".
+func InitializeCustomerWebhookCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("customerWebhooks")
+}
+
+// WebhookDelivery is one event sent, or to be sent, to a webhook. Payload
+// is the exact body posted. A failed attempt is retried at NextAttemptAt
+// until the delivery is delivered or given up as failed.
+type WebhookDelivery struct {
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	WebhookID      primitive.ObjectID  `bson:"webhookId" json:"webhookId"`
+	UserID         primitive.ObjectID  `bson:"userId" json:"-"`
+	Event          string              `bson:"event" json:"event"`
+	URL            string              `bson:"url" json:"url"`
+	Payload        string              `bson:"payload" json:"payload"`
+	Status         string              `bson:"status" json:"status"`
+	Attempts       int                 `bson:"attempts" json:"attempts"`
+	NextAttemptAt  time.Time           `bson:"nextAttemptAt,omitempty" json:"nextAttemptAt,omitempty"`
+	LastStatusCode int                 `bson:"lastStatusCode,omitempty" json:"lastStatusCode,omitempty"`
+	LastError      string              `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	ReplayOf       *primitive.ObjectID `bson:"replayOf,omitempty" json:"replayOf,omitempty"`
+	CreatedAt      time.Time           `bson:"createdAt" json:"createdAt"`
+	DeliveredAt    *time.Time          `bson:"deliveredAt,omitempty" json:"deliveredAt,omitempty"`
+}
+
+// InitializeWebhookDeliveryCollection initializes the collection for
+// "webhookDeliveries".
+func InitializeWebhookDeliveryCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("webhookDeliveries")
+}
+
+// EnsureWebhookIndexes creates the indexes of "customerWebhooks" and
+// "webhookDeliveries", once at start up. Deliveries expire after
+// WebhookDeliveryRetention.
+func EnsureWebhookIndexes(db *mongo.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := InitializeCustomerWebhookCollection(db).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: map[string]interface{}{"userId": 1},
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to create customerWebhooks indexes: %v", err)
+	}
+
+	_, err = InitializeWebhookDeliveryCollection(db).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{
+			Keys:    map[string]interface{}{"createdAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(int32(WebhookDeliveryRetention / time.Second)),
+		},
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to create webhookDeliveries indexes: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ExchangeRate is a rate fetched by the rate updater: Rate rupees for one
+// unit of Currency, as published by Source at FetchedAt.
+type ExchangeRate struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Currency  string             `bson:"currency" json:"currency"`
+	Rate      float64            `bson:"rate" json:"rate"`
+	Source    string             `bson:"source" json:"source"`
+	FetchedAt time.Time          `bson:"fetchedAt" json:"fetchedAt"`
+}
+
+// InitializeExchangeRateCollection initializes the collection for
+// "exchangeRates", the history of fetched rates.
+func InitializeExchangeRateCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("exchangeRates")
+}
+
+// EnsureExchangeRateIndexes creates the indexes of "exchangeRates", once at
+// start up.
+func EnsureExchangeRateIndexes(db *mongo.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := InitializeExchangeRateCollection(db).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "currency", Value: 1}, {Key: "fetchedAt", Value: -1}},
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to create exchangeRates indexes: %v", err)
+	}
+}
@@ -30,8 +30,12 @@ type TransactionHistory struct {
 	DateTime      string             `bson:"date_time" json:"date_time"`
 	Service       string             `bson:"service" json:"service"`
 	Server        string             `bson:"server" json:"server"`
+	Country       string             `bson:"country,omitempty" json:"country,omitempty"`
+	Operator      string             `bson:"operator,omitempty" json:"operator,omitempty"`
 	Price         string             `bson:"price" json:"price"`
 	Status        string             `bson:"status" json:"status"`
+	State         string             `bson:"state,omitempty" json:"state,omitempty"`
+	Pricing       *Pricing           `bson:"pricing,omitempty" json:"pricing,omitempty"`
 	CreatedAt     time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
 	UpdatedAt     time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
 }
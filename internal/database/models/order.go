@@ -1,8 +1,11 @@
 package models
 
 import (
+	"context"
+	"log"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -17,17 +20,52 @@ type Order struct {
 	NumberType     string             `bson:"numberType" json:"numberType"`
 	NumberID       string             `bson:"numberId" json:"numberId" validate:"required"`
 	Number         string             `bson:"number" json:"number" validate:"required"`
+	Country        string             `bson:"country,omitempty" json:"country,omitempty"`
+	Operator       string             `bson:"operator,omitempty" json:"operator,omitempty"`
 	OrderTime      time.Time          `bson:"orderTime" json:"orderTime"`
 	ExpirationTime time.Time          `bson:"expirationTime" json:"expirationTime" validate:"required"`
-	Status         string             `bson:"status" json:"status" validate:"required,oneof=ACTIVE EXPIRED"`
+	Status         string             `bson:"status" json:"status" validate:"required,oneof=CREATED WAITING_SMS SMS_RECEIVED FINISHED CANCELLED EXPIRED REFUNDED"`
+	Pricing        *Pricing           `bson:"pricing,omitempty" json:"pricing,omitempty"`
+	// Transitions are the states the order went through, oldest first.
+	Transitions []OrderTransition `bson:"transitions,omitempty" json:"transitions,omitempty"`
+}
+
+// OrderTransition is one move of an order from a state to the next.
+type OrderTransition struct {
+	From   string    `bson:"from" json:"from"`
+	To     string    `bson:"to" json:"to"`
+	Reason string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	At     time.Time `bson:"at" json:"at"`
+}
+
+// Pricing is how the price of an order was made up: the provider's cost in
+// its own currency, converted with ExchangeRate, plus Margin and the user's
+// Discount. Orders placed before costs were recorded have none.
+type Pricing struct {
+	UpstreamCost float64 `bson:"upstreamCost" json:"upstreamCost"`
+	ExchangeRate float64 `bson:"exchangeRate" json:"exchangeRate"`
+	Margin       float64 `bson:"margin" json:"margin"`
+	Discount     float64 `bson:"discount" json:"discount"`
 }
 
 // NewOrderCollection initializes and returns the orders collection with indexes if needed
 func InitializeOrderCollection(db *mongo.Database) *mongo.Collection {
-	collection := db.Collection("orders")
+	return db.Collection("orders")
+}
 
-	// Optionally, create indexes here if needed
-	// EnsureIndexes can be implemented similarly to previous examples
+// EnsureOrderIndexes creates the indexes of "orders". It is run once at start
+// up rather than by InitializeOrderCollection, which is on every request's
+// path.
+func EnsureOrderIndexes(db *mongo.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	return collection
+	_, err := InitializeOrderCollection(db).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "numberId", Value: 1}, {Key: "server", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expirationTime", Value: 1}}},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "orderTime", Value: -1}}},
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to create orders indexes: %v", err)
+	}
 }
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OrderEventRetention is how long order events can be resumed from.
+const OrderEventRetention = 24 * time.Hour
+
+// Types of order event.
+const (
+	// OrderEventState is sent when an order moves to State.
+	OrderEventState = "state"
+	// OrderEventOTP is sent when OTP is stored for an order.
+	OrderEventOTP = "otp"
+)
+
+// OrderEvent is a change of one of a customer's orders, streamed to the
+// customer. Seq numbers the events of a customer from 1 and is the id
+// streams resume from.
+type OrderEvent struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	UserID    primitive.ObjectID `bson:"userId" json:"-"`
+	Seq       int64              `bson:"seq" json:"seq"`
+	Type      string             `bson:"type" json:"type"`
+	NumberID  string             `bson:"numberId" json:"id"`
+	Server    int                `bson:"server" json:"server"`
+	State     string             `bson:"state,omitempty" json:"state,omitempty"`
+	OTP       string             `bson:"otp,omitempty" json:"otp,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// InitializeOrderEventCollection initializes the collection for
+// "orderEvents".
+func InitializeOrderEventCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("orderEvents")
+}
+
+// EnsureOrderEventIndexes creates the indexes of "orderEvents", once at start
+// up. Events expire after OrderEventRetention.
+func EnsureOrderEventIndexes(db *mongo.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := InitializeOrderEventCollection(db).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "seq", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    map[string]interface{}{"createdAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(int32(OrderEventRetention / time.Second)),
+		},
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to create orderEvents indexes: %v", err)
+	}
+}
+
+// InitializeOrderEventCounterCollection initializes the collection for
+// "orderEventCounters", holding the last event Seq of each customer.
+func InitializeOrderEventCounterCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("orderEventCounters")
+}
@@ -0,0 +1,61 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// States of an activation, shared by an order and its transaction history.
+// An order is CREATED once the customer is charged, WAITING_SMS once the
+// number is handed out and SMS_RECEIVED with its first SMS. It ends FINISHED
+// when it expires with an SMS, or REFUNDED after being CANCELLED by the
+// customer or EXPIRED without one.
+const (
+	StateCreated     = "CREATED"
+	StateWaitingSMS  = "WAITING_SMS"
+	StateSMSReceived = "SMS_RECEIVED"
+	StateFinished    = "FINISHED"
+	StateCancelled   = "CANCELLED"
+	StateExpired     = "EXPIRED"
+	StateRefunded    = "REFUNDED"
+)
+
+// orderTransitions lists the states each state may move to. Orders placed
+// before states were recorded have none and move like WAITING_SMS or
+// SMS_RECEIVED orders.
+var orderTransitions = map[string][]string{
+	"":               {StateSMSReceived, StateFinished, StateCancelled, StateExpired},
+	StateCreated:     {StateWaitingSMS, StateCancelled, StateExpired},
+	StateWaitingSMS:  {StateSMSReceived, StateCancelled, StateExpired},
+	StateSMSReceived: {StateFinished},
+	StateCancelled:   {StateRefunded},
+	StateExpired:     {StateRefunded},
+}
+
+// CanTransition reports whether an order may move from one state to another.
+func CanTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// activeStates are the states of orders still waiting to end, orders with no
+// state among them.
+var activeStates = bson.A{nil, "", StateCreated, StateWaitingSMS, StateSMSReceived}
+
+// ActiveOrders returns the filter of orders still waiting to end.
+func ActiveOrders() bson.M {
+	return bson.M{"status": bson.M{"$in": activeStates}}
+}
+
+// TransactionStatus is the PENDING, SUCCESS or CANCELLED status transaction
+// history shows for a state.
+func TransactionStatus(state string) string {
+	switch state {
+	case StateSMSReceived, StateFinished:
+		return "SUCCESS"
+	case StateCancelled, StateExpired, StateRefunded:
+		return "CANCELLED"
+	}
+	return "PENDING"
+}
@@ -0,0 +1,53 @@
+package models
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{StateCreated, StateWaitingSMS, true},
+		{StateWaitingSMS, StateSMSReceived, true},
+		{StateSMSReceived, StateFinished, true},
+		{StateWaitingSMS, StateCancelled, true},
+		{StateWaitingSMS, StateExpired, true},
+		{StateCancelled, StateRefunded, true},
+		{StateExpired, StateRefunded, true},
+		{"", StateCancelled, true},
+		{"", StateSMSReceived, true},
+
+		// An order with an SMS is never refunded, and an ended one stays ended.
+		{StateSMSReceived, StateCancelled, false},
+		{StateSMSReceived, StateExpired, false},
+		{StateFinished, StateCancelled, false},
+		{StateCancelled, StateExpired, false},
+		{StateExpired, StateCancelled, false},
+		{StateRefunded, StateRefunded, false},
+		{StateCancelled, StateCancelled, false},
+		{StateCreated, StateFinished, false},
+	}
+	for _, tt := range tests {
+		if got := CanTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("CanTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestTransactionStatus(t *testing.T) {
+	tests := map[string]string{
+		"":               "PENDING",
+		StateCreated:     "PENDING",
+		StateWaitingSMS:  "PENDING",
+		StateSMSReceived: "SUCCESS",
+		StateFinished:    "SUCCESS",
+		StateCancelled:   "CANCELLED",
+		StateExpired:     "CANCELLED",
+		StateRefunded:    "CANCELLED",
+	}
+	for state, want := range tests {
+		if got := TransactionStatus(state); got != want {
+			t.Errorf("TransactionStatus(%q) = %q, want %q", state, got, want)
+		}
+	}
+}
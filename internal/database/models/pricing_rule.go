@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Kinds of pricing rule.
+const (
+	// RuleMargin adds Value, in rupees or percent of the price, to the price.
+	RuleMargin = "margin"
+	// RuleMinPrice raises the price to at least Value rupees.
+	RuleMinPrice = "min"
+	// RuleMaxPrice caps the price at Value rupees.
+	RuleMaxPrice = "max"
+	// RuleRound rounds the price to a multiple of Value rupees, Round being
+	// "up", "down" or "nearest".
+	RuleRound = "round"
+	// RuleSurge adds Value, in rupees or percent of the price, while the
+	// provider has fewer than StockBelow numbers in stock.
+	RuleSurge = "surge"
+)
+
+// PricingRule is one step of the pricing engine, applied to the price of
+// every catalog entry it matches after the server's exchange rate and margin.
+// An empty Service or Country and a zero Server match all. Enabled rules are
+// applied by ascending Priority.
+type PricingRule struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name       string             `bson:"name" json:"name"`
+	Priority   int                `bson:"priority" json:"priority"`
+	Enabled    bool               `bson:"enabled" json:"enabled"`
+	Server     int                `bson:"server,omitempty" json:"server,omitempty"`
+	Service    string             `bson:"service,omitempty" json:"service,omitempty"`
+	Country    string             `bson:"country,omitempty" json:"country,omitempty"`
+	Kind       string             `bson:"kind" json:"kind"`
+	Value      float64            `bson:"value" json:"value"`
+	Percent    bool               `bson:"percent,omitempty" json:"percent,omitempty"`
+	Round      string             `bson:"round,omitempty" json:"round,omitempty"`
+	StockBelow int                `bson:"stockBelow,omitempty" json:"stockBelow,omitempty"`
+	CreatedAt  time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
+	UpdatedAt  time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
+}
+
+// InitializePricingRuleCollection initializes the collection for
+// "pricingRules".
+func InitializePricingRuleCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("pricingRules")
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Kinds of drift between our transactions and a provider's activations.
+const (
+	// DriftUnknownLocally is an activation running upstream that no
+	// transaction of ours knows about.
+	DriftUnknownLocally = "UNKNOWN_LOCALLY"
+	// DriftRefundedButActive is an activation we refunded that still runs,
+	// and is billed, upstream.
+	DriftRefundedButActive = "REFUNDED_BUT_ACTIVE"
+	// DriftSuccessButCancelled is an activation we charged for that the
+	// provider cancelled.
+	DriftSuccessButCancelled = "SUCCESS_BUT_CANCELLED"
+)
+
+// Reconciliation is one activation whose state differs between our
+// transaction history and its provider. Action is what the reconciler did
+// about it, empty when it only reported it. ResolvedAt is set once the drift
+// is gone.
+type Reconciliation struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Server         int                `bson:"server" json:"server"`
+	ActivationID   string             `bson:"activationId" json:"activationId"`
+	Number         string             `bson:"number" json:"number"`
+	Code           string             `bson:"code,omitempty" json:"code,omitempty"`
+	Kind           string             `bson:"kind" json:"kind"`
+	LocalStatus    string             `bson:"localStatus,omitempty" json:"localStatus,omitempty"`
+	UpstreamStatus string             `bson:"upstreamStatus" json:"upstreamStatus"`
+	Action         string             `bson:"action,omitempty" json:"action,omitempty"`
+	Error          string             `bson:"error,omitempty" json:"error,omitempty"`
+	FirstSeenAt    time.Time          `bson:"firstSeenAt" json:"firstSeenAt"`
+	LastSeenAt     time.Time          `bson:"lastSeenAt" json:"lastSeenAt"`
+	ResolvedAt     *time.Time         `bson:"resolvedAt,omitempty" json:"resolvedAt,omitempty"`
+}
+
+// InitializeReconciliationCollection initializes the collection for
+// "reconciliations".
+func InitializeReconciliationCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("reconciliations")
+}
+
+// EnsureReconciliationIndexes creates the indexes of "reconciliations", once
+// at start up.
+func EnsureReconciliationIndexes(db *mongo.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := InitializeReconciliationCollection(db).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "server", Value: 1}, {Key: "activationId", Value: 1}, {Key: "kind", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to create reconciliations indexes: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Rental states.
+const (
+	RentalActive   = "ACTIVE"
+	RentalReleased = "RELEASED"
+	RentalExpired  = "EXPIRED"
+)
+
+// RentalSMS is an SMS received on a rented number.
+type RentalSMS struct {
+	Text       string    `bson:"text" json:"text"`
+	Sender     string    `bson:"sender,omitempty" json:"sender,omitempty"`
+	ReceivedAt time.Time `bson:"receivedAt" json:"receivedAt"`
+}
+
+// Rental is a number rented by a user for one or more rental periods.
+// Price is the total charged so far, extensions included. Messages is the
+// inbox as last read from the provider.
+type Rental struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	Service   string             `bson:"service" json:"service"`
+	Code      string             `bson:"code" json:"code"`
+	Server    int                `bson:"server" json:"server"`
+	Country   string             `bson:"country,omitempty" json:"country,omitempty"`
+	RentalID  string             `bson:"rentalId" json:"rentalId"`
+	Number    string             `bson:"number" json:"number"`
+	Duration  string             `bson:"duration" json:"duration"`
+	Hours     int                `bson:"hours" json:"hours"`
+	Price     float64            `bson:"price" json:"price"`
+	Status    string             `bson:"status" json:"status"`
+	Messages  []RentalSMS        `bson:"messages" json:"messages"`
+	StartedAt time.Time          `bson:"startedAt" json:"startedAt"`
+	EndsAt    time.Time          `bson:"endsAt" json:"endsAt"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// InitializeRentalCollection initializes the collection for "rentals".
+func InitializeRentalCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("rentals")
+}
+
+// EnsureRentalIndexes creates the indexes of "rentals", once at start up.
+func EnsureRentalIndexes(db *mongo.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := InitializeRentalCollection(db).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: map[string]interface{}{"userId": 1}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "endsAt", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to create rentals indexes: %v", err)
+	}
+}
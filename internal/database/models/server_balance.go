@@ -0,0 +1,49 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ServerBalanceRetention is how long balance samples are kept.
+const ServerBalanceRetention = 30 * 24 * time.Hour
+
+// ServerBalance is a sample of our balance with a server's provider, in the
+// provider's currency, taken by the balance monitor.
+type ServerBalance struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Server    int                `bson:"server" json:"server"`
+	Balance   float64            `bson:"balance" json:"balance"`
+	Symbol    string             `bson:"symbol" json:"symbol"`
+	Currency  string             `bson:"currency,omitempty" json:"currency,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// InitializeServerBalanceCollection initializes the collection for
+// "serverBalances".
+func InitializeServerBalanceCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("serverBalances")
+}
+
+// EnsureServerBalanceIndexes creates the indexes of "serverBalances", once at
+// start up. Samples expire after ServerBalanceRetention.
+func EnsureServerBalanceIndexes(db *mongo.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := InitializeServerBalanceCollection(db).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: map[string]interface{}{"server": 1}},
+		{
+			Keys:    map[string]interface{}{"createdAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(int32(ServerBalanceRetention / time.Second)),
+		},
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to create serverBalances indexes: %v", err)
+	}
+}
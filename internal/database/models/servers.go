@@ -17,8 +17,66 @@ type Server struct {
 	Token        string             `bson:"token,omitempty" json:"token"`
 	ExchangeRate float64            `bson:"exchangeRate,omitempty" json:"exchangeRate" default:"0.0"`
 	Margin       float64            `bson:"margin,omitempty" json:"margin" default:"0.0"`
-	CreatedAt    time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
-	UpdatedAt    time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
+	// Countries are the ISO codes of the countries the server sells numbers
+	// in. Servers without any only sell in India.
+	Countries []string `bson:"countries,omitempty" json:"countries,omitempty"`
+	// LowBalanceThreshold, in the provider's currency, is the balance below
+	// which the balance monitor alerts; 0 disables alerts. With
+	// AutoMaintenance the monitor also puts the server into maintenance and
+	// sets BalanceMaintenance, so it can lift it again once topped up.
+	LowBalanceThreshold float64 `bson:"lowBalanceThreshold,omitempty" json:"lowBalanceThreshold,omitempty"`
+	AutoMaintenance     bool    `bson:"autoMaintenance,omitempty" json:"autoMaintenance,omitempty"`
+	BalanceMaintenance  bool    `bson:"balanceMaintenance,omitempty" json:"balanceMaintenance,omitempty"`
+	// RateLimit is the most requests a second and MaxInFlight the most
+	// concurrent requests we send the provider; 0 means no limit.
+	RateLimit   float64 `bson:"rateLimit,omitempty" json:"rateLimit,omitempty"`
+	MaxInFlight int     `bson:"maxInFlight,omitempty" json:"maxInFlight,omitempty"`
+	// TokenExpiresAt, TokenRefreshedAt and TokenError track the token of
+	// providers that hand out short lived tokens, kept by the credential
+	// rotation.
+	TokenExpiresAt   time.Time       `bson:"tokenExpiresAt,omitempty" json:"tokenExpiresAt,omitempty"`
+	TokenRefreshedAt time.Time       `bson:"tokenRefreshedAt,omitempty" json:"tokenRefreshedAt,omitempty"`
+	TokenError       string          `bson:"tokenError,omitempty" json:"tokenError,omitempty"`
+	Provider         *ProviderConfig `bson:"provider,omitempty" json:"provider,omitempty"`
+	WebhookSecret    string          `bson:"webhookSecret,omitempty" json:"-"`
+	CreatedAt        time.Time       `bson:"createdAt,omitempty" json:"createdAt"`
+	UpdatedAt        time.Time       `bson:"updatedAt,omitempty" json:"updatedAt"`
+	// Currency overrides the ISO code of the currency the provider bills
+	// in. ExchangeRate, rupees per unit of it, is kept by the rate updater
+	// unless ExchangeRateManual is set by an admin override. Servers that
+	// had a rate before the updater existed have no ExchangeRateManual and
+	// keep their rate until an admin opts them in.
+	Currency              string    `bson:"currency,omitempty" json:"currency,omitempty"`
+	ExchangeRateManual    *bool     `bson:"exchangeRateManual,omitempty" json:"exchangeRateManual,omitempty"`
+	ExchangeRateUpdatedAt time.Time `bson:"exchangeRateUpdatedAt,omitempty" json:"exchangeRateUpdatedAt,omitempty"`
+}
+
+// ProviderConfig describes an upstream speaking a generic protocol, so that a
+// server can be onboarded from its document without a code change. Servers
+// without one use the built-in provider registered for their number.
+type ProviderConfig struct {
+	Protocol     string            `bson:"protocol" json:"protocol"`
+	BaseURL      string            `bson:"baseUrl" json:"baseUrl"`
+	Country      string            `bson:"country" json:"country"`
+	Operator     string            `bson:"operator,omitempty" json:"operator,omitempty"`
+	ExtraParams  map[string]string `bson:"extraParams,omitempty" json:"extraParams,omitempty"`
+	SendMaxPrice bool              `bson:"sendMaxPrice" json:"sendMaxPrice"`
+	// Countries overrides the provider's country code per ISO country code.
+	// Country is the provider's code for India, the default country.
+	Countries map[string]string `bson:"countries,omitempty" json:"countries,omitempty"`
+	// NumberPrefix, when set, is stripped from numbers instead of the calling
+	// code of the ordered country.
+	NumberPrefix string   `bson:"numberPrefix,omitempty" json:"numberPrefix,omitempty"`
+	NextSMSAck   string   `bson:"nextSmsAck,omitempty" json:"nextSmsAck,omitempty"`
+	CancelOK     []string `bson:"cancelOk,omitempty" json:"cancelOk,omitempty"`
+	// Currency is the ISO code of the currency the provider bills in.
+	// Symbol, used by configs that predate it, is the symbol balances are
+	// shown with.
+	Currency string `bson:"currency,omitempty" json:"currency,omitempty"`
+	Symbol   string `bson:"symbol,omitempty" json:"symbol,omitempty"`
+	// Rent enables the getRentNumber family of actions for providers that
+	// rent numbers.
+	Rent bool `bson:"rent,omitempty" json:"rent,omitempty"`
 }
 
 // InitializeServerCollection initializes the collection for "servers"
@@ -14,6 +14,32 @@ type ServerData struct {
 	Code   string `bson:"code" json:"code"`
 	Otp    string `bson:"otp" json:"otp"`
 	Block  bool   `bson:"block" json:"block"`
+	// Country is the ISO code of the country the entry sells numbers in,
+	// empty for India.
+	Country string `bson:"country,omitempty" json:"country,omitempty"`
+	// Stock is the provider's stock at the last catalog sync, nil if unknown.
+	Stock *int `bson:"stock,omitempty" json:"stock,omitempty"`
+	// Operators are the carriers numbers can be ordered from. Entries
+	// without any accept whatever operator the provider does.
+	Operators []OperatorPrice `bson:"operators,omitempty" json:"operators,omitempty"`
+	// Rent is the price of renting a number by rental period ("day",
+	// "week"), for servers that rent numbers.
+	Rent map[string]string `bson:"rent,omitempty" json:"rent,omitempty"`
+	// Cost is the provider's price at the last catalog sync, in the
+	// provider's currency. It is kept from customers.
+	Cost float64 `bson:"cost,omitempty" json:"-"`
+	// RentCost is the provider's price by rental period, like Cost.
+	RentCost map[string]float64 `bson:"rentCost,omitempty" json:"-"`
+}
+
+// OperatorPrice is a carrier a server sells a service from. Price, when set,
+// replaces the entry price for numbers from the carrier.
+type OperatorPrice struct {
+	Name  string `bson:"name" json:"name"`
+	Price string `bson:"price,omitempty" json:"price,omitempty"`
+	Stock *int   `bson:"stock,omitempty" json:"stock,omitempty"`
+	// Cost is the provider's price for the carrier, like ServerData.Cost.
+	Cost float64 `bson:"cost,omitempty" json:"-"`
 }
 
 // ServerList represents the main structure for the server list document
@@ -12,6 +12,7 @@ type ServiceDiscount struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Service   string             `bson:"service" json:"service" validate:"required"`
 	Server    int                `bson:"server" json:"server" validate:"required"`
+	Country   string             `bson:"country,omitempty" json:"country,omitempty"`
 	Discount  float64            `bson:"discount,omitempty" json:"discount" default:"0"`
 	CreatedAt time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
 	UpdatedAt time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UpstreamAuditRetention is how long upstream exchanges are kept.
+const UpstreamAuditRetention = 30 * 24 * time.Hour
+
+// UpstreamAudit is one request we sent a server's provider and its answer.
+// URL has the credentials redacted and Body is truncated.
+type UpstreamAudit struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Server       int                `bson:"server" json:"server"`
+	Operation    string             `bson:"operation" json:"operation"`
+	ActivationID string             `bson:"activationId,omitempty" json:"activationId,omitempty"`
+	Method       string             `bson:"method" json:"method"`
+	URL          string             `bson:"url" json:"url"`
+	Status       int                `bson:"status" json:"status"`
+	LatencyMs    int64              `bson:"latencyMs" json:"latencyMs"`
+	Attempt      int                `bson:"attempt" json:"attempt"`
+	Body         string             `bson:"body,omitempty" json:"body,omitempty"`
+	Error        string             `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// InitializeUpstreamAuditCollection initializes the collection for
+// "upstreamAudit".
+func InitializeUpstreamAuditCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("upstreamAudit")
+}
+
+// EnsureUpstreamAuditIndexes creates the indexes of "upstreamAudit", once at
+// start up. Exchanges expire after UpstreamAuditRetention.
+func EnsureUpstreamAuditIndexes(db *mongo.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := InitializeUpstreamAuditCollection(db).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: map[string]interface{}{"activationId": 1}},
+		{
+			Keys:    map[string]interface{}{"createdAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(int32(UpstreamAuditRetention / time.Second)),
+		},
+	})
+	if err != nil {
+		log.Printf("ERROR: Failed to create upstreamAudit indexes: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -12,8 +13,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
-	"github.com/ranjankuldeep/fakeNumber/internal/services"
-	"github.com/ranjankuldeep/fakeNumber/internal/utils"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -85,9 +85,9 @@ func GetNumberHandlerApi(c echo.Context) error {
 
 	serverListCollection := models.InitializeServerListCollection(db)
 	var serviceList models.ServerList
+	country := provider.DefaultCountry
 	err = serverListCollection.FindOne(ctx, bson.M{
-		"servers.server": serverNumber,
-		"servers.code":   code,
+		"servers": bson.M{"$elemMatch": bson.M{"server": serverNumber, "code": code, "country": countryFilter(country)}},
 	}).Decode(&serviceList)
 	if err != nil {
 		logs.Logger.Error("service not found for given server and code")
@@ -97,7 +97,7 @@ func GetNumberHandlerApi(c echo.Context) error {
 	// Identify the specific service based on server and code
 	var serviceName string
 	for _, s := range serviceList.Servers {
-		if s.Server == serverNumber && s.Code == code {
+		if s.Server == serverNumber && s.Code == code && inCountry(s, country) {
 			serviceName = serviceList.Name
 			break
 		}
@@ -115,34 +115,35 @@ func GetNumberHandlerApi(c echo.Context) error {
 	// Process server data
 	var serverData models.ServerData
 	for _, s := range serviceList.Servers {
-		if s.Server == serverNumber {
+		if s.Server == serverNumber && s.Code == code && inCountry(s, country) {
 			serverData = models.ServerData{
-				Price:  s.Price,
-				Code:   s.Code,
-				Otp:    s.Otp,
-				Server: serverNumber,
+				Price:   s.Price,
+				Cost:    s.Cost,
+				Code:    s.Code,
+				Otp:     s.Otp,
+				Server:  serverNumber,
+				Country: country,
 			}
 			break
 		}
 	}
 
 	price, _ := strconv.ParseFloat(serverData.Price, 64)
-	discount, err := FetchDiscount(ctx, db, user.ID.Hex(), serviceName, serverNumber)
+	discount, err := FetchDiscount(ctx, db, user.ID.Hex(), serviceName, serverNumber, serverData.Country)
 	price += discount
 
 	if apiWalletUser.Balance < price {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "low balance"})
 	}
 
-	apiURLRequest, err := constructApiUrl(db, server, serverInfo.APIKey, serverInfo.Token, serverData, isMultiple)
-	if err != nil {
-		logs.Logger.Error("failed to construct API URL")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
-	}
-	numData, err := ExtractNumber(server, apiURLRequest)
+	pricing := orderPricing(serverInfo, serverData, discount)
+	numData, err := ExtractNumber(context.WithoutCancel(c.Request().Context()), serverInfo, serverData, "", isMultiple == "true")
 	if err != nil {
 		logs.Logger.Error(err)
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		return c.JSON(http.StatusBadRequest, providerErrorResponse(err))
+	}
+	if numData.Id == "" || numData.Number == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "no stock available"})
 	}
 	newBalance := math.Round((apiWalletUser.Balance-price)*100) / 100
 	_, err = apiWalletCollection.UpdateOne(ctx, bson.M{"userId": user.ID}, bson.M{"$set": bson.M{"balance": newBalance}})
@@ -162,6 +163,8 @@ func GetNumberHandlerApi(c echo.Context) error {
 		ID:            primitive.NewObjectID(),
 		Number:        numData.Number,
 		Status:        "PENDING",
+		State:         models.StateWaitingSMS,
+		Pricing:       pricing,
 		DateTime:      time.Now().In(time.FixedZone("IST", 5*3600+30*60)).Format("2006-01-02T15:04:05"),
 	}
 	_, err = transactionHistoryCollection.InsertOne(ctx, transaction)
@@ -181,16 +184,16 @@ func GetNumberHandlerApi(c echo.Context) error {
 		Number:         numData.Number,
 		OrderTime:      time.Now(),
 		ExpirationTime: time.Now().Add(19 * time.Minute), // Adjust expiration time as needed
+		Pricing:        pricing,
+		Status:         models.StateWaitingSMS,
+		Transitions:    handedOutTransitions(),
 	}
 	_, err = orderCollection.InsertOne(ctx, order)
 	if err != nil {
 		logs.Logger.Error("failed to create order")
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
 	}
-
-	if numData.Id == "" || numData.Number == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "no stock available"})
-	}
+	publishStateEvent(ctx, db, order, models.StateWaitingSMS)
 	return c.JSON(http.StatusOK, echo.Map{
 		"status": "ok",
 		"id":     numData.Id,
@@ -233,8 +236,6 @@ func GetOTPHandlerApi(c echo.Context) error {
 		logs.Logger.Info("sdf")
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
 	}
-	serviceName := transaction.Service
-
 	if transaction.Status == "CANCELLED" {
 		return c.JSON(http.StatusOK, map[string]string{"status": "ok", "otp": "number cancelled"})
 	}
@@ -260,72 +261,13 @@ func GetOTPHandlerApi(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "your account is blocked, contact the admin"})
 	}
 
-	serverData, err := getServerDataWithMaintenanceCheck(db, server)
+	_, err = getServerDataWithMaintenanceCheck(db, server)
 	if err != nil {
 		logs.Logger.Error(err)
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	constructedOTPRequest, err := constructOtpUrl(server, serverData.APIKey, serverData.Token, id)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "INVALID_SERVER"})
-	}
-
-	validOtpList, err := fetchOTP(server, id, constructedOTPRequest)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-	}
-
-	for _, validOtp := range validOtpList {
-		transactionCollection := models.InitializeTransactionHistoryCollection(db)
-		filter := bson.M{"id": id, "otp": validOtp}
-		var existingEntry models.TransactionHistory
-		err = transactionCollection.FindOne(ctx, filter).Decode(&existingEntry)
-		if err == mongo.ErrNoDocuments {
-			formattedDateTime := FormatDateTime()
-			update := bson.M{
-				"$addToSet": bson.M{"otp": validOtp},
-				"$set":      bson.M{"date_time": formattedDateTime},
-			}
-
-			filter := bson.M{"id": id}
-			_, err = transactionCollection.UpdateOne(ctx, filter, update)
-			if err != nil {
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-			}
-
-			ipDetail, err := utils.ExtractIpDetails(c)
-			if err != nil {
-				logs.Logger.Error(err)
-			}
-
-			otpDetail := services.OTPDetails{
-				Email:       userData.Email,
-				ServiceName: existingEntry.Service,
-				Price:       existingEntry.Price,
-				Server:      existingEntry.Server,
-				Number:      existingEntry.Number,
-				OTP:         validOtp,
-				Ip:          ipDetail,
-			}
-
-			err = services.OtpGetDetails(otpDetail)
-			if err != nil {
-				logs.Logger.Error(err)
-			}
-
-			go func(otp string) {
-				err := triggerNextOtp(db, server, serviceName, id)
-				if err != nil {
-					log.Printf("Error triggering next OTP for ID: %s, OTP: %s - %v", id, otp, err)
-				} else {
-					log.Printf("Successfully triggered next OTP for ID: %s, OTP: %s", id, otp)
-				}
-			}(validOtp)
-		}
-	}
+	// The OTP poller keeps transaction.OTP up to date with the provider.
 	return c.JSON(http.StatusOK, map[string]interface{}{"status": "ok", "otp": transaction.OTP})
 }
 
@@ -356,13 +298,23 @@ func CancelNumberHandlerApi(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]string{"error": "site is under maintenance"})
 	}
 
+	serverNumber, err := strconv.Atoi(server)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid server number"})
+	}
 	transactionCollection := models.InitializeTransactionHistoryCollection(db)
 	var existingOrder models.Order
 	orderCollection := models.InitializeOrderCollection(db)
-	err = orderCollection.FindOne(ctx, bson.M{"numberId": id}).Decode(&existingOrder)
+	err = orderCollection.FindOne(ctx, bson.M{"numberId": id, "server": serverNumber}).Decode(&existingOrder)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"errror": "internal server error"})
 	}
+	if !models.CanTransition(existingOrder.Status, models.StateCancelled) {
+		if existingOrder.Status == models.StateSMSReceived || existingOrder.Status == models.StateFinished {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "otp already come"})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "number already cancelled"})
+	}
 
 	var apiWalletUser models.ApiWalletUser
 	apiWalletCollection := models.InitializeApiWalletuserCollection(db)
@@ -415,56 +367,20 @@ func CancelNumberHandlerApi(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "otp already come"})
 	}
 
-	constructedNumberRequest, err := ConstructNumberUrl(server, serverData.APIKey, serverData.Token, id, existingOrder.Number)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid server"})
-	}
-
-	err = CancelNumberThirdParty(constructedNumberRequest.URL, server, id, db, constructedNumberRequest.Headers)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-	}
-
-	_, err = orderCollection.DeleteOne(ctx, bson.M{"numberId": id})
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
-	}
-
-	formattedData := FormatDateTime()
-
-	var transaction models.TransactionHistory
-	err = transactionCollection.FindOne(ctx, bson.M{"id": id}).Decode(&transaction)
+	err = CancelNumberThirdParty(context.WithoutCancel(c.Request().Context()), serverData, id, existingOrder.Number)
 	if err != nil {
 		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-	}
-
-	transactionUpdateFilter := bson.M{"id": id}
-	transactionpdate := bson.M{
-		"$set": bson.M{
-			"status":    "CANCELLED",
-			"date_time": formattedData,
-		},
+		return c.JSON(http.StatusInternalServerError, providerErrorResponse(err))
 	}
 
-	_, err = transactionCollection.UpdateOne(ctx, transactionUpdateFilter, transactionpdate)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-	}
-	price, err := strconv.ParseFloat(transaction.Price, 64)
-	newBalance := apiWalletUser.Balance + price
-	newBalance = math.Round(newBalance*100) / 100
-
-	update := bson.M{
-		"$set": bson.M{"balance": newBalance},
+	err = RefundOrder(ctx, db, existingOrder, models.StateCancelled, "cancelled by customer")
+	if errors.Is(err, ErrInvalidTransition) {
+		if !endedCancelled(ctx, db, existingOrder) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "number already cancelled"})
+		}
+		// Cancelled, and refunded, by the provider in the meantime.
+		err = nil
 	}
-	balanceFilter := bson.M{"_id": apiWalletUser.UserID}
-
-	_, err = apiWalletCollection.UpdateOne(ctx, balanceFilter, update)
 	if err != nil {
 		logs.Logger.Error(err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
@@ -474,6 +390,7 @@ func CancelNumberHandlerApi(c echo.Context) error {
 
 func GetServiceDataApi(c echo.Context) error {
 	apiKey := c.QueryParam("api_key")
+	country := provider.NormalizeCountry(c.QueryParam("country"))
 	if apiKey == "" {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
 	}
@@ -525,6 +442,8 @@ func GetServiceDataApi(c echo.Context) error {
 			maintenanceServerNumbers = append(maintenanceServerNumbers, server.ServerNumber)
 		}
 	}
+	// Servers whose circuit breaker is open are hidden like maintenance ones.
+	maintenanceServerNumbers = append(maintenanceServerNumbers, provider.Tripped()...)
 
 	cursor, err := serviceCollection.Find(context.Background(), bson.D{})
 	if err != nil {
@@ -562,13 +481,16 @@ func GetServiceDataApi(c echo.Context) error {
 		seenServers := make(map[int]bool)
 
 		for _, server := range service.Servers {
+			if !inCountry(server, country) {
+				continue
+			}
 			if contains(maintenanceServerNumbers, server.Server) || seenServers[server.Server] {
 				continue // Skip maintenance or duplicate servers
 			}
 			seenServers[server.Server] = true
 
 			// Calculate discounts
-			discount := CalculateDiscount(serviceDiscounts, serverDiscounts, userDiscounts, service.Name, server.Server, apiWalletUser.UserID.Hex())
+			discount := CalculateDiscount(serviceDiscounts, serverDiscounts, userDiscounts, service.Name, server.Server, country, apiWalletUser.UserID.Hex())
 			price, _ := strconv.ParseFloat(server.Price, 64)
 			adjustedPrice := strconv.FormatFloat(price+discount, 'f', 2, 64)
 
@@ -584,10 +506,11 @@ func GetServiceDataApi(c echo.Context) error {
 			}
 
 			serverDetails = append(serverDetails, ServerDetail{
-				Server: strconv.Itoa(server.Server),
-				Price:  adjustedPrice,
-				Code:   server.Code,
-				Otp:    otpType,
+				Server:    strconv.Itoa(server.Server),
+				Price:     adjustedPrice,
+				Code:      server.Code,
+				Otp:       otpType,
+				Operators: operatorDetails(server, discount),
 			})
 		}
 
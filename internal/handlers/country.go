@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"strconv"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// countryFilter matches the country field of catalog entries and discounts.
+// Documents written before countries existed have none and are Indian.
+func countryFilter(country string) interface{} {
+	if country == provider.DefaultCountry {
+		return bson.M{"$in": bson.A{country, "", nil}}
+	}
+	return country
+}
+
+// inCountry reports whether a catalog entry sells numbers in the country.
+func inCountry(serverData models.ServerData, country string) bool {
+	return provider.NormalizeCountry(serverData.Country) == country
+}
+
+// discountKey keys service discounts by service, server and country. Keys for
+// the default country are the ones used before countries existed.
+func discountKey(service string, server int, country string) string {
+	key := service + "_" + strconv.Itoa(server)
+	if country = provider.NormalizeCountry(country); country != provider.DefaultCountry {
+		key += "_" + country
+	}
+	return key
+}
@@ -0,0 +1,524 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// webhookMaxAttempts is how many times a delivery is tried before it is
+	// given up as failed.
+	webhookMaxAttempts = 8
+	// webhookFirstRetry is the wait after the first failed attempt, doubled
+	// after each further one up to webhookMaxRetry.
+	webhookFirstRetry = 30 * time.Second
+	webhookMaxRetry   = 6 * time.Hour
+	// webhookLease is how long an attempt holds a delivery, so no other
+	// instance tries it at the same time.
+	webhookLease = time.Minute
+)
+
+// webhookEventOfState is the webhook event sent when an order moves to a
+// state.
+var webhookEventOfState = map[string]string{
+	models.StateWaitingSMS: models.WebhookNumberPurchased,
+	models.StateCancelled:  models.WebhookNumberCancelled,
+	models.StateExpired:    models.WebhookNumberExpired,
+	models.StateRefunded:   models.WebhookRefundIssued,
+}
+
+// webhookPayload is the JSON body posted to customer webhooks. ID stays the
+// same when a delivery is replayed, so receivers can drop duplicates.
+type webhookPayload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// orderWebhookData is the data of the webhook events of an order.
+func orderWebhookData(order models.Order) echo.Map {
+	data := echo.Map{
+		"id":      order.NumberID,
+		"server":  order.Server,
+		"number":  order.Number,
+		"service": order.Service,
+		"price":   fmt.Sprintf("%.2f", order.Price),
+	}
+	if order.Country != "" {
+		data["country"] = order.Country
+	}
+	if order.Operator != "" {
+		data["operator"] = order.Operator
+	}
+	return data
+}
+
+// queueWebhooks logs a delivery of an event to each enabled webhook of the
+// customer subscribed to it and tries them right away; failed ones are
+// retried by the webhook dispatcher. A failure is only logged, so a webhook
+// never fails the change it reports.
+func queueWebhooks(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, event string, data interface{}) {
+	cursor, err := models.InitializeCustomerWebhookCollection(db).Find(ctx, bson.M{
+		"userId":  userID,
+		"enabled": true,
+		"$or":     bson.A{bson.M{"events": event}, bson.M{"events": bson.M{"$exists": false}}, bson.M{"events": bson.A{}}},
+	})
+	if err != nil {
+		logs.Logger.Errorf("failed to load webhooks of %s: %v", userID.Hex(), err)
+		return
+	}
+	var webhooks []models.CustomerWebhook
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		logs.Logger.Errorf("failed to decode webhooks of %s: %v", userID.Hex(), err)
+		return
+	}
+
+	deliveries := models.InitializeWebhookDeliveryCollection(db)
+	for _, webhook := range webhooks {
+		now := time.Now()
+		delivery := models.WebhookDelivery{
+			ID:            primitive.NewObjectID(),
+			WebhookID:     webhook.ID,
+			UserID:        userID,
+			Event:         event,
+			URL:           webhook.URL,
+			Status:        models.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+		payload, err := json.Marshal(webhookPayload{ID: delivery.ID.Hex(), Event: event, CreatedAt: now, Data: data})
+		if err != nil {
+			logs.Logger.Errorf("failed to encode %s webhook: %v", event, err)
+			continue
+		}
+		delivery.Payload = string(payload)
+		if _, err := deliveries.InsertOne(ctx, delivery); err != nil {
+			logs.Logger.Errorf("failed to queue %s webhook to %s: %v", event, webhook.URL, err)
+			continue
+		}
+		go func(id primitive.ObjectID) {
+			ctx, cancel := context.WithTimeout(context.Background(), webhookLease)
+			defer cancel()
+			if _, err := attemptDelivery(ctx, db, id); err != nil {
+				logs.Logger.Errorf("failed to attempt webhook delivery %s: %v", id.Hex(), err)
+			}
+		}(delivery.ID)
+	}
+}
+
+// signWebhook is the signature of a webhook body sent at a timestamp: the
+// hex HMAC-SHA256, keyed with the webhook's secret, of the timestamp, a dot
+// and the body.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// attemptDelivery posts a pending delivery that is due, unless another
+// attempt holds it, and records the outcome. The body is signed in the
+// X-Webhook-Signature header as "sha256=" and signWebhook of the
+// X-Webhook-Timestamp header. It returns the delivery as left by the attempt,
+// or nil when there was nothing to attempt.
+func attemptDelivery(ctx context.Context, db *mongo.Database, id primitive.ObjectID) (*models.WebhookDelivery, error) {
+	deliveries := models.InitializeWebhookDeliveryCollection(db)
+	now := time.Now()
+	var delivery models.WebhookDelivery
+	err := deliveries.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "status": models.DeliveryPending, "nextAttemptAt": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"nextAttemptAt": now.Add(webhookLease)}, "$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var webhook models.CustomerWebhook
+	err = models.InitializeCustomerWebhookCollection(db).FindOne(ctx, bson.M{"_id": delivery.WebhookID}).Decode(&webhook)
+	switch {
+	case err == mongo.ErrNoDocuments:
+		delivery.LastError = "webhook deleted"
+	case err != nil:
+		return nil, err
+	case !webhook.Enabled:
+		delivery.LastError = "webhook disabled"
+	}
+	if delivery.LastError != "" {
+		delivery.Status = models.DeliveryFailed
+		_, err := deliveries.UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{"$set": bson.M{
+			"status":    delivery.Status,
+			"lastError": delivery.LastError,
+		}})
+		return &delivery, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	body := []byte(delivery.Payload)
+	_, status, err := httpclient.PostPublic(ctx, webhook.URL, echo.MIMEApplicationJSON, body, map[string]string{
+		"X-Webhook-Event":     delivery.Event,
+		"X-Webhook-Delivery":  delivery.ID.Hex(),
+		"X-Webhook-Timestamp": timestamp,
+		"X-Webhook-Signature": "sha256=" + signWebhook(webhook.Secret, timestamp, body),
+	})
+
+	set := bson.M{"lastStatusCode": status, "url": webhook.URL}
+	delivery.LastStatusCode = status
+	delivery.URL = webhook.URL
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		deliveredAt := time.Now()
+		delivery.Status = models.DeliveryDelivered
+		delivery.DeliveredAt = &deliveredAt
+		delivery.LastError = ""
+		set["deliveredAt"] = deliveredAt
+	default:
+		if err != nil {
+			delivery.LastError = err.Error()
+		} else {
+			delivery.LastError = fmt.Sprintf("status %d", status)
+		}
+		if delivery.Attempts >= webhookMaxAttempts {
+			delivery.Status = models.DeliveryFailed
+		} else {
+			wait := webhookFirstRetry << (delivery.Attempts - 1)
+			if wait > webhookMaxRetry {
+				wait = webhookMaxRetry
+			}
+			delivery.NextAttemptAt = time.Now().Add(wait)
+			set["nextAttemptAt"] = delivery.NextAttemptAt
+		}
+	}
+	set["status"] = delivery.Status
+	set["lastError"] = delivery.LastError
+	if _, err := deliveries.UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{"$set": set}); err != nil {
+		return &delivery, err
+	}
+	return &delivery, nil
+}
+
+// DispatchWebhooks attempts the pending deliveries that are due, a few at a
+// time, and returns how many it attempted.
+func DispatchWebhooks(ctx context.Context, db *mongo.Database) (int, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}}).
+		SetLimit(100).
+		SetProjection(bson.M{"_id": 1})
+	cursor, err := models.InitializeWebhookDeliveryCollection(db).Find(ctx, bson.M{
+		"status":        models.DeliveryPending,
+		"nextAttemptAt": bson.M{"$lte": time.Now()},
+	}, opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load due webhook deliveries: %w", err)
+	}
+	var due []models.WebhookDelivery
+	if err := cursor.All(ctx, &due); err != nil {
+		return 0, fmt.Errorf("failed to decode due webhook deliveries: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, 4)
+	for _, delivery := range due {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(id primitive.ObjectID) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if _, err := attemptDelivery(ctx, db, id); err != nil {
+				logs.Logger.Errorf("failed to attempt webhook delivery %s: %v", id.Hex(), err)
+			}
+		}(delivery.ID)
+	}
+	wg.Wait()
+	return len(due), nil
+}
+
+// webhookOwner returns the customer of the apikey parameter.
+func webhookOwner(c echo.Context, db *mongo.Database) (primitive.ObjectID, error) {
+	apiKey := c.QueryParam("apikey")
+	if apiKey == "" {
+		return primitive.NilObjectID, errors.New("empty api key")
+	}
+	var apiWalletUser models.ApiWalletUser
+	err := models.InitializeApiWalletuserCollection(db).FindOne(context.TODO(), bson.M{"api_key": apiKey}).Decode(&apiWalletUser)
+	if err != nil {
+		return primitive.NilObjectID, errors.New("invalid api key")
+	}
+	return apiWalletUser.UserID, nil
+}
+
+// newWebhookSecret returns a random signing secret.
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// GetCustomerWebhooks lists the webhooks of the customer of an API key and
+// the events they can subscribe to.
+func GetCustomerWebhooks(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	userID, err := webhookOwner(c, db)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	cursor, err := models.InitializeCustomerWebhookCollection(db).Find(context.TODO(), bson.M{"userId": userID}, options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	webhooks := []models.CustomerWebhook{}
+	if err := cursor.All(context.TODO(), &webhooks); err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"webhooks": webhooks, "events": models.WebhookEvents})
+}
+
+// SaveCustomerWebhook registers a webhook for the customer of an API key, or
+// updates one when the body has its id. The signing secret is only returned
+// when the webhook is created or rotateSecret is set.
+func SaveCustomerWebhook(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	userID, err := webhookOwner(c, db)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	var input struct {
+		ID           string   `json:"id"`
+		URL          string   `json:"url"`
+		Events       []string `json:"events"`
+		Enabled      *bool    `json:"enabled"`
+		RotateSecret bool     `json:"rotateSecret"`
+	}
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+	parsed, err := url.Parse(input.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "url must be an http or https URL"})
+	}
+	// Deliveries are only ever dialed to public addresses too; this check
+	// just reports a bad url up front.
+	if err := httpclient.CheckPublicHost(c.Request().Context(), parsed.Hostname()); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "url must resolve to a public address"})
+	}
+	for _, event := range input.Events {
+		known := false
+		for _, e := range models.WebhookEvents {
+			known = known || e == event
+		}
+		if !known {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "unknown event " + event})
+		}
+	}
+	enabled := input.Enabled == nil || *input.Enabled
+
+	collection := models.InitializeCustomerWebhookCollection(db)
+	now := time.Now()
+	if input.ID == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			logs.Logger.Error(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		}
+		webhook := models.CustomerWebhook{
+			ID:        primitive.NewObjectID(),
+			UserID:    userID,
+			URL:       input.URL,
+			Secret:    secret,
+			Events:    input.Events,
+			Enabled:   enabled,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if _, err := collection.InsertOne(context.TODO(), webhook); err != nil {
+			logs.Logger.Error(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		}
+		return c.JSON(http.StatusOK, echo.Map{"webhook": webhook, "secret": secret})
+	}
+
+	id, err := primitive.ObjectIDFromHex(input.ID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid webhook id"})
+	}
+	set := bson.M{"url": input.URL, "events": input.Events, "enabled": enabled, "updatedAt": now}
+	var secret string
+	if input.RotateSecret {
+		if secret, err = newWebhookSecret(); err != nil {
+			logs.Logger.Error(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		}
+		set["secret"] = secret
+	}
+	var webhook models.CustomerWebhook
+	err = collection.FindOneAndUpdate(context.TODO(),
+		bson.M{"_id": id, "userId": userID},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&webhook)
+	if err == mongo.ErrNoDocuments {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "webhook not found"})
+	}
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	response := echo.Map{"webhook": webhook}
+	if secret != "" {
+		response["secret"] = secret
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// DeleteCustomerWebhook removes a webhook of the customer of an API key.
+// Its pending deliveries fail on their next attempt.
+func DeleteCustomerWebhook(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	userID, err := webhookOwner(c, db)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	id, err := primitive.ObjectIDFromHex(c.QueryParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid webhook id"})
+	}
+	result, err := models.InitializeCustomerWebhookCollection(db).DeleteOne(context.TODO(), bson.M{"_id": id, "userId": userID})
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	if result.DeletedCount == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "webhook not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Webhook deleted successfully."})
+}
+
+// GetWebhookDeliveries lists the latest webhook deliveries of the customer
+// of an API key, optionally of one webhook, event or status.
+func GetWebhookDeliveries(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	userID, err := webhookOwner(c, db)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	filter := bson.M{"userId": userID}
+	if value := c.QueryParam("webhookId"); value != "" {
+		webhookID, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid webhook id"})
+		}
+		filter["webhookId"] = webhookID
+	}
+	if event := c.QueryParam("event"); event != "" {
+		filter["event"] = event
+	}
+	if status := c.QueryParam("status"); status != "" {
+		filter["status"] = status
+	}
+	limit := int64(100)
+	if value := c.QueryParam("limit"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 500"})
+		}
+		limit = parsed
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit)
+	cursor, err := models.InitializeWebhookDeliveryCollection(db).Find(context.TODO(), filter, opts)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	deliveries := []models.WebhookDelivery{}
+	if err := cursor.All(context.TODO(), &deliveries); err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// ReplayWebhookDelivery sends the payload of a past delivery again, as a new
+// delivery to the same webhook, and returns how the first attempt went. The
+// payload, and so its id, is unchanged.
+func ReplayWebhookDelivery(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	userID, err := webhookOwner(c, db)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	id, err := primitive.ObjectIDFromHex(c.QueryParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid delivery id"})
+	}
+
+	deliveries := models.InitializeWebhookDeliveryCollection(db)
+	var original models.WebhookDelivery
+	err = deliveries.FindOne(context.TODO(), bson.M{"_id": id, "userId": userID}).Decode(&original)
+	if err == mongo.ErrNoDocuments {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "delivery not found"})
+	}
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+
+	now := time.Now()
+	replay := models.WebhookDelivery{
+		ID:            primitive.NewObjectID(),
+		WebhookID:     original.WebhookID,
+		UserID:        userID,
+		Event:         original.Event,
+		URL:           original.URL,
+		Payload:       original.Payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: now,
+		ReplayOf:      &original.ID,
+		CreatedAt:     now,
+	}
+	if _, err := deliveries.InsertOne(context.TODO(), replay); err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), webhookLease)
+	defer cancel()
+	attempted, err := attemptDelivery(ctx, db, replay.ID)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	if attempted == nil {
+		return c.JSON(http.StatusOK, replay)
+	}
+	return c.JSON(http.StatusOK, attempted)
+}
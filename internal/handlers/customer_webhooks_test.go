@@ -0,0 +1,18 @@
+package handlers
+
+import "testing"
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"event":"otp.received"}`)
+	const want = "e12c401452d64965d8e5a867ca5314699ba302fe5377245f60ee8698c61324b5"
+	if got := signWebhook("whsec_test", "1700000000", body); got != want {
+		t.Fatalf("signWebhook = %s, want %s", got, want)
+	}
+	// The timestamp is signed, so a replayed body with a new one fails.
+	if got := signWebhook("whsec_test", "1700000001", body); got == want {
+		t.Fatal("signature does not depend on the timestamp")
+	}
+	if got := signWebhook("whsec_other", "1700000000", body); got == want {
+		t.Fatal("signature does not depend on the secret")
+	}
+}
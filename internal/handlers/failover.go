@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// numberCandidate is a server a number can be bought from, with the price
+// the user pays there after discounts.
+type numberCandidate struct {
+	serverInfo models.Server
+	serverData models.ServerData
+	price      float64
+	discount   float64
+}
+
+// rankNumberCandidates lists the servers offering the service in the country
+// from the operator, if any, that the user can afford and that stay within
+// maxPrice (0 means no cap), cheapest first.
+// The preferred server, if any, is tried first regardless of price order.
+// lowBalance reports that some server was left out only for the balance.
+func rankNumberCandidates(ctx context.Context, db *mongo.Database, userId string, balance, maxPrice float64, serviceList models.ServerList, country, operator string, preferred int) (candidates []numberCandidate, lowBalance bool) {
+	serverCollection := models.InitializeServerCollection(db)
+	for _, serverData := range serviceList.Servers {
+		if serverData.Block || !inCountry(serverData, country) {
+			continue
+		}
+		serverData, ok := withOperator(serverData, operator)
+		if !ok {
+			continue
+		}
+		var serverInfo models.Server
+		err := serverCollection.FindOne(ctx, bson.M{"server": serverData.Server}).Decode(&serverInfo)
+		if err != nil {
+			logs.Logger.Errorf("server %d not found: %v", serverData.Server, err)
+			continue
+		}
+		if serverInfo.Maintenance || serverInfo.Block {
+			continue
+		}
+		if !provider.Available(serverData.Server) {
+			continue
+		}
+
+		price, err := strconv.ParseFloat(serverData.Price, 64)
+		if err != nil {
+			continue
+		}
+		discount, err := FetchDiscount(ctx, db, userId, serviceList.Name, serverData.Server, country)
+		if err != nil {
+			logs.Logger.Error(err)
+		}
+		price += discount
+		if maxPrice > 0 && price > maxPrice {
+			continue
+		}
+		if balance < price {
+			lowBalance = true
+			continue
+		}
+		candidates = append(candidates, numberCandidate{
+			serverInfo: serverInfo,
+			serverData: serverData,
+			price:      price,
+			discount:   discount,
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if (candidates[i].serverData.Server == preferred) != (candidates[j].serverData.Server == preferred) {
+			return candidates[i].serverData.Server == preferred
+		}
+		if candidates[i].price != candidates[j].price {
+			return candidates[i].price < candidates[j].price
+		}
+		return candidates[i].serverData.Server < candidates[j].serverData.Server
+	})
+	return candidates, lowBalance && len(candidates) == 0
+}
+
+// buyFromCandidates buys a number from the first candidate that has one,
+// returning it with the candidate it came from. It fails with the last
+// candidate's error, or ErrNoNumbers when there are none.
+func buyFromCandidates(ctx context.Context, candidates []numberCandidate, serviceName, operator string, multiple bool) (NumberData, numberCandidate, error) {
+	var err error = provider.ErrNoNumbers
+	for _, candidate := range candidates {
+		var numData NumberData
+		numData, err = ExtractNumber(ctx, candidate.serverInfo, candidate.serverData, operator, multiple)
+		if err == nil {
+			return numData, candidate, nil
+		}
+		logs.Logger.Infof("server %d failed for %s: %v", candidate.serverData.Server, serviceName, err)
+	}
+	return NumberData{}, numberCandidate{}, err
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
+	"github.com/ranjankuldeep/fakeNumber/internal/simulator"
+)
+
+func TestBuyFromCandidatesFailsOver(t *testing.T) {
+	sim := simulator.New(simulator.DefaultScenario())
+	empty := simulator.DefaultScenario()
+	empty.NoStock = true
+	sim.SetServiceScenario("empty", empty)
+	server := httptest.NewServer(sim)
+	defer server.Close()
+	provider.Redirect(server.URL)
+
+	candidate := func(server int, code string) numberCandidate {
+		return numberCandidate{
+			serverInfo: models.Server{ServerNumber: server},
+			serverData: models.ServerData{Server: server, Code: code},
+		}
+	}
+	ctx := context.Background()
+
+	numData, chosen, err := buyFromCandidates(ctx, []numberCandidate{candidate(1, "empty"), candidate(2, "tg")}, "telegram", "", false)
+	if err != nil {
+		t.Fatalf("buy: %v", err)
+	}
+	if chosen.serverData.Server != 2 || numData.Id == "" {
+		t.Fatalf("bought %+v from server %d, want a number from server 2", numData, chosen.serverData.Server)
+	}
+
+	_, _, err = buyFromCandidates(ctx, []numberCandidate{candidate(1, "empty"), candidate(2, "empty")}, "telegram", "", false)
+	if !errors.Is(err, provider.ErrNoNumbers) {
+		t.Fatalf("got %v with no stock anywhere, want ErrNoNumbers", err)
+	}
+	_, _, err = buyFromCandidates(ctx, nil, "telegram", "", false)
+	if !errors.Is(err, provider.ErrNoNumbers) {
+		t.Fatalf("got %v with no candidates, want ErrNoNumbers", err)
+	}
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultFXSource publishes the rates of every currency against the rupee.
+const defaultFXSource = "https://open.er-api.com/v6/latest/INR"
+
+// fxSource is the URL rates are fetched from, FX_RATES_URL when set. It must
+// answer with rates against a base currency, as open.er-api.com and
+// exchangerate.host do: {"base": "INR", "rates": {"RUB": 1.07, ...}}.
+func fxSource() string {
+	if source := os.Getenv("FX_RATES_URL"); source != "" {
+		return source
+	}
+	return defaultFXSource
+}
+
+// fxThreshold is how far, in percent, a rate has to move from a server's
+// exchange rate before the server is repriced. FX_REPRICE_THRESHOLD
+// overrides the default of 1%.
+func fxThreshold() float64 {
+	if value := os.Getenv("FX_REPRICE_THRESHOLD"); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err == nil && threshold >= 0 {
+			return threshold
+		}
+		logs.Logger.Warnf("invalid FX_REPRICE_THRESHOLD %q, using 1%%", value)
+	}
+	return 1
+}
+
+// fetchRates returns the rupees one unit of each currency of the source is
+// worth.
+func fetchRates(ctx context.Context, source string) (map[string]float64, error) {
+	body, status, err := httpclient.Get(ctx, source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange rates: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("exchange rate source returned status %d", status)
+	}
+	var response struct {
+		Base     string             `json:"base"`
+		BaseCode string             `json:"base_code"`
+		Rates    map[string]float64 `json:"rates"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode exchange rates: %w", err)
+	}
+	base := response.Base
+	if base == "" {
+		base = response.BaseCode
+	}
+	if base != "" && response.Rates[base] == 0 {
+		response.Rates[base] = 1
+	}
+	inr := response.Rates[provider.CurrencyINR]
+	if inr <= 0 {
+		return nil, errors.New("exchange rate source has no INR rate")
+	}
+	rates := make(map[string]float64, len(response.Rates))
+	for currency, rate := range response.Rates {
+		if rate > 0 {
+			rates[currency] = inr / rate
+		}
+	}
+	return rates, nil
+}
+
+// RateUpdate is what the rate updater did with one server. Skipped says why
+// the server kept its exchange rate.
+type RateUpdate struct {
+	Server   int     `json:"server"`
+	Currency string  `json:"currency,omitempty"`
+	OldRate  float64 `json:"oldRate"`
+	Rate     float64 `json:"rate,omitempty"`
+	Repriced int     `json:"repriced,omitempty"`
+	Skipped  string  `json:"skipped,omitempty"`
+}
+
+// UpdateExchangeRates fetches the rates of the currencies our servers bill
+// in, stores them in the rate history and moves the exchange rate of every
+// server without a manual override whose rate moved by fxThreshold or more,
+// repricing its catalog entries.
+func UpdateExchangeRates(ctx context.Context, db *mongo.Database) ([]RateUpdate, error) {
+	serverCollection := models.InitializeServerCollection(db)
+	cursor, err := serverCollection.Find(ctx, bson.M{"server": bson.M{"$ne": 0}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load servers: %w", err)
+	}
+	var servers []models.Server
+	if err := cursor.All(ctx, &servers); err != nil {
+		return nil, fmt.Errorf("failed to decode servers: %w", err)
+	}
+
+	source := fxSource()
+	rates, err := fetchRates(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	stored := make(map[string]bool)
+	var history []interface{}
+	for _, serverInfo := range servers {
+		currency := provider.CurrencyFor(serverInfo)
+		if rate, ok := rates[currency]; ok && !stored[currency] {
+			stored[currency] = true
+			history = append(history, models.ExchangeRate{Currency: currency, Rate: rate, Source: source, FetchedAt: now})
+		}
+	}
+	if len(history) > 0 {
+		if _, err := models.InitializeExchangeRateCollection(db).InsertMany(ctx, history); err != nil {
+			logs.Logger.Errorf("failed to store exchange rates: %v", err)
+		}
+	}
+
+	threshold := fxThreshold()
+	updates := make([]RateUpdate, 0, len(servers))
+	for _, serverInfo := range servers {
+		update := RateUpdate{
+			Server:   serverInfo.ServerNumber,
+			Currency: provider.CurrencyFor(serverInfo),
+			OldRate:  serverInfo.ExchangeRate,
+		}
+		rate, ok := rates[update.Currency]
+		switch {
+		case manualExchangeRate(serverInfo):
+			update.Skipped = "manual"
+		case update.Currency == "":
+			update.Skipped = "unknown currency"
+		case !ok:
+			update.Skipped = "no rate"
+		}
+		if update.Skipped != "" {
+			updates = append(updates, update)
+			continue
+		}
+		update.Rate = round(rate, 4)
+		old := serverInfo.ExchangeRate
+		if old > 0 && math.Abs(update.Rate-old)/old*100 < threshold {
+			update.Skipped = "within threshold"
+			updates = append(updates, update)
+			continue
+		}
+
+		_, err := serverCollection.UpdateOne(ctx, bson.M{"_id": serverInfo.ID}, bson.M{
+			"$set": bson.M{"exchangeRate": update.Rate, "exchangeRateUpdatedAt": now},
+		})
+		if err != nil {
+			return updates, fmt.Errorf("failed to update exchange rate of server %d: %w", serverInfo.ServerNumber, err)
+		}
+		update.Repriced, err = RepriceServer(ctx, db, serverInfo.ServerNumber, old, serverInfo.Margin, update.Rate, serverInfo.Margin)
+		if err != nil {
+			return updates, err
+		}
+		logs.Logger.Infof("exchange rate of server %d moved from %.4f to %.4f %s, %d entries repriced", serverInfo.ServerNumber, old, update.Rate, update.Currency, update.Repriced)
+		updates = append(updates, update)
+	}
+	return updates, nil
+}
+
+// manualExchangeRate reports whether the rate updater must leave a server's
+// exchange rate alone: an admin set it manually, or it was entered before
+// the updater existed and no admin has opted the server in since. A server
+// with no rate at all is always kept up to date.
+func manualExchangeRate(serverInfo models.Server) bool {
+	if serverInfo.ExchangeRateManual != nil {
+		return *serverInfo.ExchangeRateManual
+	}
+	return serverInfo.ExchangeRate > 0
+}
+
+// RepriceServer recomputes the catalog prices of a server with the pricing
+// engine for a new exchange rate and margin, from the provider costs stored
+// by the last catalog sync. Entries synced before costs were stored get
+// theirs back from the old rate and margin. It returns the entries repriced.
+func RepriceServer(ctx context.Context, db *mongo.Database, server int, oldRate, oldMargin, rate, margin float64) (int, error) {
+	engine, err := LoadPricingEngine(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	serverListCollection := models.InitializeServerListCollection(db)
+	cursor, err := serverListCollection.Find(ctx, bson.M{"servers.server": server})
+	if err != nil {
+		return 0, fmt.Errorf("failed to load service list: %w", err)
+	}
+	var serviceLists []models.ServerList
+	if err := cursor.All(ctx, &serviceLists); err != nil {
+		return 0, fmt.Errorf("failed to decode service list: %w", err)
+	}
+
+	reprice := func(item PriceItem, price string, cost float64) string {
+		cost, ok := priceCost(price, cost, oldRate, oldMargin)
+		if !ok {
+			return price
+		}
+		return engine.SellPrice(item, cost, rate, margin)
+	}
+
+	repriced := 0
+	var writes []mongo.WriteModel
+	for _, service := range serviceLists {
+		for i, entry := range service.Servers {
+			if entry.Server != server {
+				continue
+			}
+			item := PriceItem{Server: server, Service: service.Name, Country: entry.Country}
+			for duration, price := range entry.Rent {
+				entry.Rent[duration] = reprice(item, price, entry.RentCost[duration])
+			}
+			for j, operator := range entry.Operators {
+				if operator.Price != "" {
+					item.Stock = operator.Stock
+					entry.Operators[j].Price = reprice(item, operator.Price, operator.Cost)
+				}
+			}
+			item.Stock = entry.Stock
+			entry.Price = reprice(item, entry.Price, entry.Cost)
+			service.Servers[i] = entry
+			repriced++
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": service.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"servers": service.Servers, "updatedAt": time.Now()}}))
+	}
+	if len(writes) == 0 {
+		return 0, nil
+	}
+	if _, err := serverListCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		return 0, fmt.Errorf("failed to reprice server %d: %w", server, err)
+	}
+	return repriced, nil
+}
+
+// GetExchangeRates lists the currency and exchange rate of every server and
+// the rates fetched over the last days (default 7), optionally for one
+// currency.
+func GetExchangeRates(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	ctx := context.TODO()
+
+	days := 7
+	if value := c.QueryParam("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Days must be a positive number"})
+		}
+		days = parsed
+	}
+
+	cursor, err := models.InitializeServerCollection(db).Find(ctx, bson.M{"server": bson.M{"$ne": 0}}, options.Find().SetSort(bson.M{"server": 1}))
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch servers"})
+	}
+	var servers []models.Server
+	if err := cursor.All(ctx, &servers); err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to decode servers"})
+	}
+	serverRates := make([]echo.Map, 0, len(servers))
+	for _, serverInfo := range servers {
+		serverRates = append(serverRates, echo.Map{
+			"server":                serverInfo.ServerNumber,
+			"currency":              provider.CurrencyFor(serverInfo),
+			"exchangeRate":          serverInfo.ExchangeRate,
+			"exchangeRateManual":    manualExchangeRate(serverInfo),
+			"exchangeRateUpdatedAt": serverInfo.ExchangeRateUpdatedAt,
+		})
+	}
+
+	filter := bson.M{"fetchedAt": bson.M{"$gte": time.Now().AddDate(0, 0, -days)}}
+	if currency := c.QueryParam("currency"); currency != "" {
+		filter["currency"] = currency
+	}
+	cursor, err = models.InitializeExchangeRateCollection(db).Find(ctx, filter, options.Find().SetSort(bson.M{"fetchedAt": -1}).SetLimit(1000))
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch exchange rates"})
+	}
+	history := []models.ExchangeRate{}
+	if err := cursor.All(ctx, &history); err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to decode exchange rates"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"servers": serverRates, "history": history})
+}
+
+// RefreshExchangeRates runs the rate updater now.
+func RefreshExchangeRates(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	updates, err := UpdateExchangeRates(c.Request().Context(), db)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "Failed to update exchange rates: " + err.Error()})
+	}
+	return c.JSON(http.StatusOK, updates)
+}
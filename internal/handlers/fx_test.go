@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+)
+
+func TestManualExchangeRate(t *testing.T) {
+	manual, auto := true, false
+	tests := []struct {
+		name   string
+		server models.Server
+		want   bool
+	}{
+		{"rate entered before the updater", models.Server{ExchangeRate: 1.05}, true},
+		{"no rate yet", models.Server{}, false},
+		{"set manually", models.Server{ExchangeRate: 1.05, ExchangeRateManual: &manual}, true},
+		{"opted in", models.Server{ExchangeRate: 1.05, ExchangeRateManual: &auto}, false},
+	}
+	for _, tt := range tests {
+		if got := manualExchangeRate(tt.server); got != tt.want {
+			t.Errorf("%s: manualExchangeRate = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
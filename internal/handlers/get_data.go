@@ -2,10 +2,7 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"sort"
@@ -14,6 +11,7 @@ import (
 	"time"
 
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 
 	"github.com/labstack/echo/v4"
@@ -22,20 +20,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-type BalanceRequest struct {
-	Url     string
-	Headers map[string]string
-}
-
-type ServerCred struct {
-	Token  string
-	ApiKey string
-}
-
-type Balance struct {
-	Value  float64
-	Symbol string
-}
+type Balance = provider.Balance
 
 func GetServersData(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
@@ -89,25 +74,31 @@ type ServiceResponseAdmin struct {
 }
 
 type ServerDetail struct {
-	Server string `json:"serverNumber"`
-	Price  string `json:"price"`
-	Code   string `json:"code"`
-	Otp    string `json:"otptype"`
+	Server    string           `json:"serverNumber"`
+	Price     string           `json:"price"`
+	Code      string           `json:"code"`
+	Otp       string           `json:"otptype"`
+	Operators []OperatorDetail `json:"operators,omitempty"`
 }
 
 type ServerDetailAdmin struct {
-	Server string `json:"serverNumber"`
-	Price  string `json:"price"`
-	Code   string `json:"code"`
-	Otp    string `json:"otp"`
-	Block  bool   `json:"block"`
+	Server    string                 `json:"serverNumber"`
+	Country   string                 `json:"country"`
+	Price     string                 `json:"price"`
+	Code      string                 `json:"code"`
+	Otp       string                 `json:"otp"`
+	Block     bool                   `json:"block"`
+	Stock     *int                   `json:"stock,omitempty"`
+	Operators []models.OperatorPrice `json:"operators,omitempty"`
 }
 
 type ServerUserDetail struct {
-	Server string `json:"server"`
-	Price  string `json:"price"`
-	Code   string `json:"code"`
-	Otp    string `json:"otp"`
+	Server    string           `json:"server"`
+	Price     string           `json:"price"`
+	Code      string           `json:"code"`
+	Otp       string           `json:"otp"`
+	Stock     *int             `json:"stock,omitempty"`
+	Operators []OperatorDetail `json:"operators,omitempty"`
 }
 
 type ServiceUserResponse struct {
@@ -117,6 +108,7 @@ type ServiceUserResponse struct {
 
 func GetServiceData(c echo.Context) error {
 	userId := c.QueryParam("userId")
+	country := provider.NormalizeCountry(c.QueryParam("country"))
 	db := c.Get("db").(*mongo.Database)
 	serverCollection := models.InitializeServerCollection(db)
 	serviceCollection := models.InitializeServerListCollection(db)
@@ -148,6 +140,8 @@ func GetServiceData(c echo.Context) error {
 			maintenanceServerNumbers = append(maintenanceServerNumbers, server.ServerNumber)
 		}
 	}
+	// Servers whose circuit breaker is open are hidden like maintenance ones.
+	maintenanceServerNumbers = append(maintenanceServerNumbers, provider.Tripped()...)
 	cursor, err := serviceCollection.Find(context.Background(), bson.D{})
 	if err != nil {
 		logs.Logger.Error(err)
@@ -189,15 +183,20 @@ func GetServiceData(c echo.Context) error {
 			if contains(maintenanceServerNumbers, server.Server) {
 				continue
 			}
-			discount := CalculateDiscount(serviceDiscounts, serverDiscounts, userDiscounts, service.Name, server.Server, userId)
+			if outOfStock(server) || !inCountry(server, country) {
+				continue
+			}
+			discount := CalculateDiscount(serviceDiscounts, serverDiscounts, userDiscounts, service.Name, server.Server, country, userId)
 			price, _ := strconv.ParseFloat(server.Price, 64)
 			adjustedPrice := strconv.FormatFloat(price+discount, 'f', 2, 64)
 
 			serverDetails = append(serverDetails, ServerUserDetail{
-				Server: strconv.Itoa(server.Server),
-				Price:  adjustedPrice,
-				Code:   server.Code,
-				Otp:    server.Otp,
+				Server:    strconv.Itoa(server.Server),
+				Price:     adjustedPrice,
+				Code:      server.Code,
+				Otp:       server.Otp,
+				Stock:     server.Stock,
+				Operators: operatorDetails(server, discount),
 			})
 		}
 
@@ -225,6 +224,7 @@ func GetServiceData(c echo.Context) error {
 
 func GetUserServiceData(c echo.Context) error {
 	apiKey := c.QueryParam("apikey")
+	country := provider.NormalizeCountry(c.QueryParam("country"))
 	if apiKey == "" {
 		return c.JSON(http.StatusForbidden, echo.Map{"error": "empty api key"})
 	}
@@ -268,6 +268,8 @@ func GetUserServiceData(c echo.Context) error {
 			maintenanceServerNumbers = append(maintenanceServerNumbers, server.ServerNumber)
 		}
 	}
+	// Servers whose circuit breaker is open are hidden like maintenance ones.
+	maintenanceServerNumbers = append(maintenanceServerNumbers, provider.Tripped()...)
 	cursor, err := serviceCollection.Find(context.Background(), bson.D{})
 	if err != nil {
 		logs.Logger.Error(err)
@@ -308,8 +310,11 @@ func GetUserServiceData(c echo.Context) error {
 			if contains(maintenanceServerNumbers, server.Server) {
 				continue
 			}
+			if outOfStock(server) || !inCountry(server, country) {
+				continue
+			}
 
-			discount := CalculateDiscount(serviceDiscounts, serverDiscounts, userDiscounts, service.Name, server.Server, apiUser.UserID.Hex())
+			discount := CalculateDiscount(serviceDiscounts, serverDiscounts, userDiscounts, service.Name, server.Server, country, apiUser.UserID.Hex())
 			price, _ := strconv.ParseFloat(server.Price, 64)
 			adjustedPrice := strconv.FormatFloat(price+discount, 'f', 2, 64)
 			otpType := "unknown"
@@ -319,10 +324,11 @@ func GetUserServiceData(c echo.Context) error {
 				otpType = "multiple"
 			}
 			serverDetails = append(serverDetails, ServerDetail{
-				Server: strconv.Itoa(server.Server),
-				Price:  adjustedPrice,
-				Code:   server.Code,
-				Otp:    otpType,
+				Server:    strconv.Itoa(server.Server),
+				Price:     adjustedPrice,
+				Code:      server.Code,
+				Otp:       otpType,
+				Operators: operatorDetails(server, discount),
 			})
 		}
 		sort.Slice(serverDetails, func(i, j int) bool {
@@ -344,6 +350,7 @@ func GetUserServiceData(c echo.Context) error {
 type Discount struct {
 	Service  string  `bson:"service" json:"service"`
 	Server   int     `bson:"server" json:"server"`
+	Country  string  `bson:"country" json:"country"`
 	Discount float64 `bson:"discount" json:"discount"`
 }
 
@@ -391,8 +398,7 @@ func GetServiceDataAdmin(c echo.Context) error {
 
 	serviceDiscountMap := make(map[string]float64)
 	for _, discount := range serviceDiscountData {
-		key := discount.Service + "_" + strconv.Itoa(discount.Server)
-		serviceDiscountMap[key] = discount.Discount
+		serviceDiscountMap[discountKey(discount.Service, discount.Server, discount.Country)] = discount.Discount
 	}
 
 	serverDiscountMap := make(map[int]float64)
@@ -412,7 +418,7 @@ func GetServiceDataAdmin(c echo.Context) error {
 		seenServices[service.Name] = true
 		serverDetails := []ServerDetailAdmin{}
 		for _, server := range service.Servers {
-			serviceKey := service.Name + "_" + strconv.Itoa(server.Server)
+			serviceKey := discountKey(service.Name, server.Server, server.Country)
 			discount := serviceDiscountMap[serviceKey] + serverDiscountMap[server.Server]
 			originalPrice, err := strconv.ParseFloat(server.Price, 64)
 			if err != nil {
@@ -421,11 +427,14 @@ func GetServiceDataAdmin(c echo.Context) error {
 			}
 			finalPrice := originalPrice + discount
 			serverDetails = append(serverDetails, ServerDetailAdmin{
-				Server: strconv.Itoa(server.Server),
-				Price:  strconv.FormatFloat(finalPrice, 'f', 2, 64),
-				Code:   server.Code,
-				Otp:    server.Otp,
-				Block:  server.Block,
+				Server:    strconv.Itoa(server.Server),
+				Country:   provider.NormalizeCountry(server.Country),
+				Price:     strconv.FormatFloat(finalPrice, 'f', 2, 64),
+				Code:      server.Code,
+				Otp:       server.Otp,
+				Block:     server.Block,
+				Stock:     server.Stock,
+				Operators: server.Operators,
 			})
 		}
 		sort.Slice(serverDetails, func(i, j int) bool {
@@ -461,8 +470,7 @@ func loadDiscounts(serviceDiscountCollection, serverDiscountCollection, userDisc
 	for serviceCursor.Next(context.Background()) {
 		var discount models.ServiceDiscount
 		if err := serviceCursor.Decode(&discount); err == nil {
-			key := discount.Service + "_" + strconv.Itoa(discount.Server)
-			serviceDiscounts[key] = discount.Discount
+			serviceDiscounts[discountKey(discount.Service, discount.Server, discount.Country)] = discount.Discount
 		}
 	}
 
@@ -494,9 +502,9 @@ func loadDiscounts(serviceDiscountCollection, serverDiscountCollection, userDisc
 	return serviceDiscounts, serverDiscounts, userDiscounts, nil
 }
 
-func CalculateDiscount(serviceDiscounts map[string]float64, serverDiscounts map[int]float64, userDiscounts map[string]float64, serviceName string, serverNumber int, userId string) float64 {
+func CalculateDiscount(serviceDiscounts map[string]float64, serverDiscounts map[int]float64, userDiscounts map[string]float64, serviceName string, serverNumber int, country, userId string) float64 {
 	key := serviceName + "_" + strconv.Itoa(serverNumber)
-	return serviceDiscounts[key] + serverDiscounts[serverNumber] + userDiscounts[key]
+	return serviceDiscounts[discountKey(serviceName, serverNumber, country)] + serverDiscounts[serverNumber] + userDiscounts[key]
 }
 
 func TotalRecharge(c echo.Context) error {
@@ -543,7 +551,7 @@ func GetServerBalanceHandler(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 	server := c.QueryParam("server")
 
-	balance, err := GetServerBalance(db, server)
+	balance, err := GetServerBalance(c.Request().Context(), db, server)
 	if err != nil {
 		logs.Logger.Error(err)
 		return c.JSON(http.StatusInternalServerError, echo.Map{"message": "Error fetching server balance"})
@@ -551,7 +559,7 @@ func GetServerBalanceHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, echo.Map{"balance": fmt.Sprintf("%0.2f%s", balance.Value, balance.Symbol)})
 }
 
-func GetServerBalance(db *mongo.Database, server string) (Balance, error) {
+func GetServerBalance(ctx context.Context, db *mongo.Database, server string) (Balance, error) {
 	serverNumber, _ := strconv.Atoi(server)
 	var serverInfo models.Server
 	serverCollection := models.InitializeServerCollection(db)
@@ -561,172 +569,15 @@ func GetServerBalance(db *mongo.Database, server string) (Balance, error) {
 		return Balance{}, err
 	}
 
-	cred := ServerCred{
-		Token:  serverInfo.Token,
-		ApiKey: serverInfo.APIKey,
-	}
-
-	balanceFetchUrl, err := ConstructBalanceUrl(server, cred)
-	if err != nil {
-		logs.Logger.Error(err)
-		return Balance{}, err
-	}
-	balance, err := FetchBalance(server, balanceFetchUrl.Url, balanceFetchUrl.Headers)
+	prov, err := provider.ForServer(serverInfo)
 	if err != nil {
 		return Balance{}, err
 	}
-	return balance, nil
-}
-
-func ConstructBalanceUrl(server string, serverCred ServerCred) (BalanceRequest, error) {
-	switch server {
-	case "1":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://fastsms.su/stubs/handler_api.php?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "2":
-		return BalanceRequest{
-			Url: fmt.Sprintf("https://5sim.net/v1/user/profile"),
-			Headers: map[string]string{
-				"Authorization": fmt.Sprintf("Bearer %s", serverCred.Token),
-				"Accept":        "application/json",
-			},
-		}, nil
-	case "3":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://smshub.org/stubs/handler_api.php?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "4":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://api.tiger-sms.com/stubs/handler_api.php?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "5":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://api.grizzlysms.com/stubs/handler_api.php?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "6":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://tempnum.org/stubs/handler_api.php?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "7":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://smsbower.online/stubs/handler_api.php?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "8":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://api.sms-activate.guru/stubs/handler_api.php?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "10":
-		logs.Logger.Info(serverCred.ApiKey)
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://sms-activation-service.pro/stubs/handler_api?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "9":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://php.paidsms.in/ccpay.php?type=balance"),
-			Headers: map[string]string{},
-		}, nil
-	case "11":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://api.sms-man.com/control/get-balance?token=%s", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	}
-	return BalanceRequest{}, nil
+	return prov.Balance(ctx, serverCredentials(serverInfo))
 }
 
-func FetchBalance(server string, apiURL string, headers map[string]string) (Balance, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return Balance{}, fmt.Errorf("failed to create balance request: %w", err)
-	}
-	for key, value := range headers {
-		req.Header.Set(key, value)
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return Balance{}, fmt.Errorf("failed to fetch API: %w", err)
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return Balance{}, fmt.Errorf("failed to read response body: %w", err)
-	}
-	responseData := string(body)
-	if strings.TrimSpace(responseData) == "" {
-		return Balance{}, errors.New("RECEIVED_EMPTY_RESPONSE_FROM_THIRD_PARTY_SERVER")
-	}
-
-	switch server {
-	case "1":
-		balance := strings.TrimPrefix(responseData, "ACCESS_BALANCE:")
-		value, err := strconv.ParseFloat(balance, 64)
-		if err != nil {
-			return Balance{}, fmt.Errorf("failed to parse balance: %w", err)
-		}
-		return Balance{Value: value, Symbol: "p"}, nil
-
-	case "2":
-		var responseDataJSON struct {
-			Balance float64 `json:"balance"`
-		}
-		err = json.Unmarshal(body, &responseDataJSON)
-		if err != nil {
-			return Balance{}, fmt.Errorf("failed to parse JSON response for balance: %w", err)
-		}
-		return Balance{Value: responseDataJSON.Balance, Symbol: "p"}, nil
-
-	case "3":
-		balance := strings.TrimPrefix(responseData, "ACCESS_BALANCE:")
-		value, err := strconv.ParseFloat(balance, 64)
-		if err != nil {
-			return Balance{}, fmt.Errorf("failed to parse balance: %w", err)
-		}
-		return Balance{Value: value, Symbol: "$"}, nil
-
-	case "4", "5", "6", "7", "8":
-		balance := strings.TrimPrefix(responseData, "ACCESS_BALANCE:")
-		value, err := strconv.ParseFloat(balance, 64)
-		if err != nil {
-			return Balance{}, fmt.Errorf("failed to parse balance: %w", err)
-		}
-		return Balance{Value: value, Symbol: "p"}, nil
-
-	case "9":
-		value, err := strconv.ParseFloat(responseData, 64)
-		if err != nil {
-			return Balance{}, fmt.Errorf("failed to parse balance: %w", err)
-		}
-		return Balance{Value: value, Symbol: "p"}, nil
-
-	case "10":
-		value, err := strconv.ParseFloat(responseData, 64)
-		if err != nil {
-			return Balance{}, fmt.Errorf("failed to parse balance: %w", err)
-		}
-		return Balance{Value: value, Symbol: "$"}, nil
-
-	case "11":
-		var responseDataJSON struct {
-			Balance string `json:"balance"`
-		}
-		err = json.Unmarshal(body, &responseDataJSON)
-		if err != nil {
-			return Balance{}, fmt.Errorf("failed to parse JSON response: %w", err)
-		}
-		floatValue, _ := strconv.ParseFloat(responseDataJSON.Balance, 64)
-		return Balance{Value: floatValue, Symbol: "p"}, nil
-
-	default:
-		return Balance{}, errors.New("INVALID_SERVER_VALUE")
-	}
+// outOfStock reports whether the last catalog sync saw no stock for the
+// entry. Entries without a stock count are always listed.
+func outOfStock(server models.ServerData) bool {
+	return server.Stock != nil && *server.Stock == 0
 }
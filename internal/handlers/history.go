@@ -187,6 +187,13 @@ func SaveRechargeHistory(c echo.Context) error {
 		log.Println("[ERROR] Failed to save recharge history:", err)
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to save recharge"})
 	}
+	if request.Status == "Received" {
+		queueWebhooks(ctx, db, userObjectID, models.WebhookRechargeCredited, echo.Map{
+			"transactionId": request.TransactionID,
+			"amount":        rechargeHistory.Amount,
+			"paymentType":   request.PaymentType,
+		})
+	}
 	return c.JSON(http.StatusOK, echo.Map{"message": "Recharge Saved Successfully!"})
 }
 
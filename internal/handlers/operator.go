@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+)
+
+// normalizeOperator lower-cases an operator name. "any" means no preference.
+func normalizeOperator(operator string) string {
+	operator = strings.ToLower(strings.TrimSpace(operator))
+	if operator == "any" {
+		return ""
+	}
+	return operator
+}
+
+// withOperator prices a catalog entry for the operator. It reports false when
+// the entry lists its operators and the operator is not one of them or is out
+// of stock. Entries without an operator list leave the choice to the provider.
+func withOperator(serverData models.ServerData, operator string) (models.ServerData, bool) {
+	if operator == "" || len(serverData.Operators) == 0 {
+		return serverData, true
+	}
+	for _, op := range serverData.Operators {
+		if normalizeOperator(op.Name) != operator {
+			continue
+		}
+		if op.Stock != nil && *op.Stock == 0 {
+			return serverData, false
+		}
+		if op.Price != "" {
+			serverData.Price = op.Price
+			serverData.Cost = op.Cost
+		}
+		return serverData, true
+	}
+	return serverData, false
+}
+
+// OperatorDetail is an operator in the service listings, priced for the user.
+type OperatorDetail struct {
+	Name  string `json:"name"`
+	Price string `json:"price"`
+	Stock *int   `json:"stock,omitempty"`
+}
+
+// operatorDetails lists the in-stock operators of an entry with the user's
+// discount applied. Operators without their own price cost the entry price.
+func operatorDetails(serverData models.ServerData, discount float64) []OperatorDetail {
+	var details []OperatorDetail
+	for _, op := range serverData.Operators {
+		if op.Stock != nil && *op.Stock == 0 {
+			continue
+		}
+		price := serverData.Price
+		if op.Price != "" {
+			price = op.Price
+		}
+		value, err := strconv.ParseFloat(price, 64)
+		if err != nil {
+			continue
+		}
+		details = append(details, OperatorDetail{
+			Name:  op.Name,
+			Price: strconv.FormatFloat(value+discount, 'f', 2, 64),
+			Stock: op.Stock,
+		})
+	}
+	return details
+}
@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// orderStreamPoll is how often streams look for events published by
+	// other instances.
+	orderStreamPoll = time.Second
+	// orderStreamPing is how long a stream stays silent before a keep-alive.
+	orderStreamPing = 15 * time.Second
+	// orderEventGapWait is how long an event whose predecessor is not
+	// stored yet is held back, after which the predecessor is given up on.
+	orderEventGapWait = 2 * time.Second
+)
+
+// orderEventsWake is closed, and replaced, each time this instance publishes
+// an order event, waking the streams waiting for one.
+var (
+	orderEventsMu   sync.Mutex
+	orderEventsWake = make(chan struct{})
+)
+
+func wakeOrderStreams() {
+	orderEventsMu.Lock()
+	defer orderEventsMu.Unlock()
+	close(orderEventsWake)
+	orderEventsWake = make(chan struct{})
+}
+
+func orderStreamsWake() <-chan struct{} {
+	orderEventsMu.Lock()
+	defer orderEventsMu.Unlock()
+	return orderEventsWake
+}
+
+// publishOrderEvent numbers an event after its customer's last one, stores it
+// and wakes the streams of this instance; those of other instances find it on
+// their next poll. A failure is only logged, so an event never fails the
+// change it reports.
+func publishOrderEvent(ctx context.Context, db *mongo.Database, event models.OrderEvent) {
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := models.InitializeOrderEventCounterCollection(db).FindOneAndUpdate(ctx,
+		bson.M{"_id": event.UserID},
+		bson.M{"$inc": bson.M{"seq": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		logs.Logger.Errorf("failed to number %s event of order %s: %v", event.Type, event.NumberID, err)
+		return
+	}
+	event.Seq = counter.Seq
+	event.CreatedAt = time.Now()
+	if _, err := models.InitializeOrderEventCollection(db).InsertOne(ctx, event); err != nil {
+		logs.Logger.Errorf("failed to store %s event of order %s: %v", event.Type, event.NumberID, err)
+		return
+	}
+	wakeOrderStreams()
+}
+
+// publishStateEvent publishes the move of an order to a state, and sends the
+// customer's webhooks the event of the state, if it has one.
+func publishStateEvent(ctx context.Context, db *mongo.Database, order models.Order, state string) {
+	publishOrderEvent(ctx, db, models.OrderEvent{
+		UserID:   order.UserID,
+		Type:     models.OrderEventState,
+		NumberID: order.NumberID,
+		Server:   order.Server,
+		State:    state,
+	})
+	if event, ok := webhookEventOfState[state]; ok {
+		data := orderWebhookData(order)
+		if state == models.StateRefunded {
+			data["amount"] = fmt.Sprintf("%.2f", round(order.Price, 2))
+		}
+		queueWebhooks(ctx, db, order.UserID, event, data)
+	}
+}
+
+// orderEventStream reads the events of a customer, or of one of their orders
+// when numberID is set, after the last one read.
+type orderEventStream struct {
+	db       *mongo.Database
+	userID   primitive.ObjectID
+	numberID string
+	server   int
+	last     int64
+}
+
+// newOrderEventStream opens the stream a request asks for. The customer is
+// authenticated by API key, the apikey parameter, or by login token, the
+// token parameter or a bearer Authorization header. id and server narrow the
+// stream to one order. Streams resume after the Last-Event-ID header or
+// lastEventId parameter; without one, an order's stream starts with its first
+// event and a customer's with the next.
+func newOrderEventStream(c echo.Context) (*orderEventStream, int, error) {
+	db := c.Get("db").(*mongo.Database)
+	ctx := c.Request().Context()
+
+	userID, err := orderStreamUser(c, db)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+	var user models.User
+	if err := models.InitializeUserCollection(db).FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return nil, http.StatusUnauthorized, errors.New("user not found")
+	}
+	if user.Blocked {
+		return nil, http.StatusForbidden, errors.New("your account is blocked, contact the admin")
+	}
+	stream := &orderEventStream{db: db, userID: userID, last: -1}
+
+	if id := c.QueryParam("id"); id != "" {
+		server, err := strconv.Atoi(c.QueryParam("server"))
+		if err != nil {
+			return nil, http.StatusBadRequest, errors.New("invalid server number")
+		}
+		count, err := models.InitializeOrderCollection(db).CountDocuments(ctx, bson.M{"numberId": id, "server": server, "userId": userID})
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.New("internal server error")
+		}
+		if count == 0 {
+			return nil, http.StatusNotFound, errors.New("order not found")
+		}
+		stream.numberID, stream.server = id, server
+	}
+
+	resume := c.Request().Header.Get("Last-Event-ID")
+	if resume == "" {
+		resume = c.QueryParam("lastEventId")
+	}
+	switch {
+	case resume != "":
+		stream.last, err = strconv.ParseInt(resume, 10, 64)
+		if err != nil || stream.last < 0 {
+			return nil, http.StatusBadRequest, errors.New("invalid last event id")
+		}
+	case stream.numberID != "":
+		stream.last = 0
+	default:
+		var counter struct {
+			Seq int64 `bson:"seq"`
+		}
+		err := models.InitializeOrderEventCounterCollection(db).FindOne(ctx, bson.M{"_id": userID}).Decode(&counter)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, http.StatusInternalServerError, errors.New("internal server error")
+		}
+		stream.last = counter.Seq
+	}
+	return stream, http.StatusOK, nil
+}
+
+// orderStreamUser returns the customer authenticated by a stream request.
+func orderStreamUser(c echo.Context, db *mongo.Database) (primitive.ObjectID, error) {
+	if apiKey := c.QueryParam("apikey"); apiKey != "" {
+		var apiWalletUser models.ApiWalletUser
+		err := models.InitializeApiWalletuserCollection(db).FindOne(c.Request().Context(), bson.M{"api_key": apiKey}).Decode(&apiWalletUser)
+		if err != nil {
+			return primitive.NilObjectID, errors.New("invalid api key")
+		}
+		return apiWalletUser.UserID, nil
+	}
+	token := c.QueryParam("token")
+	if token == "" {
+		token = strings.TrimPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+	}
+	if token == "" {
+		return primitive.NilObjectID, errors.New("empty api key or token")
+	}
+	return userFromToken(token)
+}
+
+// userFromToken returns the user a login token was issued to. Password logins
+// sign with JWT_SECRET_KEY and Google logins with jwtSecretKey.
+func userFromToken(tokenString string) (primitive.ObjectID, error) {
+	secrets := [][]byte{jwtSecretKey}
+	if secret := os.Getenv("JWT_SECRET_KEY"); secret != "" {
+		secrets = append([][]byte{[]byte(secret)}, secrets...)
+	}
+	for _, secret := range secrets {
+		claims := jwt.MapClaims{}
+		token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, errors.New("unexpected signing method")
+			}
+			return secret, nil
+		})
+		if err != nil || !token.Valid {
+			continue
+		}
+		userID, _ := claims["userId"].(string)
+		return primitive.ObjectIDFromHex(userID)
+	}
+	return primitive.NilObjectID, errors.New("invalid token")
+}
+
+// next returns the stream's events after the last one read, in order. An
+// event whose predecessor is still being stored is held back for up to
+// orderEventGapWait so events are not delivered out of order.
+func (s *orderEventStream) next(ctx context.Context) ([]models.OrderEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}).SetLimit(100)
+	cursor, err := models.InitializeOrderEventCollection(s.db).Find(ctx, bson.M{"userId": s.userID, "seq": bson.M{"$gt": s.last}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var events []models.OrderEvent
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	var out []models.OrderEvent
+	for _, event := range events {
+		if event.Seq != s.last+1 && time.Since(event.CreatedAt) < orderEventGapWait {
+			break
+		}
+		s.last = event.Seq
+		if s.numberID == "" || (event.NumberID == s.numberID && event.Server == s.server) {
+			out = append(out, event)
+		}
+	}
+	return out, nil
+}
+
+// run sends the stream's events until ctx ends or sending fails, pinging
+// the client when nothing happens for a while.
+func (s *orderEventStream) run(ctx context.Context, send func(models.OrderEvent) error, ping func() error) error {
+	poll := time.NewTicker(orderStreamPoll)
+	defer poll.Stop()
+	keepAlive := time.NewTicker(orderStreamPing)
+	defer keepAlive.Stop()
+	for {
+		wake := orderStreamsWake()
+		events, err := s.next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		for _, event := range events {
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-wake:
+		case <-poll.C:
+		case <-keepAlive.C:
+			if err := ping(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// StreamOrderEvents streams a customer's order events as Server-Sent Events:
+// each new OTP and every state change, with the event's seq as its id.
+func StreamOrderEvents(c echo.Context) error {
+	stream, status, err := newOrderEventStream(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	send := func(event models.OrderEvent) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data); err != nil {
+			return err
+		}
+		w.Flush()
+		return nil
+	}
+	ping := func() error {
+		if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+			return err
+		}
+		w.Flush()
+		return nil
+	}
+	if err := stream.run(c.Request().Context(), send, ping); err != nil {
+		logs.Logger.Debugf("order event stream ended: %v", err)
+	}
+	return nil
+}
+
+// StreamOrderEventsWS streams the same events as StreamOrderEvents over a
+// WebSocket, one JSON message each.
+func StreamOrderEventsWS(c echo.Context) error {
+	stream, status, err := newOrderEventStream(c)
+	if err != nil {
+		return c.JSON(status, map[string]string{"error": err.Error()})
+	}
+
+	server := websocket.Server{
+		// Clients are authenticated by key or token, from any origin.
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				// Clients send nothing; reading only notices them leaving.
+				var message string
+				for websocket.Message.Receive(ws, &message) == nil {
+				}
+				cancel()
+			}()
+
+			send := func(event models.OrderEvent) error {
+				return websocket.JSON.Send(ws, event)
+			}
+			ping := func() error {
+				return websocket.Message.Send(ws, `{"type":"ping"}`)
+			}
+			if err := stream.run(ctx, send, ping); err != nil {
+				logs.Logger.Debugf("order event socket ended: %v", err)
+			}
+		},
+	}
+	server.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Errors of order state transitions.
+var (
+	ErrOrderNotFound     = errors.New("ORDER_NOT_FOUND")
+	ErrInvalidTransition = errors.New("INVALID_ORDER_TRANSITION")
+)
+
+// TransitionOrder moves the order of an activation to a state, records the
+// move on the order and mirrors the state onto the order's transaction
+// history. The move is checked against the state stored at the time of the
+// write, so of two racing moves out of a state only one succeeds; the other
+// gets ErrInvalidTransition. The customer's streams are sent the new state.
+func TransitionOrder(ctx context.Context, db *mongo.Database, server int, numberID, to, reason string) (models.Order, error) {
+	order, err := transitionOrder(ctx, db, server, numberID, to, reason)
+	if err != nil {
+		return order, err
+	}
+	publishStateEvent(ctx, db, order, to)
+	return order, nil
+}
+
+// transitionOrder is TransitionOrder without the event, for moves made
+// inside a database transaction whose events are published once it commits.
+func transitionOrder(ctx context.Context, db *mongo.Database, server int, numberID, to, reason string) (models.Order, error) {
+	orderCollection := models.InitializeOrderCollection(db)
+	filter := bson.M{"numberId": numberID, "server": server}
+	for attempt := 0; attempt < 3; attempt++ {
+		var order models.Order
+		if err := orderCollection.FindOne(ctx, filter).Decode(&order); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return models.Order{}, ErrOrderNotFound
+			}
+			return models.Order{}, err
+		}
+		if !models.CanTransition(order.Status, to) {
+			return order, ErrInvalidTransition
+		}
+
+		var current interface{} = order.Status
+		if order.Status == "" {
+			current = bson.M{"$in": bson.A{"", nil}}
+		}
+		transition := models.OrderTransition{From: order.Status, To: to, Reason: reason, At: time.Now()}
+		result, err := orderCollection.UpdateOne(ctx, bson.M{"_id": order.ID, "status": current}, bson.M{
+			"$set":  bson.M{"status": to},
+			"$push": bson.M{"transitions": transition},
+		})
+		if err != nil {
+			return order, err
+		}
+		if result.ModifiedCount == 0 {
+			// Moved by someone else since it was read.
+			continue
+		}
+
+		_, err = models.InitializeTransactionHistoryCollection(db).UpdateOne(ctx,
+			bson.M{"id": numberID, "server": strconv.Itoa(server)},
+			bson.M{"$set": bson.M{"state": to, "status": models.TransactionStatus(to)}},
+		)
+		if err != nil {
+			return order, err
+		}
+		order.Status = to
+		order.Transitions = append(order.Transitions, transition)
+		return order, nil
+	}
+	return models.Order{}, ErrInvalidTransition
+}
+
+// handedOutTransitions are the transitions of an order whose number was
+// just bought and handed out. Orders are stored WAITING_SMS straight away, in
+// a single write, so none is left behind in CREATED.
+func handedOutTransitions() []models.OrderTransition {
+	now := time.Now()
+	return []models.OrderTransition{
+		{To: models.StateCreated, Reason: "number bought", At: now},
+		{From: models.StateCreated, To: models.StateWaitingSMS, Reason: "number handed out", At: now},
+	}
+}
+
+// finishPath is the states an order in a state goes through to FINISHED once
+// an SMS is known to have arrived, or nil when it ended already. An order
+// still WAITING_SMS missed the move to SMS_RECEIVED, e.g. because storing its
+// SMS failed half way, and makes it first.
+func finishPath(state string) []string {
+	switch state {
+	case models.StateCreated:
+		return []string{models.StateWaitingSMS, models.StateSMSReceived, models.StateFinished}
+	case models.StateWaitingSMS:
+		return []string{models.StateSMSReceived, models.StateFinished}
+	case "", models.StateSMSReceived:
+		return []string{models.StateFinished}
+	}
+	return nil
+}
+
+// FinishOrder ends an order that got an SMS, moving it through the states it
+// skipped on the way to FINISHED. It fails with ErrInvalidTransition when
+// the order ended already, or was moved by someone else meanwhile.
+func FinishOrder(ctx context.Context, db *mongo.Database, order models.Order, reason string) (models.Order, error) {
+	path := finishPath(order.Status)
+	if path == nil {
+		return order, ErrInvalidTransition
+	}
+	for _, state := range path {
+		var err error
+		order, err = TransitionOrder(ctx, db, order.Server, order.NumberID, state, reason)
+		if err != nil {
+			return order, err
+		}
+	}
+	return order, nil
+}
+
+// RefundOrder ends an order that got no SMS: it moves it to via, CANCELLED
+// or EXPIRED, credits its price back to the customer and moves it on to
+// REFUNDED in one database transaction, so however many paths race to end
+// an order, it is refunded once.
+func RefundOrder(ctx context.Context, db *mongo.Database, order models.Order, via, reason string) error {
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if _, err := transitionOrder(sc, db, order.Server, order.NumberID, via, reason); err != nil {
+			return nil, err
+		}
+		result, err := models.InitializeApiWalletuserCollection(db).UpdateOne(sc,
+			bson.M{"userId": order.UserID},
+			bson.M{"$inc": bson.M{"balance": round(order.Price, 2)}},
+		)
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount == 0 {
+			return nil, errors.New("wallet not found")
+		}
+		if _, err := transitionOrder(sc, db, order.Server, order.NumberID, models.StateRefunded, reason); err != nil {
+			return nil, err
+		}
+		_, err = models.InitializeTransactionHistoryCollection(db).UpdateOne(sc,
+			bson.M{"id": order.NumberID, "server": strconv.Itoa(order.Server)},
+			bson.M{"$set": bson.M{"date_time": FormatDateTime()}},
+		)
+		return nil, err
+	})
+	if err != nil {
+		return err
+	}
+	publishStateEvent(ctx, db, order, via)
+	publishStateEvent(ctx, db, order, models.StateRefunded)
+	return nil
+}
+
+// endedCancelled reports whether an order has since been cancelled, by the
+// customer or by its provider, rather than having expired or got an SMS.
+// A customer's cancel that lost the race to such a cancel still succeeded.
+func endedCancelled(ctx context.Context, db *mongo.Database, order models.Order) bool {
+	var current models.Order
+	err := models.InitializeOrderCollection(db).FindOne(ctx, bson.M{"_id": order.ID}).Decode(&current)
+	if err != nil {
+		return false
+	}
+	for _, transition := range current.Transitions {
+		if transition.To == models.StateCancelled {
+			return true
+		}
+	}
+	return false
+}
+
+// GetOrderHistory returns an order with the states it went through, by the
+// activation id and, for ids that several servers used, the server.
+func GetOrderHistory(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	id := c.QueryParam("id")
+	if id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "empty id"})
+	}
+	filter := bson.M{"numberId": id}
+	if server := c.QueryParam("server"); server != "" {
+		serverNumber, err := strconv.Atoi(server)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid server number"})
+		}
+		filter["server"] = serverNumber
+	}
+
+	var order models.Order
+	err := models.InitializeOrderCollection(db).FindOne(context.TODO(), filter).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "order not found"})
+	}
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	transitions := order.Transitions
+	if transitions == nil {
+		transitions = []models.OrderTransition{}
+	}
+	return c.JSON(http.StatusOK, echo.Map{
+		"id":          order.NumberID,
+		"server":      order.Server,
+		"service":     order.Service,
+		"number":      order.Number,
+		"status":      order.Status,
+		"transitions": transitions,
+	})
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+)
+
+// TestFinishPath checks that every active order with an SMS, including one
+// still WAITING_SMS, reaches FINISHED by allowed transitions.
+func TestFinishPath(t *testing.T) {
+	for _, state := range []string{"", models.StateCreated, models.StateWaitingSMS, models.StateSMSReceived} {
+		path := finishPath(state)
+		if len(path) == 0 || path[len(path)-1] != models.StateFinished {
+			t.Fatalf("finishPath(%q) = %v, want a path ending in %s", state, path, models.StateFinished)
+		}
+		from := state
+		for _, to := range path {
+			if !models.CanTransition(from, to) {
+				t.Fatalf("finishPath(%q) moves %s to %s, which is not allowed", state, from, to)
+			}
+			from = to
+		}
+	}
+	if path := finishPath(models.StateWaitingSMS); len(path) != 2 || path[0] != models.StateSMSReceived {
+		t.Fatalf("finishPath(WAITING_SMS) = %v, want it through %s", path, models.StateSMSReceived)
+	}
+	for _, state := range []string{models.StateFinished, models.StateCancelled, models.StateExpired, models.StateRefunded} {
+		if path := finishPath(state); path != nil {
+			t.Fatalf("finishPath(%q) = %v for an ended order, want nil", state, path)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PollOrder fetches the SMS of an active order from its provider and stores
+// the OTPs not seen yet, returning all the provider reported. An order the
+// provider reports cancelled before any SMS arrived is refunded.
+func PollOrder(ctx context.Context, db *mongo.Database, serverInfo models.Server, order models.Order) ([]string, error) {
+	otps, fetchErr := fetchOTP(ctx, serverInfo, order.NumberID)
+	if fetchErr != nil && fetchErr.Error() != "ACCESS_CANCEL" {
+		return nil, fetchErr
+	}
+
+	var transaction models.TransactionHistory
+	err := models.InitializeTransactionHistoryCollection(db).FindOne(ctx, bson.M{
+		"id":     order.NumberID,
+		"server": strconv.Itoa(order.Server),
+	}).Decode(&transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	if fetchErr != nil {
+		if len(transaction.OTP) > 0 {
+			return nil, nil
+		}
+		err := RefundOrder(ctx, db, order, models.StateCancelled, "cancelled by provider")
+		if err != nil && !errors.Is(err, ErrInvalidTransition) {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	for _, otp := range otps {
+		if _, err := storeOtp(ctx, db, transaction, otp, "polled by server"); err != nil {
+			return otps, err
+		}
+	}
+	return otps, nil
+}
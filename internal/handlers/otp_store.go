@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/services"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// storeOtp records an OTP received for a transaction, however it was
+// received. An OTP already on the transaction is ignored and reported as not
+// stored. The OTP is added in a single conditional write, so when the
+// poller, the expiry runner and the customer store the same OTP at once,
+// only one of them goes on. A new one moves the order to SMS_RECEIVED, which
+// marks the transaction SUCCESS, notifies admins, asks the provider for the
+// next SMS on multiple OTP services, becomes the recent OTP returned to the
+// customer and is streamed and sent to their webhooks.
+func storeOtp(ctx context.Context, db *mongo.Database, transaction models.TransactionHistory, otp, ipDetail string) (bool, error) {
+	id := transaction.TransactionID
+	server := transaction.Server
+	transactionCollection := models.InitializeTransactionHistoryCollection(db)
+
+	result, err := transactionCollection.UpdateOne(ctx,
+		bson.M{"id": id, "server": server, "otp": bson.M{"$ne": otp}},
+		bson.M{
+			"$addToSet": bson.M{"otp": otp},
+			"$set":      bson.M{"date_time": FormatDateTime()},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.ModifiedCount != 1 {
+		return false, nil
+	}
+
+	serverNumber, _ := strconv.Atoi(server)
+	_, err = TransitionOrder(ctx, db, serverNumber, id, models.StateSMSReceived, "sms received")
+	switch {
+	case errors.Is(err, ErrOrderNotFound):
+		// Transactions whose order was deleted before orders kept their state.
+		_, err = transactionCollection.UpdateOne(ctx, bson.M{"id": id, "server": server}, bson.M{"$set": bson.M{"status": "SUCCESS"}})
+		if err != nil {
+			logs.Logger.Errorf("failed to mark transaction %s successful: %v", id, err)
+		}
+	case errors.Is(err, ErrInvalidTransition):
+		// A later SMS, or one that arrived after the order ended: record it
+		// and leave the state alone.
+	case err != nil:
+		// The OTP is stored, so it is still handed out; the expiry runner
+		// finishes an order left WAITING_SMS with an OTP.
+		logs.Logger.Errorf("failed to move order %s to %s: %v", id, models.StateSMSReceived, err)
+	}
+
+	if userID, err := primitive.ObjectIDFromHex(transaction.UserID); err == nil {
+		publishOrderEvent(ctx, db, models.OrderEvent{
+			UserID:   userID,
+			Type:     models.OrderEventOTP,
+			NumberID: id,
+			Server:   serverNumber,
+			OTP:      otp,
+		})
+		queueWebhooks(ctx, db, userID, models.WebhookOTPReceived, map[string]interface{}{
+			"id":      id,
+			"server":  serverNumber,
+			"number":  transaction.Number,
+			"service": transaction.Service,
+			"otp":     otp,
+		})
+	}
+
+	notifyOtp(ctx, db, transaction, otp, ipDetail)
+
+	go func() {
+		err := triggerNextOtp(context.Background(), db, server, transaction.Service, id)
+		if err != nil {
+			log.Printf("Error triggering next OTP for ID: %s, OTP: %s - %v", id, otp, err)
+		} else {
+			log.Printf("Successfully triggered next OTP for ID: %s, OTP: %s", id, otp)
+		}
+	}()
+
+	recentOtpCollection := models.InitializeVerifyRecentOTPCollection(db)
+	recentOtpFilter := bson.M{"transaction_id": id}
+	recentOtpUpdate := bson.M{
+		"$set": bson.M{
+			"otp":       otp,
+			"updatedAt": time.Now(),
+		},
+		"$setOnInsert": bson.M{
+			"transaction_id": id,
+			"createdAt":      time.Now(),
+		},
+	}
+	_, err = recentOtpCollection.UpdateOne(ctx, recentOtpFilter, recentOtpUpdate, options.Update().SetUpsert(true))
+	if err != nil {
+		logs.Logger.Error("Failed to insert or update recent OTP:", err)
+	}
+	return true, nil
+}
+
+// notifyOtp sends the OTP received notification to the admin bot.
+func notifyOtp(ctx context.Context, db *mongo.Database, transaction models.TransactionHistory, otp, ipDetail string) {
+	var userData models.User
+	userID, _ := primitive.ObjectIDFromHex(transaction.UserID)
+	err := models.InitializeUserCollection(db).FindOne(ctx, bson.M{"_id": userID}).Decode(&userData)
+	if err != nil {
+		logs.Logger.Error(err)
+	}
+
+	serverNumber, _ := strconv.Atoi(transaction.Server)
+	var serviceList models.ServerList
+	var serviceCode string
+	err = models.InitializeServerListCollection(db).FindOne(
+		ctx,
+		bson.M{
+			"name":           transaction.Service,
+			"servers.server": serverNumber,
+		},
+		options.FindOne().SetProjection(bson.M{
+			"servers.$": 1,
+		}),
+	).Decode(&serviceList)
+	if err != nil {
+		logs.Logger.Error(err)
+	} else if len(serviceList.Servers) > 0 {
+		serviceCode = serviceList.Servers[0].Code
+	}
+
+	otpDetail := services.OTPDetails{
+		Email:       userData.Email,
+		ServiceName: transaction.Service,
+		ServiceCode: serviceCode,
+		Price:       transaction.Price,
+		Server:      transaction.Server,
+		Number:      transaction.Number,
+		OTP:         otp,
+		Ip:          ipDetail,
+	}
+	err = services.OtpGetDetails(otpDetail)
+	if err != nil {
+		logs.Logger.Error(err)
+		logs.Logger.Error("Unable to send message")
+	}
+}
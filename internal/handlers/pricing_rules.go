@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PricingEngine prices catalog entries: the provider cost converted with the
+// server's exchange rate plus its margin, then every enabled pricing rule
+// matching the entry, in order.
+type PricingEngine struct {
+	rules []models.PricingRule
+}
+
+// NewPricingEngine orders the enabled rules by priority. Rules of the same
+// priority keep their given order.
+func NewPricingEngine(rules []models.PricingRule) *PricingEngine {
+	enabled := make([]models.PricingRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Enabled {
+			enabled = append(enabled, rule)
+		}
+	}
+	sort.SliceStable(enabled, func(i, j int) bool {
+		return enabled[i].Priority < enabled[j].Priority
+	})
+	return &PricingEngine{rules: enabled}
+}
+
+// LoadPricingEngine builds the engine from the stored pricing rules.
+func LoadPricingEngine(ctx context.Context, db *mongo.Database) (*PricingEngine, error) {
+	cursor, err := models.InitializePricingRuleCollection(db).Find(ctx, bson.M{"enabled": true}, options.Find().SetSort(bson.D{{Key: "priority", Value: 1}, {Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pricing rules: %w", err)
+	}
+	var rules []models.PricingRule
+	if err := cursor.All(ctx, &rules); err != nil {
+		return nil, fmt.Errorf("failed to decode pricing rules: %w", err)
+	}
+	return NewPricingEngine(rules), nil
+}
+
+// PriceItem is what pricing rules match a price on. Stock is nil for prices
+// without a stock count, which surge rules leave alone.
+type PriceItem struct {
+	Server  int
+	Service string
+	Country string
+	Stock   *int
+}
+
+// ruleMatches reports whether a rule applies to the price of an item.
+func ruleMatches(rule models.PricingRule, item PriceItem) bool {
+	return (rule.Server == 0 || rule.Server == item.Server) &&
+		(rule.Service == "" || rule.Service == item.Service) &&
+		(rule.Country == "" || provider.NormalizeCountry(rule.Country) == provider.NormalizeCountry(item.Country))
+}
+
+// applyRule returns the price of an item after a matching rule.
+func applyRule(rule models.PricingRule, price float64, item PriceItem) float64 {
+	add := func(value float64) float64 {
+		if rule.Percent {
+			return price + price*value/100
+		}
+		return price + value
+	}
+	switch rule.Kind {
+	case models.RuleMargin:
+		return add(rule.Value)
+	case models.RuleMinPrice:
+		return math.Max(price, rule.Value)
+	case models.RuleMaxPrice:
+		return math.Min(price, rule.Value)
+	case models.RuleRound:
+		// The epsilon keeps prices already on a step where they are.
+		steps := price / rule.Value
+		switch rule.Round {
+		case "up":
+			steps = math.Ceil(steps - 1e-9)
+		case "down":
+			steps = math.Floor(steps + 1e-9)
+		default:
+			steps = math.Round(steps)
+		}
+		return steps * rule.Value
+	case models.RuleSurge:
+		if item.Stock != nil && *item.Stock < rule.StockBelow {
+			return add(rule.Value)
+		}
+	}
+	return price
+}
+
+// Price returns the sell price, in rupees, of a provider cost and the names
+// of the rules that changed it.
+func (e *PricingEngine) Price(item PriceItem, cost, exchangeRate, margin float64) (float64, []string) {
+	price := cost*exchangeRate + margin
+	applied := []string{}
+	for _, rule := range e.rules {
+		if !ruleMatches(rule, item) {
+			continue
+		}
+		next := applyRule(rule, price, item)
+		if next != price {
+			applied = append(applied, rule.Name)
+		}
+		price = next
+	}
+	return round(math.Max(price, 0), 2), applied
+}
+
+// SellPrice is Price formatted the way catalog prices are stored.
+func (e *PricingEngine) SellPrice(item PriceItem, cost, exchangeRate, margin float64) string {
+	price, _ := e.Price(item, cost, exchangeRate, margin)
+	return fmt.Sprintf("%.2f", price)
+}
+
+// validatePricingRule checks a rule before it is stored or previewed.
+func validatePricingRule(rule *models.PricingRule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("Rule name is required")
+	}
+	if rule.Country != "" {
+		rule.Country = provider.NormalizeCountry(rule.Country)
+		if _, err := provider.LookupCountry(rule.Country); err != nil {
+			return fmt.Errorf("Country is not supported")
+		}
+	}
+	switch rule.Kind {
+	case models.RuleMargin:
+	case models.RuleMinPrice, models.RuleMaxPrice:
+		if rule.Value <= 0 || rule.Percent {
+			return fmt.Errorf("Min and max prices must be positive rupee amounts")
+		}
+	case models.RuleRound:
+		if rule.Value <= 0 {
+			return fmt.Errorf("Rounding step must be positive")
+		}
+		if rule.Round != "up" && rule.Round != "down" && rule.Round != "nearest" {
+			return fmt.Errorf("Round must be up, down or nearest")
+		}
+	case models.RuleSurge:
+		if rule.StockBelow <= 0 {
+			return fmt.Errorf("Surge rules need a positive stockBelow")
+		}
+	default:
+		return fmt.Errorf("Kind must be margin, min, max, round or surge")
+	}
+	return nil
+}
+
+// GetPricingRules lists every pricing rule in the order they apply.
+func GetPricingRules(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	ctx := context.TODO()
+	cursor, err := models.InitializePricingRuleCollection(db).Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "priority", Value: 1}, {Key: "createdAt", Value: 1}}))
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch pricing rules"})
+	}
+	rules := []models.PricingRule{}
+	if err := cursor.All(ctx, &rules); err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to decode pricing rules"})
+	}
+	return c.JSON(http.StatusOK, rules)
+}
+
+// SavePricingRule adds a pricing rule, or replaces the one with the given id.
+// Rules take effect at the next catalog sync or apply.
+func SavePricingRule(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	ctx := context.TODO()
+
+	var rule models.PricingRule
+	if err := c.Bind(&rule); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+	if err := validatePricingRule(&rule); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	collection := models.InitializePricingRuleCollection(db)
+	now := time.Now()
+	rule.UpdatedAt = now
+	if rule.ID.IsZero() {
+		rule.ID = primitive.NewObjectID()
+		rule.CreatedAt = now
+		if _, err := collection.InsertOne(ctx, rule); err != nil {
+			logs.Logger.Error(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add pricing rule"})
+		}
+		return c.JSON(http.StatusCreated, rule)
+	}
+
+	var existing models.PricingRule
+	if err := collection.FindOne(ctx, bson.M{"_id": rule.ID}).Decode(&existing); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Pricing rule not found"})
+		}
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch pricing rule"})
+	}
+	rule.CreatedAt = existing.CreatedAt
+	if _, err := collection.ReplaceOne(ctx, bson.M{"_id": rule.ID}, rule); err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update pricing rule"})
+	}
+	return c.JSON(http.StatusOK, rule)
+}
+
+// DeletePricingRule removes the pricing rule with the given id.
+func DeletePricingRule(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	id, err := primitive.ObjectIDFromHex(c.QueryParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid rule id"})
+	}
+	result, err := models.InitializePricingRuleCollection(db).DeleteOne(context.TODO(), bson.M{"_id": id})
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete pricing rule"})
+	}
+	if result.DeletedCount == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Pricing rule not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Pricing rule deleted successfully."})
+}
+
+// PricePreview is the current and the ruled price of one catalog entry.
+type PricePreview struct {
+	Service  string   `json:"service"`
+	Server   int      `json:"server"`
+	Country  string   `json:"country,omitempty"`
+	Stock    *int     `json:"stock,omitempty"`
+	OldPrice string   `json:"oldPrice"`
+	Base     float64  `json:"base"`
+	NewPrice string   `json:"newPrice"`
+	Rules    []string `json:"rules"`
+}
+
+// priceCost is the provider cost behind a catalog price: the stored cost, or
+// for prices synced before costs were stored, the price less the margin
+// converted back with the exchange rate.
+func priceCost(price string, cost, exchangeRate, margin float64) (float64, bool) {
+	if cost > 0 {
+		return cost, true
+	}
+	value, err := strconv.ParseFloat(price, 64)
+	if err != nil || exchangeRate <= 0 {
+		return 0, false
+	}
+	return (value - margin) / exchangeRate, true
+}
+
+// DryRunPricing shows, without writing anything, the price every catalog
+// entry has now next to the price the rules would give it, optionally for
+// one server or service. The rules sent in the body are previewed instead of
+// the stored ones when given.
+func DryRunPricing(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	ctx := context.TODO()
+
+	var input struct {
+		Rules []models.PricingRule `json:"rules"`
+	}
+	if c.Request().ContentLength > 0 {
+		if err := c.Bind(&input); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+		}
+	}
+	engine, err := LoadPricingEngine(ctx, db)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to load pricing rules"})
+	}
+	if input.Rules != nil {
+		for i := range input.Rules {
+			if err := validatePricingRule(&input.Rules[i]); err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Rule %d: %s", i+1, err.Error())})
+			}
+		}
+		engine = NewPricingEngine(input.Rules)
+	}
+
+	serverFilter := 0
+	if value := c.QueryParam("server"); value != "" {
+		serverFilter, err = strconv.Atoi(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Server must be a valid number"})
+		}
+	}
+	filter := bson.M{}
+	if service := c.QueryParam("service"); service != "" {
+		filter["name"] = service
+	}
+
+	marginMap, exchangeMap, err := FetchMarginAndExchangeRate(ctx, db)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch servers"})
+	}
+	cursor, err := models.InitializeServerListCollection(db).Find(ctx, filter, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch service list"})
+	}
+	var serviceLists []models.ServerList
+	if err := cursor.All(ctx, &serviceLists); err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to decode service list"})
+	}
+
+	previews := []PricePreview{}
+	changed := 0
+	for _, service := range serviceLists {
+		for _, entry := range service.Servers {
+			if serverFilter != 0 && entry.Server != serverFilter {
+				continue
+			}
+			rate, margin := exchangeMap[entry.Server], marginMap[entry.Server]
+			cost, ok := priceCost(entry.Price, entry.Cost, rate, margin)
+			if !ok {
+				continue
+			}
+			item := PriceItem{Server: entry.Server, Service: service.Name, Country: entry.Country, Stock: entry.Stock}
+			price, applied := engine.Price(item, cost, rate, margin)
+			preview := PricePreview{
+				Service:  service.Name,
+				Server:   entry.Server,
+				Country:  entry.Country,
+				Stock:    entry.Stock,
+				OldPrice: entry.Price,
+				Base:     round(cost*rate+margin, 2),
+				NewPrice: fmt.Sprintf("%.2f", price),
+				Rules:    applied,
+			}
+			if preview.NewPrice != preview.OldPrice {
+				changed++
+			}
+			previews = append(previews, preview)
+		}
+	}
+	return c.JSON(http.StatusOK, echo.Map{"changed": changed, "prices": previews})
+}
+
+// ApplyPricingRules reprices every server's catalog with the stored rules
+// now, instead of at the next catalog sync.
+func ApplyPricingRules(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	ctx := context.TODO()
+	marginMap, exchangeMap, err := FetchMarginAndExchangeRate(ctx, db)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch servers"})
+	}
+	repriced := make(map[int]int)
+	for server, rate := range exchangeMap {
+		if server == 0 {
+			continue
+		}
+		count, err := RepriceServer(ctx, db, server, rate, marginMap[server], rate, marginMap[server])
+		if err != nil {
+			logs.Logger.Error(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to apply pricing rules"})
+		}
+		repriced[server] = count
+	}
+	return c.JSON(http.StatusOK, echo.Map{"repriced": repriced})
+}
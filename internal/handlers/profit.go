@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// orderPricing records how the price of a number bought from a catalog entry
+// was made up. Entries synced before costs were stored get the cost back
+// from their price, margin and exchange rate.
+func orderPricing(serverInfo models.Server, serverData models.ServerData, discount float64) *models.Pricing {
+	cost := serverData.Cost
+	if cost == 0 && serverInfo.ExchangeRate > 0 {
+		price, err := strconv.ParseFloat(serverData.Price, 64)
+		if err == nil {
+			cost = round((price-serverInfo.Margin)/serverInfo.ExchangeRate, 4)
+		}
+	}
+	return &models.Pricing{
+		UpstreamCost: cost,
+		ExchangeRate: serverInfo.ExchangeRate,
+		Margin:       serverInfo.Margin,
+		Discount:     discount,
+	}
+}
+
+// Profit report groupings.
+var profitGroups = map[string]interface{}{
+	"day":     bson.M{"$substrBytes": bson.A{"$date_time", 0, 10}},
+	"server":  "$server",
+	"service": "$service",
+	"user":    "$userId",
+}
+
+// ProfitRow is the revenue, cost and gross profit of the sold numbers in one
+// group of a profit report. Cost is in our currency. Unpriced counts sales
+// recorded before costs were, which count no cost.
+type ProfitRow struct {
+	Key      string  `json:"key"`
+	Email    string  `json:"email,omitempty"`
+	Sold     int     `json:"sold"`
+	Revenue  float64 `json:"revenue"`
+	Cost     float64 `json:"cost"`
+	Profit   float64 `json:"profit"`
+	Unpriced int     `json:"unpriced"`
+}
+
+// ProfitReport sums the numbers sold between from and to, date_time strings
+// in IST, by day, server, service or user.
+func ProfitReport(ctx context.Context, db *mongo.Database, groupBy, from, to string) ([]ProfitRow, error) {
+	group, ok := profitGroups[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("INVALID_GROUP")
+	}
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "status", Value: "SUCCESS"},
+			{Key: "date_time", Value: bson.D{
+				{Key: "$gte", Value: from},
+				{Key: "$lte", Value: to},
+			}},
+		}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: group},
+			{Key: "sold", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "revenue", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$toDouble", Value: "$price"}}}}},
+			{Key: "cost", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$multiply", Value: bson.A{
+				bson.D{{Key: "$ifNull", Value: bson.A{"$pricing.upstreamCost", 0}}},
+				bson.D{{Key: "$ifNull", Value: bson.A{"$pricing.exchangeRate", 0}}},
+			}}}}}},
+			{Key: "unpriced", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$ifNull", Value: bson.A{"$pricing", false}}}, 0, 1,
+			}}}}}},
+		}}},
+	}
+	cursor, err := models.InitializeTransactionHistoryCollection(db).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate profit: %w", err)
+	}
+	var results []struct {
+		Key      string  `bson:"_id"`
+		Sold     int     `bson:"sold"`
+		Revenue  float64 `bson:"revenue"`
+		Cost     float64 `bson:"cost"`
+		Unpriced int     `bson:"unpriced"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("failed to decode profit: %w", err)
+	}
+
+	rows := make([]ProfitRow, 0, len(results))
+	for _, result := range results {
+		rows = append(rows, ProfitRow{
+			Key:      result.Key,
+			Sold:     result.Sold,
+			Revenue:  round(result.Revenue, 2),
+			Cost:     round(result.Cost, 2),
+			Profit:   round(result.Revenue-result.Cost, 2),
+			Unpriced: result.Unpriced,
+		})
+	}
+	if groupBy == "user" {
+		addProfitEmails(ctx, db, rows)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if groupBy == "server" {
+			a, _ := strconv.Atoi(rows[i].Key)
+			b, _ := strconv.Atoi(rows[j].Key)
+			return a < b
+		}
+		if groupBy == "day" {
+			return rows[i].Key < rows[j].Key
+		}
+		return rows[i].Profit > rows[j].Profit
+	})
+	return rows, nil
+}
+
+func addProfitEmails(ctx context.Context, db *mongo.Database, rows []ProfitRow) {
+	ids := make([]primitive.ObjectID, 0, len(rows))
+	for _, row := range rows {
+		if id, err := primitive.ObjectIDFromHex(row.Key); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	cursor, err := models.InitializeUserCollection(db).Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		logs.Logger.Error(err)
+		return
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		logs.Logger.Error(err)
+		return
+	}
+	emails := make(map[string]string, len(users))
+	for _, user := range users {
+		emails[user.ID.Hex()] = user.Email
+	}
+	for i := range rows {
+		rows[i].Email = emails[rows[i].Key]
+	}
+}
+
+// GetProfitReport serves the profit report for the days from and to
+// (YYYY-MM-DD, default today), grouped by groupBy: day, server, service or
+// user (default day).
+func GetProfitReport(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	ist := time.FixedZone("IST", 5*3600+30*60)
+	today := time.Now().In(ist).Format("2006-01-02")
+
+	groupBy := c.QueryParam("groupBy")
+	if groupBy == "" {
+		groupBy = "day"
+	}
+	if _, ok := profitGroups[groupBy]; !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "groupBy must be day, server, service or user"})
+	}
+	from, to := c.QueryParam("from"), c.QueryParam("to")
+	if from == "" {
+		from = today
+	}
+	if to == "" {
+		to = today
+	}
+	for _, day := range []string{from, to} {
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "from and to must be dates like 2006-01-02"})
+		}
+	}
+
+	rows, err := ProfitReport(context.TODO(), db, groupBy, from+"T00:00:00", to+"T23:59:59")
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to build profit report"})
+	}
+	var total ProfitRow
+	total.Key = "total"
+	for _, row := range rows {
+		total.Sold += row.Sold
+		total.Revenue += row.Revenue
+		total.Cost += row.Cost
+		total.Unpriced += row.Unpriced
+	}
+	total.Revenue = round(total.Revenue, 2)
+	total.Cost = round(total.Cost, 2)
+	total.Profit = round(total.Revenue-total.Cost, 2)
+	return c.JSON(http.StatusOK, echo.Map{"groupBy": groupBy, "from": from, "to": to, "rows": rows, "total": total})
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// reconcileGrace is how long an activation unknown locally is left alone
+// before it is cancelled, since get-number only stores the transaction once
+// the purchase has returned.
+const reconcileGrace = 10 * time.Minute
+
+// ActionCancelledUpstream is the reconciler's fix for activations running
+// upstream that nobody pays for.
+const ActionCancelledUpstream = "CANCELLED_UPSTREAM"
+
+// ReconcileReport is the outcome of reconciling one server.
+type ReconcileReport struct {
+	Server      int                     `json:"server"`
+	Activations int                     `json:"activations"`
+	Drifts      []models.Reconciliation `json:"drifts"`
+	Error       string                  `json:"error,omitempty"`
+}
+
+// Reconcile compares the activations of every server whose provider can list
+// them with our transaction history and records the drift found. With fix,
+// activations running upstream that are unknown locally, past
+// reconcileGrace, or already refunded locally are cancelled upstream. Orders
+// charged locally but cancelled upstream are only reported.
+func Reconcile(ctx context.Context, db *mongo.Database, fix bool) ([]ReconcileReport, error) {
+	cursor, err := models.InitializeServerCollection(db).Find(ctx, bson.M{"server": bson.M{"$ne": 0}})
+	if err != nil {
+		return nil, err
+	}
+	var servers []models.Server
+	if err := cursor.All(ctx, &servers); err != nil {
+		return nil, err
+	}
+
+	reports := []ReconcileReport{}
+	for _, serverInfo := range servers {
+		lister, err := provider.ActivationListerFor(serverInfo)
+		if err != nil {
+			continue
+		}
+		report := reconcileServer(ctx, db, serverInfo, lister, fix)
+		if report.Error != "" {
+			logs.Logger.Errorf("failed to reconcile server %d: %s", serverInfo.ServerNumber, report.Error)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+func reconcileServer(ctx context.Context, db *mongo.Database, serverInfo models.Server, lister provider.ActivationLister, fix bool) ReconcileReport {
+	report := ReconcileReport{Server: serverInfo.ServerNumber, Drifts: []models.Reconciliation{}}
+	activations, err := lister.Activations(ctx, serverCredentials(serverInfo))
+	if err != nil {
+		if err.Error() != "ACTIVATIONS_NOT_SUPPORTED" {
+			report.Error = err.Error()
+		}
+		return report
+	}
+	report.Activations = len(activations)
+	runStart := time.Now()
+
+	ids := make([]string, 0, len(activations))
+	for _, activation := range activations {
+		ids = append(ids, activation.ID)
+	}
+	histories := make(map[string]models.TransactionHistory)
+	if len(ids) > 0 {
+		cursor, err := models.InitializeTransactionHistoryCollection(db).Find(ctx, bson.M{
+			"server": strconv.Itoa(serverInfo.ServerNumber),
+			"id":     bson.M{"$in": ids},
+		})
+		if err != nil {
+			report.Error = err.Error()
+			return report
+		}
+		var transactions []models.TransactionHistory
+		if err := cursor.All(ctx, &transactions); err != nil {
+			report.Error = err.Error()
+			return report
+		}
+		for _, transaction := range transactions {
+			histories[transaction.TransactionID] = transaction
+		}
+	}
+
+	reconciliations := models.InitializeReconciliationCollection(db)
+	for _, activation := range activations {
+		transaction, known := histories[activation.ID]
+		var kind string
+		switch {
+		case activation.Status == provider.ActivationActive && !known:
+			kind = models.DriftUnknownLocally
+		case activation.Status == provider.ActivationActive && transaction.Status == "CANCELLED":
+			kind = models.DriftRefundedButActive
+		case activation.Status == provider.ActivationCancelled && transaction.Status == "SUCCESS":
+			kind = models.DriftSuccessButCancelled
+		default:
+			continue
+		}
+
+		number := activation.Number
+		if known {
+			number = transaction.Number
+		}
+		now := time.Now()
+		var drift models.Reconciliation
+		err := reconciliations.FindOneAndUpdate(ctx,
+			bson.M{"server": serverInfo.ServerNumber, "activationId": activation.ID, "kind": kind},
+			bson.M{
+				"$set": bson.M{
+					"number":         number,
+					"code":           activation.Code,
+					"localStatus":    transaction.Status,
+					"upstreamStatus": activation.Status,
+					"lastSeenAt":     now,
+				},
+				"$unset":       bson.M{"resolvedAt": ""},
+				"$setOnInsert": bson.M{"firstSeenAt": now},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&drift)
+		if err != nil {
+			logs.Logger.Errorf("failed to record %s drift of activation %s on server %d: %v", kind, activation.ID, serverInfo.ServerNumber, err)
+			continue
+		}
+
+		cancelUpstream := kind == models.DriftRefundedButActive ||
+			(kind == models.DriftUnknownLocally && now.Sub(drift.FirstSeenAt) >= reconcileGrace)
+		if fix && cancelUpstream && drift.Action != ActionCancelledUpstream {
+			drift.Action = ActionCancelledUpstream
+			drift.Error = ""
+			if err := CancelNumberThirdParty(ctx, serverInfo, activation.ID, number); err != nil && !errors.Is(err, provider.ErrAlreadyFinished) {
+				drift.Action = ""
+				drift.Error = err.Error()
+			}
+			_, err := reconciliations.UpdateOne(ctx, bson.M{"_id": drift.ID}, bson.M{
+				"$set": bson.M{"action": drift.Action, "error": drift.Error},
+			})
+			if err != nil {
+				logs.Logger.Error(err)
+			}
+		}
+		logs.Logger.Infof("reconcile server %d: activation %s is %s (action %q)", serverInfo.ServerNumber, activation.ID, kind, drift.Action)
+		report.Drifts = append(report.Drifts, drift)
+	}
+
+	// Activations no longer running upstream have settled on their own.
+	// Charged orders cancelled upstream stay open until looked at.
+	_, err = reconciliations.UpdateMany(ctx, bson.M{
+		"server":     serverInfo.ServerNumber,
+		"kind":       bson.M{"$in": bson.A{models.DriftUnknownLocally, models.DriftRefundedButActive}},
+		"resolvedAt": bson.M{"$exists": false},
+		"lastSeenAt": bson.M{"$lt": runStart},
+	}, bson.M{"$set": bson.M{"resolvedAt": time.Now()}})
+	if err != nil {
+		logs.Logger.Error(err)
+	}
+	return report
+}
+
+// GetReconciliations lists the recorded drift between our orders and the
+// providers, open drift only unless all=true, optionally for one server.
+func GetReconciliations(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	ctx := context.TODO()
+
+	filter := bson.M{}
+	if c.QueryParam("all") != "true" {
+		filter["resolvedAt"] = bson.M{"$exists": false}
+	}
+	if server := c.QueryParam("server"); server != "" {
+		serverNumber, err := strconv.Atoi(server)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid server number"})
+		}
+		filter["server"] = serverNumber
+	}
+	cursor, err := models.InitializeReconciliationCollection(db).Find(ctx, filter, options.Find().SetSort(bson.M{"lastSeenAt": -1}).SetLimit(500))
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch reconciliations"})
+	}
+	drifts := []models.Reconciliation{}
+	if err := cursor.All(ctx, &drifts); err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to decode reconciliations"})
+	}
+	return c.JSON(http.StatusOK, drifts)
+}
+
+// RunReconciliation reconciles every server now. fix=true cancels stray
+// activations upstream, as RECONCILE_AUTOFIX does for the scheduled runs.
+func RunReconciliation(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	reports, err := Reconcile(c.Request().Context(), db, c.QueryParam("fix") == "true")
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to reconcile"})
+	}
+	return c.JSON(http.StatusOK, reports)
+}
@@ -0,0 +1,516 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// rentalRefundWindow is how long after renting a number can be released for
+// a refund, provided no SMS arrived. Providers refuse to cancel rentals
+// after it.
+const rentalRefundWindow = 20 * time.Minute
+
+// rentalWalletUser returns the wallet and account of an api key, or the
+// response to send when the request cannot go on.
+func rentalWalletUser(ctx context.Context, db *mongo.Database, apiKey string) (models.ApiWalletUser, models.User, int, map[string]string) {
+	var apiWalletUser models.ApiWalletUser
+	var user models.User
+	if apiKey == "" {
+		return apiWalletUser, user, http.StatusBadRequest, map[string]string{"error": "empty api key"}
+	}
+	var server0 models.Server
+	err := models.InitializeServerCollection(db).FindOne(ctx, bson.M{"server": 0}).Decode(&server0)
+	if err != nil {
+		logs.Logger.Error(err)
+		return apiWalletUser, user, http.StatusInternalServerError, map[string]string{"error": "internal server error"}
+	}
+	if server0.Maintenance {
+		return apiWalletUser, user, http.StatusOK, map[string]string{"error": "site is under maintenance"}
+	}
+	err = models.InitializeApiWalletuserCollection(db).FindOne(ctx, bson.M{"api_key": apiKey}).Decode(&apiWalletUser)
+	if err != nil {
+		logs.Logger.Error(err)
+		return apiWalletUser, user, http.StatusInternalServerError, map[string]string{"error": "invalid api key"}
+	}
+	err = models.InitializeUserCollection(db).FindOne(ctx, bson.M{"_id": apiWalletUser.UserID}).Decode(&user)
+	if err != nil {
+		logs.Logger.Error(err)
+		return apiWalletUser, user, http.StatusInternalServerError, map[string]string{"error": "internal server error"}
+	}
+	if user.Blocked {
+		return apiWalletUser, user, http.StatusInternalServerError, map[string]string{"error": "account blocked"}
+	}
+	return apiWalletUser, user, 0, nil
+}
+
+// rentPrice returns the catalog entry of a service on a server and country,
+// and its rent price for the duration.
+func rentPrice(ctx context.Context, db *mongo.Database, serverNumber int, code, country, duration string) (models.ServerList, models.ServerData, float64, error) {
+	var serviceList models.ServerList
+	err := models.InitializeServerListCollection(db).FindOne(ctx, bson.M{
+		"servers": bson.M{"$elemMatch": bson.M{"server": serverNumber, "code": code, "country": countryFilter(country)}},
+	}).Decode(&serviceList)
+	if err != nil {
+		return serviceList, models.ServerData{}, 0, err
+	}
+	for _, s := range serviceList.Servers {
+		if s.Server != serverNumber || s.Code != code || !inCountry(s, country) {
+			continue
+		}
+		price, err := strconv.ParseFloat(s.Rent[duration], 64)
+		if err != nil {
+			return serviceList, s, 0, errors.New("RENT_NOT_AVAILABLE")
+		}
+		return serviceList, s, price, nil
+	}
+	return serviceList, models.ServerData{}, 0, errors.New("RENT_NOT_AVAILABLE")
+}
+
+// chargeWallet takes amount from the user's wallet and records it in the
+// transaction history in one transaction. It returns the id of the history
+// entry.
+func chargeWallet(db *mongo.Database, userID primitive.ObjectID, amount float64, transaction models.TransactionHistory) (primitive.ObjectID, error) {
+	amount = math.Round(amount*100) / 100
+	transaction.ID = primitive.NewObjectID()
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return transaction.ID, fmt.Errorf("failed to start transaction session: %w", err)
+	}
+	defer session.EndSession(context.Background())
+	_, err = session.WithTransaction(context.Background(), func(sc mongo.SessionContext) (interface{}, error) {
+		result, err := models.InitializeApiWalletuserCollection(db).UpdateOne(
+			sc,
+			bson.M{"userId": userID, "balance": bson.M{"$gte": amount}},
+			bson.M{"$inc": bson.M{"balance": -amount}},
+		)
+		if err != nil {
+			return nil, err
+		}
+		if result.ModifiedCount == 0 {
+			return nil, errors.New("low balance")
+		}
+		transaction.UserID = userID.Hex()
+		transaction.Price = fmt.Sprintf("%.2f", amount)
+		transaction.OTP = []string{}
+		transaction.DateTime = FormatDateTime()
+		transaction.CreatedAt = time.Now()
+		_, err = models.InitializeTransactionHistoryCollection(db).InsertOne(sc, transaction)
+		return nil, err
+	})
+	return transaction.ID, err
+}
+
+// refundWallet gives amount back to the user's wallet and marks the
+// matching transaction history entries cancelled in one transaction.
+func refundWallet(db *mongo.Database, userID primitive.ObjectID, amount float64, history bson.M) error {
+	amount = math.Round(amount*100) / 100
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction session: %w", err)
+	}
+	defer session.EndSession(context.Background())
+	_, err = session.WithTransaction(context.Background(), func(sc mongo.SessionContext) (interface{}, error) {
+		result, err := models.InitializeApiWalletuserCollection(db).UpdateOne(sc, bson.M{"userId": userID}, bson.M{"$inc": bson.M{"balance": amount}})
+		if err != nil {
+			return nil, err
+		}
+		if result.ModifiedCount == 0 {
+			return nil, errors.New("balance update failed, no document modified")
+		}
+		_, err = models.InitializeTransactionHistoryCollection(db).UpdateMany(sc, history, bson.M{
+			"$set": bson.M{"status": "CANCELLED", "date_time": FormatDateTime()},
+		})
+		return nil, err
+	})
+	return err
+}
+
+// HandleRentNumber rents a number for a day or a week, charged from the
+// wallet at the catalog's rent price.
+func HandleRentNumber(c echo.Context) error {
+	ctx := context.TODO()
+	db := c.Get("db").(*mongo.Database)
+	apiKey := c.QueryParam("apikey")
+	code := c.QueryParam("code")
+	duration := c.QueryParam("duration")
+
+	serverNumber, err := strconv.Atoi(c.QueryParam("server"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid server value"})
+	}
+	if code == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "empty code value"})
+	}
+	hours, ok := provider.RentDurations[duration]
+	if !ok {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid duration, use day or week"})
+	}
+	country := provider.NormalizeCountry(c.QueryParam("country"))
+	if _, err := provider.LookupCountry(country); err != nil {
+		return c.JSON(http.StatusBadRequest, providerErrorResponse(err))
+	}
+
+	userMutex := getUserMutex(apiKey)
+	userMutex.Lock()
+	defer userMutex.Unlock()
+
+	apiWalletUser, user, status, response := rentalWalletUser(ctx, db, apiKey)
+	if response != nil {
+		return c.JSON(status, response)
+	}
+
+	var serverInfo models.Server
+	err = models.InitializeServerCollection(db).FindOne(ctx, bson.M{"server": serverNumber}).Decode(&serverInfo)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "server not found"})
+	}
+	if serverInfo.Maintenance {
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "server under maintenance"})
+	}
+	if serverInfo.Block {
+		return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "invalid server number"})
+	}
+
+	serviceList, serverData, price, err := rentPrice(ctx, db, serverNumber, code, country, duration)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "rent not available for this service"})
+	}
+	if apiWalletUser.Balance < price {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "low balance"})
+	}
+
+	renter, err := provider.RenterFor(serverInfo)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "rent not available for this service"})
+	}
+	// Like purchases, a rental is not abandoned when the customer disconnects.
+	rentCtx := context.WithoutCancel(c.Request().Context())
+	rental, err := renter.RentNumber(rentCtx, serverCredentials(serverInfo), provider.RentRequest{
+		Code:    serverData.Code,
+		Country: country,
+		Hours:   hours,
+	})
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, providerErrorResponse(err))
+	}
+
+	_, err = chargeWallet(db, user.ID, price, models.TransactionHistory{
+		TransactionID: rental.ID,
+		Number:        rental.Number,
+		Service:       serviceList.Name,
+		Server:        strconv.Itoa(serverNumber),
+		Country:       country,
+		Status:        "RENTED",
+	})
+	if err != nil {
+		logs.Logger.Error("Transaction failed:", err)
+		if releaseErr := renter.ReleaseRental(rentCtx, serverCredentials(serverInfo), rental.ID, true); releaseErr != nil {
+			logs.Logger.Errorf("failed to release unpaid rental %s on server %d: %v", rental.ID, serverNumber, releaseErr)
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	now := time.Now()
+	record := models.Rental{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Service:   serviceList.Name,
+		Code:      serverData.Code,
+		Server:    serverNumber,
+		Country:   country,
+		RentalID:  rental.ID,
+		Number:    rental.Number,
+		Duration:  duration,
+		Hours:     hours,
+		Price:     math.Round(price*100) / 100,
+		Status:    models.RentalActive,
+		Messages:  []models.RentalSMS{},
+		StartedAt: now,
+		EndsAt:    now.Add(time.Duration(hours) * time.Hour),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := models.InitializeRentalCollection(db).InsertOne(ctx, record); err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	return c.JSON(http.StatusOK, record)
+}
+
+// findRental loads a rental of the user by its id.
+func findRental(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, id string) (models.Rental, error) {
+	var rental models.Rental
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return rental, err
+	}
+	err = models.InitializeRentalCollection(db).FindOne(ctx, bson.M{"_id": objectID, "userId": userID}).Decode(&rental)
+	return rental, err
+}
+
+// SyncRentalInbox reads a rental's SMS from its provider and stores them.
+// Rentals that are no longer active are returned as stored.
+func SyncRentalInbox(ctx context.Context, db *mongo.Database, rental models.Rental) (models.Rental, error) {
+	if rental.Status != models.RentalActive {
+		return rental, nil
+	}
+	serverInfo, err := getServerInfo(db, rental.Server)
+	if err != nil {
+		return rental, err
+	}
+	renter, err := provider.RenterFor(serverInfo)
+	if err != nil {
+		return rental, err
+	}
+	messages, err := renter.RentStatus(ctx, serverCredentials(serverInfo), rental.RentalID)
+	if err != nil {
+		return rental, err
+	}
+
+	// Messages keep the time they were first seen when the provider's
+	// date cannot be read.
+	seen := make(map[string]time.Time)
+	for _, sms := range rental.Messages {
+		seen[sms.Sender+"\x00"+sms.Text] = sms.ReceivedAt
+	}
+	inbox := make([]models.RentalSMS, 0, len(messages))
+	for _, message := range messages {
+		receivedAt := message.ReceivedAt
+		if receivedAt.IsZero() {
+			receivedAt = seen[message.Sender+"\x00"+message.Text]
+		}
+		if receivedAt.IsZero() {
+			receivedAt = time.Now()
+		}
+		inbox = append(inbox, models.RentalSMS{Text: message.Text, Sender: message.Sender, ReceivedAt: receivedAt})
+	}
+	if len(inbox) < len(rental.Messages) {
+		// Never lose messages already shown to the customer.
+		return rental, nil
+	}
+	rental.Messages = inbox
+	rental.UpdatedAt = time.Now()
+	_, err = models.InitializeRentalCollection(db).UpdateOne(ctx, bson.M{"_id": rental.ID}, bson.M{
+		"$set": bson.M{"messages": rental.Messages, "updatedAt": rental.UpdatedAt},
+	})
+	return rental, err
+}
+
+// HandleRentalInbox returns a rental with every SMS received on it.
+func HandleRentalInbox(c echo.Context) error {
+	ctx := context.TODO()
+	db := c.Get("db").(*mongo.Database)
+
+	_, user, status, response := rentalWalletUser(ctx, db, c.QueryParam("apikey"))
+	if response != nil {
+		return c.JSON(status, response)
+	}
+	rental, err := findRental(ctx, db, user.ID, c.QueryParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "rental not found"})
+	}
+	rental, err = SyncRentalInbox(c.Request().Context(), db, rental)
+	if err != nil {
+		// The stored inbox is still worth showing.
+		logs.Logger.Errorf("failed to read inbox of rental %s: %v", rental.ID.Hex(), err)
+	}
+	return c.JSON(http.StatusOK, rental)
+}
+
+// HandleListRentals lists the user's rentals, newest first. status filters
+// by ACTIVE, RELEASED or EXPIRED.
+func HandleListRentals(c echo.Context) error {
+	ctx := context.TODO()
+	db := c.Get("db").(*mongo.Database)
+
+	_, user, status, response := rentalWalletUser(ctx, db, c.QueryParam("apikey"))
+	if response != nil {
+		return c.JSON(status, response)
+	}
+	filter := bson.M{"userId": user.ID}
+	if rentalStatus := c.QueryParam("status"); rentalStatus != "" {
+		filter["status"] = rentalStatus
+	}
+	cursor, err := models.InitializeRentalCollection(db).Find(ctx, filter, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	rentals := []models.Rental{}
+	if err := cursor.All(ctx, &rentals); err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	return c.JSON(http.StatusOK, rentals)
+}
+
+// HandleExtendRental adds a day or a week to an active rental, charged at
+// the current catalog rent price.
+func HandleExtendRental(c echo.Context) error {
+	ctx := context.TODO()
+	db := c.Get("db").(*mongo.Database)
+	apiKey := c.QueryParam("apikey")
+	duration := c.QueryParam("duration")
+
+	hours, ok := provider.RentDurations[duration]
+	if !ok {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid duration, use day or week"})
+	}
+
+	userMutex := getUserMutex(apiKey)
+	userMutex.Lock()
+	defer userMutex.Unlock()
+
+	apiWalletUser, user, status, response := rentalWalletUser(ctx, db, apiKey)
+	if response != nil {
+		return c.JSON(status, response)
+	}
+	rental, err := findRental(ctx, db, user.ID, c.QueryParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "rental not found"})
+	}
+	if rental.Status != models.RentalActive || time.Now().After(rental.EndsAt) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "rental has ended"})
+	}
+
+	serverInfo, err := getServerInfo(db, rental.Server)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "server not found"})
+	}
+	_, _, price, err := rentPrice(ctx, db, rental.Server, rental.Code, rental.Country, duration)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "rent not available for this service"})
+	}
+	if apiWalletUser.Balance < price {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "low balance"})
+	}
+	renter, err := provider.RenterFor(serverInfo)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "rent not available for this service"})
+	}
+
+	// The extension is paid for first and refunded if the provider refuses
+	// it, so a failed charge never leaves an extension unpaid.
+	historyID, err := chargeWallet(db, user.ID, price, models.TransactionHistory{
+		TransactionID: rental.RentalID,
+		Number:        rental.Number,
+		Service:       rental.Service,
+		Server:        strconv.Itoa(rental.Server),
+		Country:       rental.Country,
+		Status:        "RENTAL_EXTENDED",
+	})
+	if err != nil {
+		logs.Logger.Error("Transaction failed:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	err = renter.ExtendRental(context.WithoutCancel(c.Request().Context()), serverCredentials(serverInfo), rental.RentalID, hours)
+	if err != nil {
+		logs.Logger.Error(err)
+		if refundErr := refundWallet(db, user.ID, price, bson.M{"_id": historyID}); refundErr != nil {
+			logs.Logger.Errorf("failed to refund extension of rental %s: %v", rental.ID.Hex(), refundErr)
+		}
+		return c.JSON(http.StatusInternalServerError, providerErrorResponse(err))
+	}
+
+	endsAt := rental.EndsAt.Add(time.Duration(hours) * time.Hour)
+	_, err = models.InitializeRentalCollection(db).UpdateOne(ctx, bson.M{"_id": rental.ID}, bson.M{
+		"$set": bson.M{"endsAt": endsAt, "updatedAt": time.Now()},
+		"$inc": bson.M{"hours": hours, "price": math.Round(price*100) / 100},
+	})
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok", "id": rental.ID.Hex(), "endsAt": endsAt.Format(time.RFC3339)})
+}
+
+// HandleReleaseRental ends an active rental early. Within
+// rentalRefundWindow of renting, and only while no SMS has arrived, the
+// rental is cancelled with the provider and its price refunded to the
+// wallet; later releases just give the number back.
+func HandleReleaseRental(c echo.Context) error {
+	ctx := context.TODO()
+	db := c.Get("db").(*mongo.Database)
+	apiKey := c.QueryParam("apikey")
+
+	userMutex := getUserMutex(apiKey)
+	userMutex.Lock()
+	defer userMutex.Unlock()
+
+	apiWalletUser, user, status, response := rentalWalletUser(ctx, db, apiKey)
+	if response != nil {
+		return c.JSON(status, response)
+	}
+	rental, err := findRental(ctx, db, user.ID, c.QueryParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "rental not found"})
+	}
+	if rental.Status != models.RentalActive {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "rental has ended"})
+	}
+
+	releaseCtx := context.WithoutCancel(c.Request().Context())
+	// An SMS that arrived since the inbox was last read rules out a refund.
+	rental, err = SyncRentalInbox(releaseCtx, db, rental)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, providerErrorResponse(err))
+	}
+	refund := len(rental.Messages) == 0 && time.Since(rental.StartedAt) < rentalRefundWindow
+
+	serverInfo, err := getServerInfo(db, rental.Server)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "server not found"})
+	}
+	renter, err := provider.RenterFor(serverInfo)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "rent not available for this service"})
+	}
+	err = renter.ReleaseRental(releaseCtx, serverCredentials(serverInfo), rental.RentalID, refund)
+	if err != nil && !errors.Is(err, provider.ErrAlreadyFinished) {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, providerErrorResponse(err))
+	}
+
+	now := time.Now()
+	_, err = models.InitializeRentalCollection(db).UpdateOne(ctx, bson.M{"_id": rental.ID}, bson.M{
+		"$set": bson.M{"status": models.RentalReleased, "endsAt": now, "updatedAt": now},
+	})
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+
+	balance := apiWalletUser.Balance
+	if refund {
+		err = refundWallet(db, user.ID, rental.Price, bson.M{"id": rental.RentalID, "userId": user.ID.Hex()})
+		if err != nil {
+			logs.Logger.Error("Transaction failed:", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		balance += rental.Price
+	}
+	return c.JSON(http.StatusOK, map[string]string{
+		"status":   "success",
+		"refunded": strconv.FormatBool(refund),
+		"balance":  fmt.Sprintf("%.2f", balance),
+	})
+}
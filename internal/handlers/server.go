@@ -6,10 +6,13 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -203,19 +206,28 @@ func MaintainanceServer(c echo.Context) error {
 	})
 }
 
-// Add token for server 9
+// Add token for server 9. The token is trusted for the provider's token
+// lifetime, after which the credential rotation replaces it.
 func AddTokenForServer9(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
-	serverCollection := db.Collection("server")
+	serverCollection := models.InitializeServerCollection(db)
 
 	token := c.FormValue("token")
 	if token == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Token is required"})
 	}
 
-	filter := bson.M{"server": 9}
-	update := bson.M{"$set": bson.M{"token": token}}
-	result, err := serverCollection.UpdateOne(context.Background(), filter, update)
+	var server models.Server
+	if err := serverCollection.FindOne(context.Background(), bson.M{"server": 9}).Decode(&server); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server 9 not found"})
+	}
+	now := time.Now()
+	set := bson.M{"token": token, "tokenRefreshedAt": now}
+	if refresher, err := provider.TokenRefresherFor(server); err == nil {
+		set["tokenExpiresAt"] = now.Add(refresher.TokenLifetime())
+	}
+	update := bson.M{"$set": set, "$unset": bson.M{"tokenError": ""}}
+	result, err := serverCollection.UpdateOne(context.Background(), bson.M{"server": 9}, update)
 	if err != nil || result.MatchedCount == 0 {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server 9 not found"})
 	}
@@ -226,7 +238,7 @@ func AddTokenForServer9(c echo.Context) error {
 // Get token for server 9
 func GetTokenForServer9(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
-	serverCollection := db.Collection("server")
+	serverCollection := models.InitializeServerCollection(db)
 
 	var server models.Server
 	err := serverCollection.FindOne(context.Background(), bson.M{"server": 9}).Decode(&server)
@@ -236,7 +248,112 @@ func GetTokenForServer9(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"token": server.Token})
 }
 
-// Update exchange rate and margin for a server
+// CredentialStatus is the state of a server's provider credentials. Status
+// is "static" for providers called with the API key alone, and for token
+// providers "ok", "due" (refreshed on the next rotation), "expired",
+// "missing" or "failed" (the last refresh failed).
+type CredentialStatus struct {
+	Server      int        `json:"server"`
+	HasAPIKey   bool       `json:"hasApiKey"`
+	Rotates     bool       `json:"rotates"`
+	HasToken    bool       `json:"hasToken"`
+	Status      string     `json:"status"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	RefreshedAt *time.Time `json:"refreshedAt,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+}
+
+func credentialStatus(server models.Server) CredentialStatus {
+	status := CredentialStatus{
+		Server:    server.ServerNumber,
+		HasAPIKey: server.APIKey != "",
+		HasToken:  server.Token != "",
+		Status:    "static",
+		LastError: server.TokenError,
+	}
+	if !server.TokenExpiresAt.IsZero() {
+		status.ExpiresAt = &server.TokenExpiresAt
+	}
+	if !server.TokenRefreshedAt.IsZero() {
+		status.RefreshedAt = &server.TokenRefreshedAt
+	}
+	refresher, err := provider.TokenRefresherFor(server)
+	if err != nil {
+		return status
+	}
+	status.Rotates = true
+	switch {
+	case server.TokenError != "":
+		status.Status = "failed"
+	case server.Token == "":
+		status.Status = "missing"
+	case !server.TokenExpiresAt.IsZero() && time.Now().After(server.TokenExpiresAt):
+		status.Status = "expired"
+	case provider.TokenDue(server, refresher):
+		status.Status = "due"
+	default:
+		status.Status = "ok"
+	}
+	return status
+}
+
+// GetServerCredentials reports the credential status of every server.
+func GetServerCredentials(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	cursor, err := models.InitializeServerCollection(db).Find(context.Background(), bson.M{"server": bson.M{"$ne": 0}},
+		options.Find().SetSort(bson.M{"server": 1}))
+	if err != nil {
+		log.Println("ERROR: Failed to fetch servers:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+	var servers []models.Server
+	if err := cursor.All(context.Background(), &servers); err != nil {
+		log.Println("ERROR: Failed to decode servers:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+	statuses := make([]CredentialStatus, 0, len(servers))
+	for _, server := range servers {
+		statuses = append(statuses, credentialStatus(server))
+	}
+	return c.JSON(http.StatusOK, statuses)
+}
+
+// RefreshServerCredentials refreshes a server's provider token right away.
+func RefreshServerCredentials(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	type RequestBody struct {
+		Server string `json:"server"`
+	}
+	var input RequestBody
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+	serverNumber, err := strconv.Atoi(input.Server)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Server must be a valid number"})
+	}
+	var server models.Server
+	err = models.InitializeServerCollection(db).FindOne(context.Background(), bson.M{"server": serverNumber}).Decode(&server)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server not found"})
+	}
+	if _, err := provider.TokenRefresherFor(server); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Server does not use tokens"})
+	}
+	token, err := provider.RefreshToken(c.Request().Context(), server)
+	if err != nil {
+		log.Printf("ERROR: Failed to refresh token for server %d: %v\n", serverNumber, err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": "Token refresh failed: " + provider.MessageOf(err)})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":   "Token refreshed successfully.",
+		"expiresAt": token.ExpiresAt,
+	})
+}
+
+// Update exchange rate and margin for a server. An exchange rate entered here
+// overrides the rate updater until manual is sent as "false"; currency sets
+// the currency the server bills in. The server's catalog is repriced.
 func UpdateExchangeRateAndMargin(c echo.Context) error {
 	// Retrieve the database instance
 	db := c.Get("db").(*mongo.Database)
@@ -247,6 +364,8 @@ func UpdateExchangeRateAndMargin(c echo.Context) error {
 		Server       string `json:"server"`
 		ExchangeRate string `json:"exchangeRate,omitempty"` // Allow string input
 		Margin       string `json:"margin,omitempty"`       // Allow string input
+		Manual       string `json:"manual,omitempty"`
+		Currency     string `json:"currency,omitempty"`
 	}
 
 	var input RequestBody
@@ -294,23 +413,55 @@ func UpdateExchangeRateAndMargin(c echo.Context) error {
 	if margin != nil {
 		updateFields["margin"] = *margin
 	}
+	switch input.Manual {
+	case "true", "false":
+		updateFields["exchangeRateManual"] = input.Manual == "true"
+	case "":
+		if exchangeRate != nil {
+			updateFields["exchangeRateManual"] = true
+		}
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Manual must be true or false"})
+	}
+	if input.Currency != "" {
+		updateFields["currency"] = strings.ToUpper(input.Currency)
+	}
 	if len(updateFields) == 0 {
 		log.Println("ERROR: No fields provided to update")
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "At least one field (exchangeRate or margin) must be provided"})
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "At least one field (exchangeRate, margin, manual or currency) must be provided"})
+	}
+	if exchangeRate != nil {
+		updateFields["exchangeRateUpdatedAt"] = time.Now()
 	}
 
 	// Update the server document
 	filter := bson.M{"server": server}
 	update := bson.M{"$set": updateFields}
-	result, err := serverCollection.UpdateOne(context.Background(), filter, update)
+	var previous models.Server
+	err = serverCollection.FindOneAndUpdate(context.Background(), filter, update).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		log.Printf("ERROR: Server %d not found\n", server)
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server not found"})
+	}
 	if err != nil {
 		log.Println("ERROR: Failed to update server:", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
 	}
 
-	if result.MatchedCount == 0 {
-		log.Printf("ERROR: Server %d not found\n", server)
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server not found"})
+	if exchangeRate != nil || margin != nil {
+		newRate, newMargin := previous.ExchangeRate, previous.Margin
+		if exchangeRate != nil {
+			newRate = *exchangeRate
+		}
+		if margin != nil {
+			newMargin = *margin
+		}
+		repriced, err := RepriceServer(context.Background(), db, server, previous.ExchangeRate, previous.Margin, newRate, newMargin)
+		if err != nil {
+			log.Println("ERROR: Failed to reprice server:", err)
+		} else {
+			log.Printf("INFO: Repriced %d entries of server %d\n", repriced, server)
+		}
 	}
 
 	log.Printf("INFO: Successfully updated server %d\n", server)
@@ -322,11 +473,77 @@ func UpdateExchangeRateAndMargin(c echo.Context) error {
 	})
 }
 
+// UpdateServerProvider stores a declarative provider config on a server so a
+// new handler_api clone can be onboarded without a deploy. Sending no provider
+// removes the config and falls back to the built-in provider.
+func UpdateServerProvider(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	serverCollection := db.Collection("servers")
+
+	type RequestBody struct {
+		Server   string                 `json:"server"`
+		Provider *models.ProviderConfig `json:"provider"`
+	}
+
+	var input RequestBody
+	if err := c.Bind(&input); err != nil {
+		log.Println("ERROR: Failed to parse request body:", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+
+	server, err := strconv.Atoi(input.Server)
+	if err != nil {
+		log.Println("ERROR: Server must be a valid number:", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Server must be a valid number"})
+	}
+
+	update := bson.M{"$unset": bson.M{"provider": ""}}
+	if input.Provider != nil {
+		if input.Provider.Country == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Provider country is required"})
+		}
+		if _, err := provider.FromConfig(*input.Provider); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		update = bson.M{"$set": bson.M{"provider": input.Provider}}
+	}
+
+	result, err := serverCollection.UpdateOne(context.Background(), bson.M{"server": server}, update)
+	if err != nil {
+		log.Println("ERROR: Failed to update server:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+	if result.MatchedCount == 0 {
+		log.Printf("ERROR: Server %d not found\n", server)
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server not found"})
+	}
+
+	log.Printf("INFO: Updated provider config for server %d\n", server)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":  "Provider config updated successfully.",
+		"server":   server,
+		"provider": input.Provider,
+	})
+}
+
+// GetServerHealth reports the tracked health and circuit breaker state of
+// every upstream server.
+func GetServerHealth(c echo.Context) error {
+	return c.JSON(http.StatusOK, provider.HealthReport())
+}
+
+// GetUpstreamStats reports the outbound call counts, failures, retries and
+// latency of every upstream host called since start up.
+func GetUpstreamStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, httpclient.Stats())
+}
+
 func BlocKServer(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 	type RequestPayload struct {
 		Name         string `json:"name" validate:"required"`
 		ServerNumber string `json:"serverNumber" validate:"required"`
+		Country      string `json:"country"`
 		Block        bool   `json:"block"`
 	}
 	var payload RequestPayload
@@ -346,14 +563,21 @@ func BlocKServer(c echo.Context) error {
 	serverListCollection := models.InitializeServerListCollection(db)
 	filter := bson.M{"name": payload.Name, "servers.server": serverNumber}
 
+	// Without a country the server is blocked in every country it sells in.
+	entry := bson.M{"entry.server": serverNumber}
+	if payload.Country != "" {
+		entry["entry.country"] = countryFilter(provider.NormalizeCountry(payload.Country))
+	}
 	update := bson.M{
 		"$set": bson.M{
-			"servers.$.block": payload.Block,
-			"updatedAt":       time.Now(),
+			"servers.$[entry].block": payload.Block,
+			"updatedAt":              time.Now(),
 		},
 	}
 
-	result, err := serverListCollection.UpdateOne(context.TODO(), filter, update)
+	result, err := serverListCollection.UpdateOne(context.TODO(), filter, update, options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{entry},
+	}))
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update server block status"})
 	}
@@ -363,3 +587,219 @@ func BlocKServer(c echo.Context) error {
 	}
 	return c.JSON(http.StatusOK, map[string]string{"message": "server block status updated successfully"})
 }
+
+// UpdateServiceOperators sets the operators a server sells a service from,
+// with optional per-operator prices. Providers that publish operator prices
+// have their lists replaced by the next catalog sync. An empty list lets
+// customers order any operator the provider accepts.
+func UpdateServiceOperators(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	type RequestPayload struct {
+		Name         string                 `json:"name"`
+		ServerNumber string                 `json:"serverNumber"`
+		Country      string                 `json:"country"`
+		Operators    []models.OperatorPrice `json:"operators"`
+	}
+	var payload RequestPayload
+	if err := c.Bind(&payload); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request payload"})
+	}
+	if payload.Name == "" || payload.ServerNumber == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "missing required fields"})
+	}
+	serverNumber, err := strconv.Atoi(payload.ServerNumber)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid serverNumber value"})
+	}
+	for i, operator := range payload.Operators {
+		if normalizeOperator(operator.Name) == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "operator name is required"})
+		}
+		if operator.Price != "" {
+			price, err := strconv.ParseFloat(operator.Price, 64)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid operator price"})
+			}
+			payload.Operators[i].Price = strconv.FormatFloat(price, 'f', 2, 64)
+		}
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"servers.$[entry].operators": payload.Operators,
+			"updatedAt":                  time.Now(),
+		},
+	}
+	if len(payload.Operators) == 0 {
+		update = bson.M{
+			"$unset": bson.M{"servers.$[entry].operators": ""},
+			"$set":   bson.M{"updatedAt": time.Now()},
+		}
+	}
+	serverListCollection := models.InitializeServerListCollection(db)
+	result, err := serverListCollection.UpdateOne(context.TODO(), bson.M{"name": payload.Name, "servers.server": serverNumber}, update, options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{
+			"entry.server":  serverNumber,
+			"entry.country": countryFilter(provider.NormalizeCountry(payload.Country)),
+		}},
+	}))
+	if err != nil {
+		log.Println("ERROR: Failed to update operators:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update operators"})
+	}
+	if result.MatchedCount == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "server or service not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "operators updated successfully"})
+}
+
+// UpdateServerBalanceAlert sets the balance below which the balance monitor
+// alerts for a server, and whether it should also put the server into
+// maintenance. A threshold of 0 disables the alerts.
+func UpdateServerBalanceAlert(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	serverCollection := models.InitializeServerCollection(db)
+
+	type RequestBody struct {
+		Server          string  `json:"server"`
+		Threshold       float64 `json:"threshold"`
+		AutoMaintenance bool    `json:"autoMaintenance"`
+	}
+	var input RequestBody
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+	server, err := strconv.Atoi(input.Server)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Server must be a valid number"})
+	}
+	if input.Threshold < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Threshold must not be negative"})
+	}
+
+	result, err := serverCollection.UpdateOne(context.Background(), bson.M{"server": server}, bson.M{
+		"$set": bson.M{
+			"lowBalanceThreshold": input.Threshold,
+			"autoMaintenance":     input.AutoMaintenance,
+		},
+	})
+	if err != nil {
+		log.Println("ERROR: Failed to update server:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+	if result.MatchedCount == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Balance alert updated successfully."})
+}
+
+// UpdateServerRateLimit sets the outbound limits of a server: at most
+// rateLimit requests a second and maxInFlight concurrent requests to its
+// provider, 0 for no limit.
+func UpdateServerRateLimit(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	serverCollection := models.InitializeServerCollection(db)
+
+	type RequestBody struct {
+		Server      string  `json:"server"`
+		RateLimit   float64 `json:"rateLimit"`
+		MaxInFlight int     `json:"maxInFlight"`
+	}
+	var input RequestBody
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+	server, err := strconv.Atoi(input.Server)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Server must be a valid number"})
+	}
+	if input.RateLimit < 0 || input.MaxInFlight < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Limits must not be negative"})
+	}
+
+	result, err := serverCollection.UpdateOne(context.Background(), bson.M{"server": server}, bson.M{
+		"$set": bson.M{
+			"rateLimit":   input.RateLimit,
+			"maxInFlight": input.MaxInFlight,
+		},
+	})
+	if err != nil {
+		log.Println("ERROR: Failed to update server:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+	if result.MatchedCount == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server not found"})
+	}
+	provider.SetLimits(server, input.RateLimit, input.MaxInFlight)
+	return c.JSON(http.StatusOK, map[string]string{"message": "Rate limit updated successfully."})
+}
+
+// GetServerLimits reports the outbound limits of every server and how often
+// calls were throttled, queued or rejected by them.
+func GetServerLimits(c echo.Context) error {
+	return c.JSON(http.StatusOK, provider.LimitReport())
+}
+
+// GetUpstreamAudit returns every exchange with the provider recorded for a
+// transaction id, oldest first. The optional server narrows it down when
+// providers reuse activation ids.
+func GetUpstreamAudit(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	id := c.QueryParam("id")
+	if id == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Transaction id is required"})
+	}
+	filter := bson.M{"activationId": id}
+	if value := c.QueryParam("server"); value != "" {
+		server, err := strconv.Atoi(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Server must be a valid number"})
+		}
+		filter["server"] = server
+	}
+
+	cursor, err := models.InitializeUpstreamAuditCollection(db).Find(context.Background(), filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "attempt", Value: 1}}))
+	if err != nil {
+		log.Println("ERROR: Failed to fetch upstream audit:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+	exchanges := []models.UpstreamAudit{}
+	if err := cursor.All(context.Background(), &exchanges); err != nil {
+		log.Println("ERROR: Failed to decode upstream audit:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+	return c.JSON(http.StatusOK, exchanges)
+}
+
+// GetServerBalanceHistory returns the balance samples of a server taken by
+// the balance monitor over the last `hours` hours (default 24), oldest first.
+func GetServerBalanceHistory(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	server, err := strconv.Atoi(c.QueryParam("server"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Server must be a valid number"})
+	}
+	hours := 24
+	if value := c.QueryParam("hours"); value != "" {
+		hours, err = strconv.Atoi(value)
+		if err != nil || hours <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Hours must be a positive number"})
+		}
+	}
+
+	cursor, err := models.InitializeServerBalanceCollection(db).Find(context.Background(), bson.M{
+		"server":    server,
+		"createdAt": bson.M{"$gte": time.Now().Add(-time.Duration(hours) * time.Hour)},
+	}, options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		log.Println("ERROR: Failed to fetch server balances:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+	balances := []models.ServerBalance{}
+	if err := cursor.All(context.Background(), &balances); err != nil {
+		log.Println("ERROR: Failed to decode server balances:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+	return c.JSON(http.StatusOK, balances)
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"math"
 	"net/http"
@@ -17,23 +16,15 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
-	serverscalc "github.com/ranjankuldeep/fakeNumber/internal/serversCalc"
-	serversnextotpcalc "github.com/ranjankuldeep/fakeNumber/internal/serversNextOtpCalc"
-	serversotpcalc "github.com/ranjankuldeep/fakeNumber/internal/serversOtpCalc"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
 	"github.com/ranjankuldeep/fakeNumber/internal/services"
 	"github.com/ranjankuldeep/fakeNumber/internal/utils"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type ApiRequest struct {
-	URL     string
-	Headers map[string]string
-}
-
 type ResponseData struct {
 	ID     string
 	Number string
@@ -48,11 +39,6 @@ type OTPData struct {
 	Code string
 }
 
-type ServerSecrets struct {
-	ApiKeyServer string
-	Token        string
-}
-
 func FetchMarginAndExchangeRate(ctx context.Context, db *mongo.Database) (map[int]float64, map[int]float64, error) {
 	serverCollection := models.InitializeServerCollection(db)
 	marginMap := make(map[int]float64)
@@ -118,7 +104,16 @@ func HandleGetNumberRequest(c echo.Context) error {
 	if code == "" {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "empty code value"})
 	}
+	// server=auto or fallback=true tries every server offering the service,
+	// cheapest first, until one of them has stock.
+	fallback := server == "auto" || c.QueryParam("fallback") == "true"
+	maxPrice, _ := strconv.ParseFloat(c.QueryParam("maxprice"), 64)
 	serverNumber, _ := strconv.Atoi(server)
+	country := provider.NormalizeCountry(c.QueryParam("country"))
+	if _, err := provider.LookupCountry(country); err != nil {
+		return c.JSON(http.StatusBadRequest, providerErrorResponse(err))
+	}
+	operator := normalizeOperator(c.QueryParam("operator"))
 
 	serverCollection := models.InitializeServerCollection(db)
 	var server0 models.Server
@@ -150,71 +145,93 @@ func HandleGetNumberRequest(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "account blocked"})
 	}
 
-	var serverInfo models.Server
-	err = serverCollection.FindOne(ctx, bson.M{"server": serverNumber}).Decode(&serverInfo)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "server not found"})
-	}
-	if serverInfo.Maintenance {
-		return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "server under maintenance"})
-	}
-	if serverInfo.Block == true {
-		return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "invalid server number"})
+	isMultiple := "true"
+	if otp == "single" {
+		isMultiple = "false"
 	}
 
+	var candidates []numberCandidate
 	var serviceList models.ServerList
 	serverListollection := models.InitializeServerListCollection(db)
-	err = serverListollection.FindOne(ctx, bson.M{
-		"servers.server": serverNumber,
-		"servers.code":   code,
-	}).Decode(&serviceList)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
-	}
-
-	var serverData models.ServerData
-	for _, s := range serviceList.Servers {
-		if s.Server == serverNumber {
-			serverData = models.ServerData{
-				Price:  s.Price,
-				Code:   s.Code,
-				Otp:    s.Otp,
-				Server: serverNumber,
-			}
+	if fallback {
+		filter := bson.M{"servers": bson.M{"$elemMatch": bson.M{"server": serverNumber, "code": code, "country": countryFilter(country)}}}
+		if server == "auto" {
+			filter = bson.M{"$or": []bson.M{{"service_code": code}, {"servers.code": code}}}
+		}
+		err = serverListollection.FindOne(ctx, filter).Decode(&serviceList)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		}
+		var lowBalance bool
+		candidates, lowBalance = rankNumberCandidates(ctx, db, user.ID.Hex(), apiWalletUser.Balance, maxPrice, serviceList, country, operator, serverNumber)
+		if lowBalance {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "low balance"})
+		}
+	} else {
+		var serverInfo models.Server
+		err = serverCollection.FindOne(ctx, bson.M{"server": serverNumber}).Decode(&serverInfo)
+		if err != nil {
+			logs.Logger.Error(err)
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "server not found"})
+		}
+		if serverInfo.Maintenance {
+			return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "server under maintenance"})
+		}
+		if serverInfo.Block == true {
+			return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "invalid server number"})
 		}
-	}
 
-	isMultiple := "true"
-	if otp == "single" {
-		isMultiple = "false"
-	}
+		err = serverListollection.FindOne(ctx, bson.M{
+			"servers": bson.M{"$elemMatch": bson.M{"server": serverNumber, "code": code, "country": countryFilter(country)}},
+		}).Decode(&serviceList)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		}
 
-	var serviceName string
-	for _, s := range serviceList.Servers {
-		if s.Server == serverNumber && s.Code == code {
-			serviceName = serviceList.Name
-			break
+		var serverData models.ServerData
+		for _, s := range serviceList.Servers {
+			if s.Server == serverNumber && inCountry(s, country) {
+				serverData = models.ServerData{
+					Price:     s.Price,
+					Cost:      s.Cost,
+					Code:      s.Code,
+					Otp:       s.Otp,
+					Server:    serverNumber,
+					Country:   country,
+					Operators: s.Operators,
+				}
+			}
+		}
+		serverData, ok := withOperator(serverData, operator)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, providerErrorResponse(provider.ErrOperatorNotSupported))
 		}
-	}
 
-	price, _ := strconv.ParseFloat(serverData.Price, 64)
-	discount, err := FetchDiscount(ctx, db, user.ID.Hex(), serviceName, serverNumber)
-	price += discount
-	if apiWalletUser.Balance < price {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "low balance"})
+		price, _ := strconv.ParseFloat(serverData.Price, 64)
+		discount, _ := FetchDiscount(ctx, db, user.ID.Hex(), serviceList.Name, serverNumber, country)
+		price += discount
+		if apiWalletUser.Balance < price {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "low balance"})
+		}
+		candidates = []numberCandidate{{serverInfo: serverInfo, serverData: serverData, price: price, discount: discount}}
 	}
+	serviceName := serviceList.Name
 
-	apiURLRequest, err := constructApiUrl(db, server, serverInfo.APIKey, serverInfo.Token, serverData, isMultiple)
+	// The user is only charged for the server that delivered a number.
+	// A purchase is not abandoned when the customer disconnects, or a number
+	// bought upstream would never be charged or cancelled.
+	numData, candidate, err := buyFromCandidates(context.WithoutCancel(c.Request().Context()), candidates, serviceName, operator, isMultiple == "true")
 	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		return c.JSON(http.StatusInternalServerError, providerErrorResponse(err))
 	}
-	// added
-	numData, err := ExtractNumber(server, apiURLRequest)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	if numData.Id == "" || numData.Number == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "no stock"})
 	}
+	serverData := candidate.serverData
+	price := candidate.price
+	pricing := orderPricing(candidate.serverInfo, candidate.serverData, candidate.discount)
+	serverNumber = serverData.Server
+	server = strconv.Itoa(serverNumber)
 
 	newBalance := apiWalletUser.Balance - price
 	roundedBalance := math.Round(newBalance*100) / 100
@@ -243,10 +260,14 @@ func HandleGetNumberRequest(c echo.Context) error {
 			TransactionID: numData.Id,
 			Price:         fmt.Sprintf("%.2f", price),
 			Server:        server,
+			Country:       country,
+			Operator:      operator,
 			OTP:           []string{},
 			ID:            primitive.NewObjectID(),
 			Number:        numData.Number,
 			Status:        "PENDING",
+			State:         models.StateWaitingSMS,
+			Pricing:       pricing,
 			DateTime:      time.Now().In(time.FixedZone("IST", 5*3600+30*60)).Format("2006-01-02T15:04:05"),
 			CreatedAt:     time.Now(),
 		}
@@ -264,10 +285,10 @@ func HandleGetNumberRequest(c echo.Context) error {
 
 	var expirationTime time.Time
 	switch server {
-	case "1", "2", "3", "4", "5", "6", "8", "9", "10", "11":
-		expirationTime = time.Now().Add(19 * time.Minute)
 	case "7":
 		expirationTime = time.Now().Add(9 * time.Minute)
+	default:
+		expirationTime = time.Now().Add(19 * time.Minute)
 	}
 
 	orderCollection := models.InitializeOrderCollection(db)
@@ -280,17 +301,19 @@ func HandleGetNumberRequest(c echo.Context) error {
 		Server:         serverNumber,
 		NumberID:       numData.Id,
 		Number:         numData.Number,
+		Country:        country,
+		Operator:       operator,
 		OrderTime:      time.Now(),
 		ExpirationTime: expirationTime,
+		Pricing:        pricing,
+		Status:         models.StateWaitingSMS,
+		Transitions:    handedOutTransitions(),
 	}
 	_, err = orderCollection.InsertOne(ctx, order)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
 	}
-
-	if numData.Id == "" || numData.Number == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "no stock"})
-	}
+	publishStateEvent(ctx, db, order, models.StateWaitingSMS)
 
 	ipDetail, err := utils.ExtractIpDetails(c)
 	if err != nil {
@@ -312,134 +335,55 @@ func HandleGetNumberRequest(c echo.Context) error {
 	if err != nil {
 		logs.Logger.Info("Number Details Send Failed")
 	}
-	return c.JSON(http.StatusOK, map[string]string{"status": "ok", "id": numData.Id, "number": numData.Number})
+	response := map[string]string{"status": "ok", "id": numData.Id, "number": numData.Number, "server": server, "country": country}
+	if operator != "" {
+		response["operator"] = operator
+	}
+	return c.JSON(http.StatusOK, response)
 }
 
-func ExtractNumber(server string, apiURLRequest ApiRequest) (NumberData, error) {
-	switch server {
-	case "1":
-		// Multiple OTP server with same url
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
-		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
-		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "2":
-		// Multiple OTP server with same url
-		number, id, err := serverscalc.ExtractNumberServer2(apiURLRequest.URL, apiURLRequest.Headers)
-		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
-		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "3":
-		// Multiple OTP server with same url
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
-		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
-		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "4":
-		// Single OTP server
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
-		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
-		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "5":
-		// Multiple OTP server with same url
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
-		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
-		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "6":
-		// Single OTP server
-		// Done
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
-		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
-		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "7":
-		// Multiple OTP server with same url
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
-		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
-		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "8":
-		// Done
-		// Multiple OTP server with same url
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
-		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
-		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "9":
-		// Single OTP server
-		// Done
-		number, id, err := serverscalc.ExtractNumberServer9(apiURLRequest.URL, apiURLRequest.Headers)
-		if err != nil {
-			logs.Logger.Error(err)
-			return NumberData{}, fmt.Errorf("no stock")
-		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "10":
-		// Single OTP server
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
-		if err != nil {
-			logs.Logger.Error(err)
-			return NumberData{}, fmt.Errorf("no stock")
-		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "11":
-		// Multiple OTP servers with different URLs
-		number, id, err := serverscalc.ExtractNumberServer11(apiURLRequest.URL)
-		if err != nil {
-			if strings.Contains(err.Error(), "no_channels") {
-				logs.Logger.Warn("No channels available. The channel limit has been reached.")
-				return NumberData{}, fmt.Errorf("no stock")
-			}
-			return NumberData{}, fmt.Errorf("no stock")
-		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
+// ExtractNumber buys a number for the service from the server's provider,
+// from the operator if one is given, capped at the provider cost.
+func ExtractNumber(ctx context.Context, serverInfo models.Server, serverData models.ServerData, operator string, multiple bool) (NumberData, error) {
+	prov, err := provider.ForServer(serverInfo)
+	if err != nil {
+		return NumberData{}, err
 	}
-	return NumberData{}, nil
+	request := provider.NumberRequest{
+		Code:     serverData.Code,
+		Country:  provider.NormalizeCountry(serverData.Country),
+		Operator: operator,
+		Multiple: multiple,
+	}
+	// The cap is the provider cost stored by the catalog sync. Entries synced
+	// before costs were stored get it back from the sell price, which only
+	// holds while no pricing rule applies to them.
+	if serverData.Cost > 0 {
+		request.MaxPrice = fmt.Sprintf("%.2f", serverData.Cost)
+	} else if priceFloat, err := strconv.ParseFloat(serverData.Price, 64); err == nil && serverInfo.ExchangeRate != 0 {
+		request.MaxPrice = fmt.Sprintf("%.2f", (priceFloat-serverInfo.Margin)/serverInfo.ExchangeRate)
+	}
+	number, err := prov.BuyNumber(ctx, serverCredentials(serverInfo), request)
+	if err != nil {
+		logs.Logger.Error(err)
+		return NumberData{}, err
+	}
+	return NumberData{
+		Id:     number.ID,
+		Number: number.Number,
+	}, nil
 }
-func FetchDiscount(ctx context.Context, db *mongo.Database, userId, sname string, server int) (float64, error) {
+
+func serverCredentials(serverInfo models.Server) provider.Credentials {
+	return provider.Credentials{
+		APIKey: serverInfo.APIKey,
+		Token:  serverInfo.Token,
+	}
+}
+
+// FetchDiscount sums the user, service and server discounts for a service on
+// a server. Service discounts are per country.
+func FetchDiscount(ctx context.Context, db *mongo.Database, userId, sname string, server int, country string) (float64, error) {
 	totalDiscount := 0.0
 	userIdObject, _ := primitive.ObjectIDFromHex(userId)
 
@@ -456,7 +400,7 @@ func FetchDiscount(ctx context.Context, db *mongo.Database, userId, sname string
 	// Service discount
 	serviceDiscountCollection := models.InitializeServiceDiscountCollection(db)
 	var serviceDiscount models.ServiceDiscount
-	err = serviceDiscountCollection.FindOne(ctx, bson.M{"service": sname, "server": server}).Decode(&serviceDiscount)
+	err = serviceDiscountCollection.FindOne(ctx, bson.M{"service": sname, "server": server, "country": countryFilter(provider.NormalizeCountry(country))}).Decode(&serviceDiscount)
 	if err != nil && err != mongo.ErrNoDocuments {
 		return 0, err
 	}
@@ -496,7 +440,7 @@ func HandleGetOtp(c echo.Context) error {
 	id := c.QueryParam("id")
 	apiKey := c.QueryParam("apikey")
 	server := c.QueryParam("server")
-	serverNumber, err := strconv.Atoi(server)
+	_, err := strconv.Atoi(server)
 	if err != nil {
 		logs.Logger.Error(err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
@@ -560,139 +504,8 @@ func HandleGetOtp(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid server number"})
 	}
 
-	constructedOTPRequest, err := constructOtpUrl(server, serverData.APIKey, serverData.Token, id)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
-	}
-
-	validOtpList, err := fetchOTP(server, id, constructedOTPRequest)
-	if err != nil && err.Error() == "ACCESS_CANCEL" {
-		formattedData := FormatDateTime()
-
-		var transaction models.TransactionHistory
-		transactionCollection := models.InitializeTransactionHistoryCollection(db)
-		err = transactionCollection.FindOne(ctx, bson.M{"id": id, "server": server}).Decode(&transaction)
-		if err == mongo.ErrEmptySlice || err == mongo.ErrNoDocuments {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "invalid server number"})
-		}
-		if err != nil {
-			logs.Logger.Error(err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
-		}
-
-		if len(transaction.OTP) == 0 {
-			transactionUpdateFilter := bson.M{"id": id, "server": server}
-			transactionpdate := bson.M{
-				"$set": bson.M{
-					"status":    "CANCELLED",
-					"date_time": formattedData,
-				},
-			}
-			_, err = transactionCollection.UpdateOne(ctx, transactionUpdateFilter, transactionpdate)
-			if err != nil {
-				logs.Logger.Error(err)
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-			}
-		}
-	}
-
-	for _, validOtp := range validOtpList {
-		transactionCollection := models.InitializeTransactionHistoryCollection(db)
-		filter := bson.M{"id": id, "otp": validOtp, "server": server}
-		var existingEntry models.TransactionHistory
-		err = transactionCollection.FindOne(ctx, filter).Decode(&existingEntry)
-		if err == mongo.ErrNoDocuments {
-			formattedDateTime := FormatDateTime()
-			update := bson.M{
-				"$addToSet": bson.M{"otp": validOtp},
-				"$set": bson.M{
-					"status":    "SUCCESS",
-					"date_time": formattedDateTime,
-				},
-			}
-
-			filter := bson.M{"id": id}
-			_, err = transactionCollection.UpdateOne(ctx, filter, update)
-			if err != nil {
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-			}
-
-			ipDetail, err := utils.ExtractIpDetails(c)
-			if err != nil {
-				logs.Logger.Error(err)
-			}
-
-			var serviceList models.ServerList
-			serverListCollection := models.InitializeServerListCollection(db)
-			logs.Logger.Info(existingEntry.Service)
-			err = serverListCollection.FindOne(
-				ctx,
-				bson.M{
-					"name":           transaction.Service,
-					"servers.server": serverNumber,
-				},
-				options.FindOne().SetProjection(bson.M{
-					"servers.$": 1,
-				}),
-			).Decode(&serviceList)
-
-			if err != nil {
-				if err == mongo.ErrNoDocuments {
-					return c.JSON(http.StatusNotFound, map[string]string{"error": "server not found"})
-				}
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
-			}
-
-			s := serviceList.Servers[0]
-			serverData := models.ServerData{
-				Code: s.Code,
-			}
-
-			otpDetail := services.OTPDetails{
-				Email:       userData.Email,
-				ServiceName: transaction.Service,
-				ServiceCode: serverData.Code,
-				Price:       transaction.Price,
-				Server:      transaction.Server,
-				Number:      transaction.Number,
-				OTP:         validOtp,
-				Ip:          ipDetail,
-			}
-			err = services.OtpGetDetails(otpDetail)
-			if err != nil {
-				logs.Logger.Error(err)
-				logs.Logger.Error("Unable to send message")
-			}
-
-			go func(otp string) {
-				err := triggerNextOtp(db, server, transaction.Service, id)
-				if err != nil {
-					log.Printf("Error triggering next OTP for ID: %s, OTP: %s - %v", id, otp, err)
-				} else {
-					log.Printf("Successfully triggered next OTP for ID: %s, OTP: %s", id, otp)
-				}
-			}(validOtp)
-
-			recentOtpCollection := models.InitializeVerifyRecentOTPCollection(db)
-			recentOtpFilter := bson.M{"transaction_id": id}
-			recentOtpUpdate := bson.M{
-				"$set": bson.M{
-					"otp":       validOtp,
-					"updatedAt": time.Now(),
-				},
-				"$setOnInsert": bson.M{
-					"transaction_id": id,
-					"createdAt":      time.Now(),
-				},
-			}
-			_, err = recentOtpCollection.UpdateOne(ctx, recentOtpFilter, recentOtpUpdate, options.Update().SetUpsert(true))
-			if err != nil {
-				logs.Logger.Error("Failed to insert or update recent OTP:", err)
-			}
-		}
-	}
-
+	// OTPs are fetched from the provider by the OTP poller; here they are
+	// only read back.
 	recentOtpCollection := models.InitializeVerifyRecentOTPCollection(db)
 	var recentOtp models.RecentOTP
 	err = recentOtpCollection.FindOne(ctx, bson.M{"transaction_id": id}).Decode(&recentOtp)
@@ -713,7 +526,7 @@ func HandleGetOtp(c echo.Context) error {
 	})
 }
 
-func triggerNextOtp(db *mongo.Database, server, serviceName, id string) error {
+func triggerNextOtp(ctx context.Context, db *mongo.Database, server, serviceName, id string) error {
 	serverNumber, _ := strconv.Atoi(server)
 	serverListCollection := models.InitializeServerListCollection(db)
 
@@ -735,85 +548,29 @@ func triggerNextOtp(db *mongo.Database, server, serviceName, id string) error {
 	}
 
 	if foundServer.Otp == "Multiple Otp" {
-		switch serverNumber {
-		case 1:
-			secret, err := getApiKeyServer(db, serverNumber)
-			if err != nil {
-				return err
-			}
-			nextOtpUrl := fmt.Sprintf("https://fastsms.su/stubs/handler_api.php?api_key=%s&action=setStatus&id=%s&status=3", secret.ApiKeyServer, id)
-			headers := map[string]string{}
-			if err := serversnextotpcalc.CallNextOTPServerWaiting(nextOtpUrl, headers); err != nil {
-				return err
-			}
-		case 3:
-			secret, err := getApiKeyServer(db, serverNumber)
-			if err != nil {
-				return err
-			}
-			nextOtpUrl := fmt.Sprintf("https://smshub.org/stubs/handler_api.php?api_key=%s&action=setStatus&status=3&id=%s", secret.ApiKeyServer, id)
-			headers := map[string]string{}
-			if err := serversnextotpcalc.CallNextOTPServerRetry(nextOtpUrl, headers); err != nil {
-				return err
-			}
-		case 5:
-			secret, err := getApiKeyServer(db, serverNumber)
-			if err != nil {
-				return err
-			}
-			nextOtpUrl := fmt.Sprintf("https://api.grizzlysms.com/stubs/handler_api.php?api_key=%s&action=setStatus&status=3&id=%s", secret.ApiKeyServer, id)
-			headers := map[string]string{}
-			if err := serversnextotpcalc.CallNextOTPServerRetry(nextOtpUrl, headers); err != nil {
-				return err
-			}
-		case 7:
-			secret, err := getApiKeyServer(db, serverNumber)
-			if err != nil {
-				return err
-			}
-			nextOtpUrl := fmt.Sprintf("https://smsbower.online/stubs/handler_api.php?api_key=%s&action=setStatus&status=3&id=%s", secret.ApiKeyServer, id)
-			headers := map[string]string{}
-			if err := serversnextotpcalc.CallNextOTPServerRetry(nextOtpUrl, headers); err != nil {
-				return err
-			}
-		case 8:
-			secret, err := getApiKeyServer(db, serverNumber)
-			if err != nil {
-				return err
-			}
-			nextOtpUrl := fmt.Sprintf("https://api.sms-activate.io/stubs/handler_api.php?api_key=%s&action=setStatus&status=3&id=%s", secret.ApiKeyServer, id)
-			headers := map[string]string{}
-			if err := serversnextotpcalc.CallNextOTPServerRetry(nextOtpUrl, headers); err != nil {
-				return err
-			}
-		case 11:
-			secret, err := getApiKeyServer(db, serverNumber)
-			if err != nil {
-				return err
-			}
-			nextOtpUrl := fmt.Sprintf("https://api2.sms-man.com/control/set-status?token=%s&request_id=%s&status=retrysms", secret.Token, id)
-			headers := map[string]string{}
-			if err := serversnextotpcalc.CallNextOTPServerRetry(nextOtpUrl, headers); err != nil {
-				return err
-			}
+		serverInfo, err := getServerInfo(db, serverNumber)
+		if err != nil {
+			return err
+		}
+		prov, err := provider.ForServer(serverInfo)
+		if err != nil {
+			return err
+		}
+		if err := prov.RequestNextSMS(ctx, serverCredentials(serverInfo), id); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func getApiKeyServer(db *mongo.Database, serverNumber int) (ServerSecrets, error) {
-	logs.Logger.Info(serverNumber)
+func getServerInfo(db *mongo.Database, serverNumber int) (models.Server, error) {
 	var server models.Server
 	serverCollection := models.InitializeServerCollection(db)
 	err := serverCollection.FindOne(context.TODO(), bson.M{"server": serverNumber}).Decode(&server)
 	if err != nil {
-		return ServerSecrets{}, fmt.Errorf("NO_SERVER_FOUND")
+		return models.Server{}, fmt.Errorf("NO_SERVER_FOUND")
 	}
-
-	return ServerSecrets{
-		ApiKeyServer: server.APIKey,
-		Token:        server.Token,
-	}, nil
+	return server, nil
 }
 
 func searchCodes(codes []string, db *mongo.Database) ([]string, error) {
@@ -870,15 +627,37 @@ func HandleCancelOrder(c echo.Context) error {
 		"numberId": id,
 	}
 
-	deleteResult, err := orderCollection.DeleteOne(context.TODO(), filter)
+	var order models.Order
+	err = orderCollection.FindOne(context.TODO(), filter).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		fmt.Println("ERROR: No matching order found to cancel")
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "No matching order found"})
+	}
 	if err != nil {
-		fmt.Println("ERROR: Unable to delete the order:", err)
+		fmt.Println("ERROR: Unable to find the order:", err)
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to cancel the order"})
 	}
 
-	if deleteResult.DeletedCount == 0 {
-		fmt.Println("ERROR: No matching order found to delete")
-		return c.JSON(http.StatusNotFound, echo.Map{"error": "No matching order found"})
+	// The order is kept with its history; cancelling it refunds it once and
+	// tells the customer's streams and webhooks. An order that already ended
+	// is left as it is.
+	ctx := context.WithoutCancel(c.Request().Context())
+	err = RefundOrder(ctx, db, order, models.StateCancelled, "cancelled by customer")
+	if errors.Is(err, ErrInvalidTransition) {
+		return c.JSON(http.StatusOK, echo.Map{"message": "Order canceled successfully"})
+	}
+	if err != nil {
+		fmt.Println("ERROR: Unable to cancel the order:", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to cancel the order"})
+	}
+
+	var serverInfo models.Server
+	err = models.InitializeServerCollection(db).FindOne(ctx, bson.M{"server": order.Server}).Decode(&serverInfo)
+	if err == nil {
+		err = CancelNumberThirdParty(ctx, serverInfo, order.NumberID, order.Number)
+	}
+	if err != nil {
+		logs.Logger.Errorf("failed to cancel number %s upstream: %v", order.NumberID, err)
 	}
 	return c.JSON(http.StatusOK, echo.Map{"message": "Order canceled successfully"})
 }
@@ -1003,10 +782,16 @@ func HandleNumberCancel(c echo.Context) error {
 
 	var existingOrder models.Order
 	orderCollection := models.InitializeOrderCollection(db)
-	err = orderCollection.FindOne(context.TODO(), bson.M{"numberId": id}).Decode(&existingOrder)
+	err = orderCollection.FindOne(context.TODO(), bson.M{"numberId": id, "server": serverNumber}).Decode(&existingOrder)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"errror": "number already cancelled"})
 	}
+	if !models.CanTransition(existingOrder.Status, models.StateCancelled) {
+		if existingOrder.Status == models.StateSMSReceived || existingOrder.Status == models.StateFinished {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "otp already come"})
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "number already cancelled"})
+	}
 
 	var serverList models.ServerList
 	serverListollection := models.InitializeServerListCollection(db)
@@ -1068,19 +853,12 @@ func HandleNumberCancel(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "otp already come"})
 	}
 
-	constructedNumberRequest, err := ConstructNumberUrl(server, serverData.APIKey, serverData.Token, id, existingOrder.Number)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
-	}
-
-	err = CancelNumberThirdParty(constructedNumberRequest.URL, server, id, db, constructedNumberRequest.Headers)
+	err = CancelNumberThirdParty(context.WithoutCancel(c.Request().Context()), serverData, id, existingOrder.Number)
 	if err != nil {
 		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return c.JSON(http.StatusInternalServerError, providerErrorResponse(err))
 	}
 
-	formattedData := FormatDateTime()
 	var transaction models.TransactionHistory
 	err = transactionCollection.FindOne(context.TODO(), bson.M{"id": id}).Decode(&transaction)
 	if err != nil {
@@ -1098,53 +876,19 @@ func HandleNumberCancel(c echo.Context) error {
 	newBalance = math.Round(newBalance*100) / 100
 	price = math.Round(price*100) / 100
 
-	session, err := db.Client().StartSession()
-	if err != nil {
-		logs.Logger.Error("Failed to start session:", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction session"})
-	}
-	defer session.EndSession(context.Background())
-
-	_, err = session.WithTransaction(context.Background(), func(sc mongo.SessionContext) (interface{}, error) {
-		balanceUpdate := bson.M{
-			"$inc": bson.M{"balance": price},
-		}
-		balanceFilter := bson.M{"userId": apiWalletUser.UserID}
-		balanceResult, err := apiWalletColl.UpdateOne(sc, balanceFilter, balanceUpdate)
-		if err != nil {
-			return nil, err
-		}
-		if balanceResult.ModifiedCount == 0 {
-			return nil, errors.New("balance update failed, no document modified")
+	err = RefundOrder(context.Background(), db, existingOrder, models.StateCancelled, "cancelled by customer")
+	if errors.Is(err, ErrInvalidTransition) {
+		if !endedCancelled(context.Background(), db, existingOrder) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "number already cancelled"})
 		}
-
-		transactionUpdateFilter := bson.M{"id": id, "server": server}
-		transactionUpdate := bson.M{
-			"$set": bson.M{
-				"status":    "CANCELLED",
-				"date_time": formattedData,
-			},
-		}
-		transactionResult, err := transactionCollection.UpdateOne(sc, transactionUpdateFilter, transactionUpdate)
-		if err != nil {
-			return nil, err
-		}
-		if transactionResult.ModifiedCount == 0 {
-			return nil, errors.New("transaction status update failed, no document modified")
-		}
-		return nil, nil
-	})
+		// Cancelled, and refunded, by the provider in the meantime.
+		err = nil
+	}
 	if err != nil {
 		logs.Logger.Error("Transaction failed:", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
-
 	logs.Logger.Info("Transaction completed successfully")
-	_, err = orderCollection.DeleteOne(context.TODO(), bson.M{"numberId": id})
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "ORDER_NOT_FOUND"})
-	}
 
 	ipDetail, err := utils.ExtractIpDetails(c)
 	if err != nil {
@@ -1168,131 +912,22 @@ func HandleNumberCancel(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"status": "success"})
 }
 
-func CancelNumberThirdParty(apiURL, server, id string, db *mongo.Database, headers map[string]string) error {
-	logs.Logger.Infof("Number Cancel URL: %s", apiURL)
-	client := &http.Client{}
-
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create API request: %w", err)
-	}
-	for key, value := range headers {
-		req.Header.Set(key, value)
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to fetch API: %w", err)
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
-	}
-	responseData := string(body)
-	logs.Logger.Infof("Number Cancel Response %+v", responseData)
-
-	if strings.TrimSpace(responseData) == "" {
-		return errors.New("RECEIVED_EMTPY_RESPONSE_FROM_THIRD_PARTY_SERVER")
+// providerErrorResponse is the JSON body for a failed provider call. code is
+// a stable provider.ErrorCode clients can react to.
+func providerErrorResponse(err error) map[string]string {
+	return map[string]string{
+		"error": provider.MessageOf(err),
+		"code":  string(provider.CodeOf(err)),
 	}
+}
 
-	switch server {
-	case "1":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") {
-			return nil
-		} else if strings.HasPrefix(responseData, "ACCESS_APPROVED") {
-			return nil
-		} else if strings.HasPrefix(responseData, "ACCESS_CANCEL_ALREADY") {
-			return nil
-		} else if strings.HasPrefix(responseData, "STATUS_CANCEL") {
-			return nil
-		}
-		return errors.New("Failed Try Again")
-
-	case "2":
-		if strings.Contains(responseData, "order has sms") {
-			return nil
-		} else if strings.Contains(responseData, "order not found") {
-			return nil
-		}
-		var responseDataJSON map[string]interface{}
-		err = json.Unmarshal(body, &responseDataJSON)
-		if err != nil {
-			return fmt.Errorf("failed to parse JSON response: %w", err)
-		}
-		if responseDataJSON["status"] == "CANCELED" {
-			return nil
-		}
-		return errors.New("Failed Try Again")
-
-	case "3":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") || strings.HasPrefix(responseData, "ALREADY_CANCELLED") ||
-			strings.HasPrefix(responseData, "ACCESS_ACTIVATION") {
-			return nil
-		} else {
-			return errors.New("Failed Try Again")
-		}
-	case "4":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") {
-			return nil
-		} else if strings.HasPrefix(responseData, "EARLY_CANCEL_DENIED") {
-			return errors.New("EARLY_CANCEL_DENIED")
-		} else if strings.HasPrefix(responseData, "BAD_STATUS") {
-			return errors.New("BAD_STATUS")
-		}
-		return errors.New("Failed Try Again")
-	case "5":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") {
-			return nil
-		} else if strings.HasPrefix(responseData, "BAD_ACTION") {
-			return errors.New("BAD_ACTION")
-		}
-		return errors.New("Failed Try Again")
-	case "6":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") {
-			return nil
-		} else if strings.HasPrefix(responseData, "NO_ACTIVATION") {
-			return errors.New("NO_ACTIVATION")
-		}
-		return errors.New("Failed Try Again")
-	case "8":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") {
-			return nil
-		} else if strings.HasPrefix(responseData, "BAD_STATUS") {
-			return errors.New("BAD_STATUS")
-		}
-		return errors.New("Failed Try Again")
-	case "7":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") {
-			return nil
-		} else if strings.HasPrefix(responseData, "BAD_STATUS") {
-			return errors.New("BAD_STATUS")
-		}
-		return errors.New("Failed Try Again")
-	case "9":
-		if strings.HasPrefix(responseData, "success") {
-			return nil
-		}
-		return errors.New("Failed Try Again")
-	case "10":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") {
-			return nil
-		}
-		return errors.New("Failed Try Again")
-	case "11":
-		var responseDataJSON map[string]interface{}
-		err = json.Unmarshal(body, &responseDataJSON)
-		if err != nil {
-			return fmt.Errorf("failed to parse JSON response: %w", err)
-		}
-		if success, ok := responseDataJSON["success"].(bool); ok && success {
-			return nil
-		} else if responseDataJSON["error_code"] == "change_status" {
-			return nil
-		}
-		return errors.New("Failed Try Again")
-	default:
-		return errors.New("INVALID_SERVER_VALUE")
+// CancelNumberThirdParty releases the activation with the server's provider.
+func CancelNumberThirdParty(ctx context.Context, serverInfo models.Server, id, number string) error {
+	prov, err := provider.ForServer(serverInfo)
+	if err != nil {
+		return err
 	}
+	return prov.Cancel(ctx, serverCredentials(serverInfo), id, number)
 }
 
 func getServerDataWithMaintenanceCheck(db *mongo.Database, server string) (models.Server, error) {
@@ -1311,37 +946,10 @@ func getServerDataWithMaintenanceCheck(db *mongo.Database, server string) (model
 	return serverData, nil
 }
 
-func fetchOTP(server, id string, otpRequest ApiRequest) ([]string, error) {
-	otpData := []string{}
-	switch server {
-	case "1", "3", "4", "5", "6", "7", "8", "10":
-		otp, err := serversotpcalc.GetOTPServer1(otpRequest.URL, otpRequest.Headers, id)
-		if err != nil && err.Error() == "ACCESS_CANCEL" {
-			logs.Logger.Error(err)
-			return otpData, err
-		}
-		otpData = append(otpData, otp...)
-	case "2":
-		otp, err := serversotpcalc.GetSMSTextsServer2(otpRequest.URL, id, otpRequest.Headers)
-		if err != nil {
-			return otpData, err
-		}
-		otpData = append(otpData, otp...)
-	case "9":
-		otp, err := serversotpcalc.FetchTokenAndOTP(otpRequest.URL, id, otpRequest.Headers)
-		if err != nil {
-			return otpData, err
-		}
-		otpData = append(otpData, otp...)
-	case "11":
-		otp, err := serversotpcalc.GetOTPServer11(otpRequest.URL, id)
-		if err != nil {
-			return otpData, err
-		}
-		otpData = append(otpData, otp...)
-
-	default:
-		return otpData, fmt.Errorf("INVALID_SERVER_CHOICE")
+func fetchOTP(ctx context.Context, serverInfo models.Server, id string) ([]string, error) {
+	prov, err := provider.ForServer(serverInfo)
+	if err != nil {
+		return []string{}, err
 	}
-	return otpData, nil
+	return prov.GetOTP(ctx, serverCredentials(serverInfo), id)
 }
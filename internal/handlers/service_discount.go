@@ -12,6 +12,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -24,6 +25,7 @@ func AddServiceDiscount(c echo.Context) error {
 	type RequestBody struct {
 		Service  string  `json:"service"`
 		Server   string  `json:"server"`
+		Country  string  `json:"country"`
 		Discount float64 `json:"discount"`
 	}
 
@@ -62,8 +64,14 @@ func AddServiceDiscount(c echo.Context) error {
 	// Initialize collection
 	servicedDiscountCollection := models.InitializeServiceDiscountCollection(db)
 
+	// Discounts without a country apply to India
+	country := provider.NormalizeCountry(input.Country)
+	if _, err := provider.LookupCountry(country); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Country is not supported."})
+	}
+
 	// Check if the service discount exists
-	filter := bson.M{"service": input.Service, "server": serverNumber}
+	filter := bson.M{"service": input.Service, "server": serverNumber, "country": countryFilter(country)}
 	var existingService models.ServiceDiscount
 	err = servicedDiscountCollection.FindOne(context.TODO(), filter).Decode(&existingService)
 
@@ -73,6 +81,7 @@ func AddServiceDiscount(c echo.Context) error {
 		_, err = servicedDiscountCollection.InsertOne(context.TODO(), models.ServiceDiscount{
 			Service:  input.Service,
 			Server:   serverNumber,
+			Country:  country,
 			Discount: discount,
 		})
 		if err != nil {
@@ -169,6 +178,7 @@ func DeleteServiceDiscount(c echo.Context) error {
 	// Retrieve query parameters
 	service := c.QueryParam("service")
 	server := c.QueryParam("server")
+	country := provider.NormalizeCountry(c.QueryParam("country"))
 
 	// Log the received parameters
 	log.Printf("INFO: Received parameters - service: %s, server: %s\n", service, server)
@@ -198,7 +208,7 @@ func DeleteServiceDiscount(c echo.Context) error {
 	servicedDiscountCollection := models.InitializeServiceDiscountCollection(db)
 
 	// Define the filter for the document to delete
-	filter := bson.M{"service": service, "server": serverNumber}
+	filter := bson.M{"service": service, "server": serverNumber, "country": countryFilter(country)}
 	log.Printf("DEBUG: Filter being used for deletion: %+v\n", filter)
 
 	// Perform the delete operation
@@ -1188,7 +1188,8 @@ func GetOrdersByUserId(c echo.Context) error {
 	}
 
 	// Query to find orders for the userId and sort them by orderTime in descending order
-	filter := bson.M{"userId": userPrimitiveId}
+	filter := models.ActiveOrders()
+	filter["userId"] = userPrimitiveId
 	opts := options.Find().SetSort(bson.D{{Key: "orderTime", Value: -1}})
 
 	cursor, err := orderCol.Find(ctx, filter, opts)
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// HandleProviderWebhook receives SMS pushed by a server's provider. The
+// provider is configured to call /api/webhooks/:server?secret=<secret>, or
+// to send the secret in the X-Webhook-Secret header.
+func HandleProviderWebhook(c echo.Context) error {
+	ctx := context.Background()
+	db := c.Get("db").(*mongo.Database)
+	serverNumber, err := strconv.Atoi(c.Param("server"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid server number"})
+	}
+
+	serverInfo, err := getServerInfo(db, serverNumber)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "server not found"})
+	}
+	secret := c.Request().Header.Get("X-Webhook-Secret")
+	if secret == "" {
+		secret = c.QueryParam("secret")
+	}
+	if serverInfo.WebhookSecret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(serverInfo.WebhookSecret)) != 1 {
+		logs.Logger.Warnf("rejected webhook for server %d from %s", serverNumber, c.RealIP())
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid webhook secret"})
+	}
+
+	parser, err := provider.WebhookParserFor(serverInfo)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+	id, smsList, err := parser.ParseWebhook(body)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	var transaction models.TransactionHistory
+	transactionCollection := models.InitializeTransactionHistoryCollection(db)
+	err = transactionCollection.FindOne(ctx, bson.M{"id": id, "server": strconv.Itoa(serverNumber)}).Decode(&transaction)
+	if err == mongo.ErrNoDocuments {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "transaction not found"})
+	}
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	}
+	if transaction.Status == "CANCELLED" {
+		return c.JSON(http.StatusOK, map[string]string{"status": "ignored"})
+	}
+
+	for _, sms := range smsList {
+		_, err := storeOtp(ctx, db, transaction, sms, "webhook from "+c.RealIP())
+		if err != nil {
+			logs.Logger.Error(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// UpdateWebhookSecret sets the secret a server's provider must send with its
+// webhooks. An empty secret disables webhooks for the server.
+func UpdateWebhookSecret(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	serverCollection := models.InitializeServerCollection(db)
+
+	type RequestBody struct {
+		Server string `json:"server"`
+		Secret string `json:"secret"`
+	}
+	var input RequestBody
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+	server, err := strconv.Atoi(input.Server)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Server must be a valid number"})
+	}
+
+	update := bson.M{"$set": bson.M{"webhookSecret": input.Secret}}
+	if input.Secret == "" {
+		update = bson.M{"$unset": bson.M{"webhookSecret": ""}}
+	}
+	result, err := serverCollection.UpdateOne(context.Background(), bson.M{"server": server}, update)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+	if result.MatchedCount == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": "Webhook secret updated successfully."})
+}
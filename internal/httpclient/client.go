@@ -0,0 +1,232 @@
+// Package httpclient is the single client every outbound call to an upstream
+// provider or third party API goes through. It applies per-host timeouts,
+// retries idempotent calls, routes through an optional proxy, honours the
+// caller's context, keeps per-host call statistics and can trace the
+// exchanges of a call for auditing. URLs are only ever logged or traced with
+// their credentials redacted.
+//
+// It is configured from the environment:
+//
+//	UPSTREAM_TIMEOUT   default timeout of one attempt, e.g. "15s"
+//	UPSTREAM_TIMEOUTS  per-host timeouts, e.g. "5sim.net=20s,api.sms-man.com=10s"
+//	UPSTREAM_RETRIES   extra attempts for idempotent calls (default 2)
+//	UPSTREAM_PROXY     proxy URL for every upstream call (http, https or socks5)
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/logs"
+)
+
+const (
+	defaultTimeout = 15 * time.Second
+	defaultRetries = 2
+	retryBackoff   = 200 * time.Millisecond
+)
+
+var (
+	configOnce   sync.Once
+	client       *http.Client
+	publicClient *http.Client
+	timeout      = defaultTimeout
+	retries      = defaultRetries
+
+	hostTimeouts   = make(map[string]time.Duration)
+	hostTimeoutsMu sync.RWMutex
+)
+
+func configure() {
+	configOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if value := os.Getenv("UPSTREAM_PROXY"); value != "" {
+			proxyURL, err := url.Parse(value)
+			if err != nil {
+				logs.Logger.Errorf("invalid UPSTREAM_PROXY: %v", err)
+			} else {
+				transport.Proxy = http.ProxyURL(proxyURL)
+			}
+		}
+		client = &http.Client{Transport: transport}
+		publicClient = newPublicClient()
+
+		if value := os.Getenv("UPSTREAM_TIMEOUT"); value != "" {
+			if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+				timeout = parsed
+			} else {
+				logs.Logger.Errorf("invalid UPSTREAM_TIMEOUT %q", value)
+			}
+		}
+		if value := os.Getenv("UPSTREAM_RETRIES"); value != "" {
+			if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+				retries = parsed
+			} else {
+				logs.Logger.Errorf("invalid UPSTREAM_RETRIES %q", value)
+			}
+		}
+		for _, entry := range strings.Split(os.Getenv("UPSTREAM_TIMEOUTS"), ",") {
+			host, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok {
+				continue
+			}
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				logs.Logger.Errorf("invalid UPSTREAM_TIMEOUTS entry %q", entry)
+				continue
+			}
+			SetTimeout(host, parsed)
+		}
+	})
+}
+
+// SetTimeout sets the timeout of one attempt against a host, overriding
+// UPSTREAM_TIMEOUT.
+func SetTimeout(host string, d time.Duration) {
+	hostTimeoutsMu.Lock()
+	defer hostTimeoutsMu.Unlock()
+	hostTimeouts[strings.ToLower(host)] = d
+}
+
+func timeoutFor(host string) time.Duration {
+	hostTimeoutsMu.RLock()
+	defer hostTimeoutsMu.RUnlock()
+	if d, ok := hostTimeouts[strings.ToLower(host)]; ok {
+		return d
+	}
+	return timeout
+}
+
+// Get fetches a URL, retrying on network errors and 5xx or 429 answers. Use
+// it only for reads; calls that change state upstream go through GetOnce.
+// The body is returned with the status code for any HTTP answer.
+func Get(ctx context.Context, rawURL string, headers map[string]string) ([]byte, int, error) {
+	configure()
+	return do(ctx, client, http.MethodGet, rawURL, headers, nil, retries)
+}
+
+// GetOnce fetches a URL without retrying, for GET endpoints that are not
+// idempotent, such as buying a number or sending a message.
+func GetOnce(ctx context.Context, rawURL string, headers map[string]string) ([]byte, int, error) {
+	configure()
+	return do(ctx, client, http.MethodGet, rawURL, headers, nil, 0)
+}
+
+// Post sends a body without retrying.
+func Post(ctx context.Context, rawURL, contentType string, body []byte, headers map[string]string) ([]byte, int, error) {
+	configure()
+	withType := map[string]string{"Content-Type": contentType}
+	for key, value := range headers {
+		withType[key] = value
+	}
+	return do(ctx, client, http.MethodPost, rawURL, withType, body, 0)
+}
+
+// PostPublic sends a body without retrying to a URL given by a customer. It
+// only connects to public addresses, so such a URL cannot reach the
+// internal network, and never goes through UPSTREAM_PROXY.
+func PostPublic(ctx context.Context, rawURL, contentType string, body []byte, headers map[string]string) ([]byte, int, error) {
+	configure()
+	withType := map[string]string{"Content-Type": contentType}
+	for key, value := range headers {
+		withType[key] = value
+	}
+	return do(ctx, publicClient, http.MethodPost, rawURL, withType, body, 0)
+}
+
+func do(ctx context.Context, client *http.Client, method, rawURL string, headers map[string]string, body []byte, retries int) ([]byte, int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid upstream url %s: %w", Redact(rawURL), err)
+	}
+	host := parsed.Hostname()
+
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			record(host, 0, nil, true)
+			select {
+			case <-ctx.Done():
+				return nil, 0, ctx.Err()
+			case <-time.After(retryBackoff << (attempt - 1)):
+			}
+		}
+
+		start := time.Now()
+		respBody, status, err := send(ctx, client, method, rawURL, host, headers, body)
+		latency := time.Since(start)
+		record(host, latency, err, false)
+		traceExchange(ctx, Exchange{
+			Method:    method,
+			URL:       Redact(rawURL),
+			Status:    status,
+			Latency:   latency,
+			Attempt:   attempt + 1,
+			StartedAt: start,
+		}, respBody, err)
+		logs.Logger.Debugf("upstream %s %s -> %d in %s (attempt %d): %v", method, Redact(rawURL), status, latency.Round(time.Millisecond), attempt+1, err)
+
+		if err == nil && status < 500 && status != http.StatusTooManyRequests {
+			return respBody, status, nil
+		}
+		if err == nil {
+			lastErr = fmt.Errorf("upstream %s answered %d", host, status)
+			if attempt == retries {
+				return respBody, status, nil
+			}
+			continue
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, 0, lastErr
+}
+
+// send makes a single attempt bounded by the host's timeout.
+func send(ctx context.Context, client *http.Client, method, rawURL, host string, headers map[string]string, body []byte) ([]byte, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeoutFor(host))
+	defer cancel()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, reader)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The url in *url.Error carries the credentials; report it redacted.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = Redact(urlErr.URL)
+			return nil, 0, urlErr
+		}
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return respBody, resp.StatusCode, nil
+}
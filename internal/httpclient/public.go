@@ -0,0 +1,64 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrNotPublic is returned for a host or connection that is not on a public
+// address.
+var ErrNotPublic = errors.New("address is not public")
+
+// isPublic reports whether ip is a routable public address: not loopback,
+// private, link-local (which holds cloud metadata endpoints such as
+// 169.254.169.254), multicast or unspecified.
+func isPublic(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsMulticast())
+}
+
+// CheckPublicHost resolves a host and returns ErrNotPublic unless every
+// address it resolves to is public.
+func CheckPublicHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !isPublic(addr.IP) {
+			return fmt.Errorf("%s resolves to %s: %w", host, addr.IP, ErrNotPublic)
+		}
+	}
+	return nil
+}
+
+// newPublicClient returns a client that refuses to connect to an address
+// that is not public. The address is checked as it is dialed, after
+// resolution, so a host cannot pass a check and then resolve elsewhere, and
+// redirects are held to the same rule.
+func newPublicClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !isPublic(ip) {
+				return fmt.Errorf("dial %s: %w", address, ErrNotPublic)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Transport: transport}
+}
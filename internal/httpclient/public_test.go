@@ -0,0 +1,48 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":          true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"fe80::1":          false,
+		"fd00::1":          false,
+		"0.0.0.0":          false,
+		"224.0.0.1":        false,
+		"::ffff:127.0.0.1": false,
+	}
+	for addr, want := range tests {
+		if got := isPublic(net.ParseIP(addr)); got != want {
+			t.Errorf("isPublic(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestPostPublicRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback server")
+	}))
+	defer server.Close()
+
+	_, _, err := PostPublic(context.Background(), server.URL, "application/json", []byte("{}"), nil)
+	if !errors.Is(err, ErrNotPublic) {
+		t.Fatalf("got %v, want ErrNotPublic", err)
+	}
+	if err := CheckPublicHost(context.Background(), "localhost"); !errors.Is(err, ErrNotPublic) {
+		t.Fatalf("CheckPublicHost(localhost) = %v, want ErrNotPublic", err)
+	}
+}
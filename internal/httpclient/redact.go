@@ -0,0 +1,41 @@
+package httpclient
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// secretParams are query parameters that carry credentials.
+var secretParams = map[string]bool{
+	"api_key":      true,
+	"apikey":       true,
+	"key":          true,
+	"token":        true,
+	"access_token": true,
+	"secret":       true,
+	"password":     true,
+}
+
+// botToken matches the Telegram bot token path segment.
+var botToken = regexp.MustCompile(`/bot[0-9]+:[A-Za-z0-9_-]+`)
+
+// Redact masks credentials in a URL so it can be logged.
+func Redact(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "<invalid url>"
+	}
+	query := parsed.Query()
+	for name := range query {
+		if secretParams[strings.ToLower(name)] {
+			query.Set(name, "REDACTED")
+		}
+	}
+	parsed.RawQuery = query.Encode()
+	if parsed.User != nil {
+		parsed.User = url.User("REDACTED")
+	}
+	redacted := parsed.String()
+	return botToken.ReplaceAllString(redacted, "/botREDACTED")
+}
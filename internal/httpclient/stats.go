@@ -0,0 +1,65 @@
+package httpclient
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// HostStats are the outbound call statistics for one upstream host since
+// start up.
+type HostStats struct {
+	Host         string    `json:"host"`
+	Requests     int       `json:"requests"`
+	Failures     int       `json:"failures"`
+	Retries      int       `json:"retries"`
+	AvgLatencyMs float64   `json:"avgLatencyMs"`
+	LastError    string    `json:"lastError,omitempty"`
+	LastErrorAt  time.Time `json:"lastErrorAt,omitempty"`
+
+	totalLatency time.Duration
+}
+
+var (
+	stats   = make(map[string]*HostStats)
+	statsMu sync.Mutex
+)
+
+func record(host string, latency time.Duration, err error, retry bool) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	s, ok := stats[host]
+	if !ok {
+		s = &HostStats{Host: host}
+		stats[host] = s
+	}
+	if retry {
+		s.Retries++
+		return
+	}
+	s.Requests++
+	s.totalLatency += latency
+	if err != nil {
+		s.Failures++
+		s.LastError = err.Error()
+		s.LastErrorAt = time.Now()
+	}
+}
+
+// Stats returns the statistics of every host called so far, by host name.
+func Stats() []HostStats {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	report := make([]HostStats, 0, len(stats))
+	for _, s := range stats {
+		entry := *s
+		if entry.Requests > 0 {
+			entry.AvgLatencyMs = float64(entry.totalLatency.Milliseconds()) / float64(entry.Requests)
+		}
+		report = append(report, entry)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Host < report[j].Host
+	})
+	return report
+}
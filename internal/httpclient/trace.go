@@ -0,0 +1,68 @@
+package httpclient
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxTracedBody is how much of a response body a trace keeps.
+const maxTracedBody = 2048
+
+// Exchange is one attempt of an outbound call, with credentials redacted
+// from the URL and the response body truncated.
+type Exchange struct {
+	Method    string
+	URL       string
+	Status    int
+	Latency   time.Duration
+	Body      string
+	Error     string
+	Attempt   int
+	StartedAt time.Time
+}
+
+// Trace collects the exchanges of the calls made with its context.
+type Trace struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+}
+
+type traceKey struct{}
+
+// WithTrace returns a context whose calls are collected in the returned
+// trace.
+func WithTrace(ctx context.Context) (context.Context, *Trace) {
+	trace := &Trace{}
+	return context.WithValue(ctx, traceKey{}, trace), trace
+}
+
+// WithoutTrace returns a context whose calls are left out of any trace of
+// ctx, for calls whose answers carry secrets.
+func WithoutTrace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, traceKey{}, (*Trace)(nil))
+}
+
+// Exchanges returns the exchanges collected so far, in call order.
+func (t *Trace) Exchanges() []Exchange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Exchange(nil), t.exchanges...)
+}
+
+func traceExchange(ctx context.Context, exchange Exchange, body []byte, err error) {
+	trace, ok := ctx.Value(traceKey{}).(*Trace)
+	if !ok || trace == nil {
+		return
+	}
+	if len(body) > maxTracedBody {
+		body = body[:maxTracedBody]
+	}
+	exchange.Body = string(body)
+	if err != nil {
+		exchange.Error = err.Error()
+	}
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	trace.exchanges = append(trace.exchanges, exchange)
+}
@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+)
+
+// OpActivations is the listing of a server's activations in the upstream
+// audit trail.
+const OpActivations = "activations"
+
+// Activation states as reported by a provider.
+const (
+	ActivationActive    = "ACTIVE"
+	ActivationFinished  = "FINISHED"
+	ActivationCancelled = "CANCELLED"
+)
+
+// Activation is an activation as the provider sees it. Number is as the
+// provider sends it, possibly with the country calling code.
+type Activation struct {
+	ID        string
+	Number    string
+	Code      string
+	Status    string
+	CreatedAt time.Time
+}
+
+// ActivationLister is implemented by providers that can list the
+// activations on our account.
+type ActivationLister interface {
+	// Activations lists our recent activations. Providers that only list
+	// running activations return those, all ActivationActive.
+	Activations(ctx context.Context, cred Credentials) ([]Activation, error)
+}
+
+// ActivationListerFor returns the activation listing of a server's
+// provider, held to the server's limits like CatalogerFor.
+func ActivationListerFor(server models.Server) (ActivationLister, error) {
+	p, err := resolve(server)
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := p.(ActivationLister)
+	if !ok {
+		return nil, fmt.Errorf("ACTIVATIONS_NOT_SUPPORTED")
+	}
+	SetLimits(server.ServerNumber, server.RateLimit, server.MaxInFlight)
+	return &limitedLister{server: server.ServerNumber, ActivationLister: lister}, nil
+}
+
+// limitedLister applies a server's limits to its activation listing and
+// sends the exchanges to the audit trail.
+type limitedLister struct {
+	server int
+	ActivationLister
+}
+
+func (l *limitedLister) Activations(ctx context.Context, cred Credentials) ([]Activation, error) {
+	release, err := limiterFor(l.server).acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ctx, audit := traced(ctx, l.server, OpActivations)
+	defer audit("")
+	return l.ActivationLister.Activations(ctx, cred)
+}
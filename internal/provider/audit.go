@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
+)
+
+// Operations recorded in the upstream audit trail.
+const (
+	OpBuyNumber = "buy_number"
+	OpGetOTP    = "get_otp"
+	OpCancel    = "cancel"
+	OpNextSMS   = "next_sms"
+	OpBalance   = "balance"
+	OpPrices    = "prices"
+)
+
+// Exchange is one request to a server's provider and its answer, made for
+// an operation on an activation. Balance and price calls have no activation.
+type Exchange struct {
+	Server       int
+	Operation    string
+	ActivationID string
+	httpclient.Exchange
+}
+
+var (
+	exchangeFns   []func([]Exchange)
+	exchangeFnsMu sync.RWMutex
+)
+
+// OnExchanges registers fn to be called with the exchanges of every provider
+// call once it is done. fn is called on the caller's goroutine and must not
+// block.
+func OnExchanges(fn func([]Exchange)) {
+	exchangeFnsMu.Lock()
+	defer exchangeFnsMu.Unlock()
+	exchangeFns = append(exchangeFns, fn)
+}
+
+// traced returns a context collecting the exchanges of a call, and the func
+// that hands them to the OnExchanges callbacks.
+func traced(ctx context.Context, server int, operation string) (context.Context, func(activationID string)) {
+	ctx, trace := httpclient.WithTrace(ctx)
+	return ctx, func(activationID string) {
+		exchanges := trace.Exchanges()
+		if len(exchanges) == 0 {
+			return
+		}
+		records := make([]Exchange, 0, len(exchanges))
+		for _, exchange := range exchanges {
+			records = append(records, Exchange{
+				Server:       server,
+				Operation:    operation,
+				ActivationID: activationID,
+				Exchange:     exchange,
+			})
+		}
+		exchangeFnsMu.RLock()
+		defer exchangeFnsMu.RUnlock()
+		for _, fn := range exchangeFns {
+			fn(records)
+		}
+	}
+}
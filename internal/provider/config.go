@@ -0,0 +1,70 @@
+package provider
+
+import (
+	"fmt"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+)
+
+// FromConfig builds a provider from a declarative server config.
+func FromConfig(cfg models.ProviderConfig) (Provider, error) {
+	switch cfg.Protocol {
+	case ProtocolHandlerAPI:
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("MISSING_PROVIDER_BASE_URL")
+		}
+		if baseURL := redirected(); baseURL != "" {
+			cfg = redirectConfig(cfg, baseURL)
+		}
+		return NewHandlerAPI(cfg), nil
+	default:
+		return nil, fmt.Errorf("UNSUPPORTED_PROVIDER_PROTOCOL")
+	}
+}
+
+// ForServer returns the provider for a server document. A provider config
+// stored on the document wins over the built-in registry entry. Calls made
+// through it are held to the server's rate limit and in-flight cap and feed
+// the server's health and circuit breaker.
+func ForServer(server models.Server) (Provider, error) {
+	p, err := resolve(server)
+	if err != nil {
+		return nil, err
+	}
+	SetLimits(server.ServerNumber, server.RateLimit, server.MaxInFlight)
+	return &monitored{server: server.ServerNumber, Provider: p}, nil
+}
+
+// WebhookParserFor returns the webhook parser of a server's provider.
+func WebhookParserFor(server models.Server) (WebhookParser, error) {
+	p, err := resolve(server)
+	if err != nil {
+		return nil, err
+	}
+	parser, ok := p.(WebhookParser)
+	if !ok {
+		return nil, fmt.Errorf("WEBHOOK_NOT_SUPPORTED")
+	}
+	return parser, nil
+}
+
+// CatalogerFor returns the price list source of a server's provider.
+func CatalogerFor(server models.Server) (Cataloger, error) {
+	p, err := resolve(server)
+	if err != nil {
+		return nil, err
+	}
+	cataloger, ok := p.(Cataloger)
+	if !ok {
+		return nil, fmt.Errorf("CATALOG_NOT_SUPPORTED")
+	}
+	SetLimits(server.ServerNumber, server.RateLimit, server.MaxInFlight)
+	return &limitedCataloger{server: server.ServerNumber, Cataloger: cataloger}, nil
+}
+
+func resolve(server models.Server) (Provider, error) {
+	if server.Provider != nil && server.Provider.Protocol != "" {
+		return FromConfig(*server.Provider)
+	}
+	return Get(server.ServerNumber)
+}
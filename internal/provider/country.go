@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"sort"
+	"strings"
+)
+
+// DefaultCountry is the country of catalog entries, discounts and orders that
+// do not name one. Everything was sold in India before countries existed.
+const DefaultCountry = "IN"
+
+// Country is one of the countries we sell numbers in, keyed by its ISO 3166
+// alpha-2 code, with the code each provider protocol uses for it. An empty
+// provider code means the protocol does not sell the country.
+type Country struct {
+	CallingCode string
+	// HandlerAPI is the sms-activate country id used by handler_api providers.
+	HandlerAPI string
+	FiveSim    string
+	SmsMan     string
+}
+
+var countries = map[string]Country{
+	"IN": {CallingCode: "91", HandlerAPI: "22", FiveSim: "india", SmsMan: "14"},
+	"RU": {CallingCode: "7", HandlerAPI: "0", FiveSim: "russia"},
+	"UA": {CallingCode: "380", HandlerAPI: "1", FiveSim: "ukraine"},
+	"KZ": {CallingCode: "7", HandlerAPI: "2", FiveSim: "kazakhstan"},
+	"PH": {CallingCode: "63", HandlerAPI: "4", FiveSim: "philippines"},
+	"ID": {CallingCode: "62", HandlerAPI: "6", FiveSim: "indonesia"},
+	"MY": {CallingCode: "60", HandlerAPI: "7", FiveSim: "malaysia"},
+	"VN": {CallingCode: "84", HandlerAPI: "10", FiveSim: "vietnam"},
+	"GB": {CallingCode: "44", HandlerAPI: "16", FiveSim: "england"},
+	"NG": {CallingCode: "234", HandlerAPI: "19", FiveSim: "nigeria"},
+	"BD": {CallingCode: "880", HandlerAPI: "60", FiveSim: "bangladesh"},
+	"PK": {CallingCode: "92", HandlerAPI: "66", FiveSim: "pakistan"},
+	"BR": {CallingCode: "55", HandlerAPI: "73", FiveSim: "brazil"},
+	"US": {CallingCode: "1", HandlerAPI: "187", FiveSim: "usa"},
+}
+
+// NormalizeCountry upper-cases an ISO country code, mapping the empty code to
+// DefaultCountry.
+func NormalizeCountry(iso string) string {
+	iso = strings.ToUpper(strings.TrimSpace(iso))
+	if iso == "" {
+		return DefaultCountry
+	}
+	return iso
+}
+
+// LookupCountry returns a country by ISO code.
+func LookupCountry(iso string) (Country, error) {
+	country, ok := countries[NormalizeCountry(iso)]
+	if !ok {
+		return Country{}, ErrCountryNotSupported
+	}
+	return country, nil
+}
+
+// Countries returns the ISO codes of every known country, sorted.
+func Countries() []string {
+	codes := make([]string, 0, len(countries))
+	for code := range countries {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// nationalNumber strips the leading + and calling code from a number, so
+// numbers are stored the same way whichever provider sold them.
+func nationalNumber(number, callingCode string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(number, "+"), callingCode)
+}
+
+// countryCode picks a provider's code for a country: an explicit override
+// first, then the provider's own default for DefaultCountry, then the shared
+// table.
+func countryCode(iso string, overrides map[string]string, fallback, tableCode string) (string, error) {
+	if code := overrides[iso]; code != "" {
+		return code, nil
+	}
+	if iso == DefaultCountry && fallback != "" {
+		return fallback, nil
+	}
+	if tableCode == "" {
+		return "", ErrCountryNotSupported
+	}
+	return tableCode, nil
+}
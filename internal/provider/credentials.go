@@ -0,0 +1,158 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
+)
+
+// Token is a short lived credential obtained from a provider with our API
+// key. A zero ExpiresAt means the provider did not say and the refresher's
+// TokenLifetime applies.
+type Token struct {
+	Value     string
+	ExpiresAt time.Time
+}
+
+// TokenRefresher is implemented by providers whose calls authenticate with a
+// token obtained from the API key instead of the API key itself.
+type TokenRefresher interface {
+	// RefreshToken obtains a new token.
+	RefreshToken(ctx context.Context, cred Credentials) (Token, error)
+	// TokenLifetime is how long a token lives.
+	TokenLifetime() time.Duration
+}
+
+// refreshBefore is the share of a token's lifetime left at which it is
+// refreshed ahead of expiry.
+const refreshBefore = 0.25
+
+// TokenRefresherFor returns the token refresher of a server's provider.
+func TokenRefresherFor(server models.Server) (TokenRefresher, error) {
+	p, err := resolve(server)
+	if err != nil {
+		return nil, err
+	}
+	refresher, ok := p.(TokenRefresher)
+	if !ok {
+		return nil, fmt.Errorf("TOKEN_REFRESH_NOT_SUPPORTED")
+	}
+	return refresher, nil
+}
+
+// TokenDue reports whether the server's token should be refreshed now: it is
+// missing, has no known expiry, or is within the last quarter of its life.
+func TokenDue(server models.Server, refresher TokenRefresher) bool {
+	if server.Token == "" || server.TokenExpiresAt.IsZero() {
+		return true
+	}
+	lifetime := refresher.TokenLifetime()
+	return time.Until(server.TokenExpiresAt) < time.Duration(float64(lifetime)*refreshBefore)
+}
+
+// TokenRefresh is the outcome of a token refresh, handed to the
+// OnTokenRefresh callbacks so the token can be stored.
+type TokenRefresh struct {
+	Server int
+	Token  Token
+	Err    error
+	At     time.Time
+}
+
+var (
+	tokenFns   []func(TokenRefresh)
+	tokenFnsMu sync.RWMutex
+
+	// tokenLocks serialises refreshes per server, and lastTokens lets calls
+	// that failed on the same stale token reuse the refresh that ran first.
+	tokenLocks = make(map[int]*sync.Mutex)
+	lastTokens = make(map[int]TokenRefresh)
+	tokenMu    sync.Mutex
+)
+
+// OnTokenRefresh registers fn to be called after every token refresh,
+// successful or not. fn is called on the refreshing goroutine, before the new
+// token is used.
+func OnTokenRefresh(fn func(TokenRefresh)) {
+	tokenFnsMu.Lock()
+	defer tokenFnsMu.Unlock()
+	tokenFns = append(tokenFns, fn)
+}
+
+// RefreshToken obtains a new token for a server and reports it to the
+// OnTokenRefresh callbacks.
+func RefreshToken(ctx context.Context, server models.Server) (Token, error) {
+	refresher, err := TokenRefresherFor(server)
+	if err != nil {
+		return Token{}, err
+	}
+	return refreshToken(ctx, server.ServerNumber, refresher, Credentials{APIKey: server.APIKey, Token: server.Token})
+}
+
+// refreshToken obtains a token to replace the one in cred. A token already
+// refreshed by another call since cred was read is reused.
+func refreshToken(ctx context.Context, server int, refresher TokenRefresher, cred Credentials) (Token, error) {
+	tokenMu.Lock()
+	lock, ok := tokenLocks[server]
+	if !ok {
+		lock = &sync.Mutex{}
+		tokenLocks[server] = lock
+	}
+	tokenMu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	tokenMu.Lock()
+	last, ok := lastTokens[server]
+	tokenMu.Unlock()
+	if ok && last.Err == nil && last.Token.Value != cred.Token && time.Since(last.At) < time.Minute {
+		return last.Token, nil
+	}
+
+	// The answer holds the new token, so it is kept out of the upstream audit.
+	token, err := refresher.RefreshToken(httpclient.WithoutTrace(ctx), cred)
+	if err == nil && token.Value == "" {
+		err = errors.New("EMPTY_TOKEN")
+	}
+	if err == nil && token.ExpiresAt.IsZero() {
+		token.ExpiresAt = time.Now().Add(refresher.TokenLifetime())
+	}
+	refresh := TokenRefresh{Server: server, Token: token, Err: err, At: time.Now()}
+
+	tokenMu.Lock()
+	lastTokens[server] = refresh
+	tokenMu.Unlock()
+
+	tokenFnsMu.RLock()
+	for _, fn := range tokenFns {
+		fn(refresh)
+	}
+	tokenFnsMu.RUnlock()
+
+	if err != nil {
+		return Token{}, err
+	}
+	return token, nil
+}
+
+// withFreshToken runs call, and runs it once more with a new token if the
+// provider refreshes tokens and rejected the one in cred.
+func (m *monitored) withFreshToken(ctx context.Context, cred Credentials, call func(Credentials) error) error {
+	err := call(cred)
+	refresher, ok := m.Provider.(TokenRefresher)
+	if !ok || !errors.Is(err, ErrBadKey) {
+		return err
+	}
+	token, refreshErr := refreshToken(ctx, m.server, refresher, cred)
+	if refreshErr != nil {
+		return err
+	}
+	cred.Token = token.Value
+	return call(cred)
+}
@@ -0,0 +1,65 @@
+package provider
+
+import "github.com/ranjankuldeep/fakeNumber/internal/database/models"
+
+// ISO 4217 codes of the currencies providers bill in. Prices shown to
+// customers are in CurrencyINR.
+const (
+	CurrencyINR = "INR"
+	CurrencyRUB = "RUB"
+	CurrencyUSD = "USD"
+)
+
+// currencySymbols are the symbols balances are shown with.
+var currencySymbols = map[string]string{
+	CurrencyINR: "₹",
+	CurrencyRUB: "p",
+	CurrencyUSD: "$",
+}
+
+// CurrencySymbol returns the symbol a currency is shown with, or the code
+// itself for currencies without one.
+func CurrencySymbol(code string) string {
+	if symbol, ok := currencySymbols[code]; ok {
+		return symbol
+	}
+	return code
+}
+
+// currencyOfSymbol maps the symbol of a provider config that predates
+// currencies back to its currency.
+func currencyOfSymbol(symbol string) string {
+	for code, s := range currencySymbols {
+		if s == symbol {
+			return code
+		}
+	}
+	return ""
+}
+
+// balanceIn is a balance in a currency, shown with its symbol.
+func balanceIn(value float64, currency string) Balance {
+	return Balance{Value: value, Symbol: CurrencySymbol(currency), Currency: currency}
+}
+
+// Biller is implemented by providers that know the currency they bill in.
+type Biller interface {
+	Currency() string
+}
+
+// CurrencyFor returns the currency a server's provider bills in: the
+// server's own Currency when an admin set one, else the provider's. It is
+// empty when neither is known.
+func CurrencyFor(server models.Server) string {
+	if server.Currency != "" {
+		return server.Currency
+	}
+	p, err := resolve(server)
+	if err != nil {
+		return ""
+	}
+	if biller, ok := p.(Biller); ok {
+		return biller.Currency()
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package provider
+
+import "errors"
+
+// ErrorCode is a stable, machine-readable provider error code returned to API
+// clients alongside the error message.
+type ErrorCode string
+
+const (
+	CodeNoNumbers           ErrorCode = "NO_NUMBERS"
+	CodeProviderBalanceLow  ErrorCode = "PROVIDER_BALANCE_LOW"
+	CodeBadKey              ErrorCode = "BAD_KEY"
+	CodePriceAboveMax       ErrorCode = "PRICE_ABOVE_MAX"
+	CodeServiceBanned       ErrorCode = "SERVICE_BANNED"
+	CodeEarlyCancelDenied   ErrorCode = "EARLY_CANCEL_DENIED"
+	CodeAlreadyFinished     ErrorCode = "ALREADY_FINISHED"
+	CodeServerDegraded      ErrorCode = "SERVER_DEGRADED"
+	CodeCountryUnsupported  ErrorCode = "COUNTRY_NOT_SUPPORTED"
+	CodeOperatorUnsupported ErrorCode = "OPERATOR_NOT_SUPPORTED"
+	CodeRateLimited         ErrorCode = "RATE_LIMITED"
+	CodeUnexpected          ErrorCode = "UNEXPECTED"
+)
+
+// Error is a provider failure mapped to one of the error codes. Message is
+// safe to show to customers; Err keeps the upstream cause for the logs.
+type Error struct {
+	Code    ErrorCode
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches any provider error with the same code, so callers can use
+// errors.Is(err, provider.ErrNoNumbers).
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+var (
+	ErrNoNumbers            = &Error{Code: CodeNoNumbers, Message: "no stock"}
+	ErrProviderBalanceLow   = &Error{Code: CodeProviderBalanceLow, Message: "PROVIDER_BALANCE_LOW"}
+	ErrBadKey               = &Error{Code: CodeBadKey, Message: "BAD_KEY"}
+	ErrPriceAboveMax        = &Error{Code: CodePriceAboveMax, Message: "PRICE_ABOVE_MAX"}
+	ErrServiceBanned        = &Error{Code: CodeServiceBanned, Message: "SERVICE_BANNED"}
+	ErrEarlyCancelDenied    = &Error{Code: CodeEarlyCancelDenied, Message: "EARLY_CANCEL_DENIED"}
+	ErrAlreadyFinished      = &Error{Code: CodeAlreadyFinished, Message: "ALREADY_FINISHED"}
+	ErrServerDegraded       = &Error{Code: CodeServerDegraded, Message: "SERVER_DEGRADED"}
+	ErrCountryNotSupported  = &Error{Code: CodeCountryUnsupported, Message: "COUNTRY_NOT_SUPPORTED"}
+	ErrOperatorNotSupported = &Error{Code: CodeOperatorUnsupported, Message: "OPERATOR_NOT_SUPPORTED"}
+	ErrRateLimited          = &Error{Code: CodeRateLimited, Message: "Server busy, try again"}
+	ErrUnexpected           = &Error{Code: CodeUnexpected, Message: "Failed Try Again"}
+)
+
+// wrap returns a copy of a sentinel error carrying the upstream cause.
+func wrap(sentinel *Error, cause error) error {
+	return &Error{Code: sentinel.Code, Message: sentinel.Message, Err: cause}
+}
+
+// unexpected wraps a cause no provider mapping recognised.
+func unexpected(cause error) error {
+	if cause == nil {
+		return ErrUnexpected
+	}
+	var providerErr *Error
+	if errors.As(cause, &providerErr) {
+		return cause
+	}
+	return wrap(ErrUnexpected, cause)
+}
+
+// CodeOf returns the error code of err, CodeUnexpected for untyped errors.
+func CodeOf(err error) ErrorCode {
+	var providerErr *Error
+	if errors.As(err, &providerErr) {
+		return providerErr.Code
+	}
+	return CodeUnexpected
+}
+
+// MessageOf returns the customer facing message of err.
+func MessageOf(err error) string {
+	var providerErr *Error
+	if errors.As(err, &providerErr) {
+		return providerErr.Message
+	}
+	return err.Error()
+}
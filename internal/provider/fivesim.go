@@ -0,0 +1,235 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	serverscalc "github.com/ranjankuldeep/fakeNumber/internal/serversCalc"
+	serversotpcalc "github.com/ranjankuldeep/fakeNumber/internal/serversOtpCalc"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+)
+
+// FiveSim speaks the 5sim.net REST v1 API. Purchases are authorised with the
+// server api key, every other call with the server token. Country is the 5sim
+// name of India, the default country.
+type FiveSim struct {
+	BaseURL string
+	Country string
+}
+
+func (f *FiveSim) country(iso string) (string, Country, error) {
+	iso = NormalizeCountry(iso)
+	country, err := LookupCountry(iso)
+	if err != nil {
+		return "", Country{}, err
+	}
+	code, err := countryCode(iso, nil, f.Country, country.FiveSim)
+	return code, country, err
+}
+
+func (f *FiveSim) BuyNumber(ctx context.Context, cred Credentials, req NumberRequest) (Number, error) {
+	countryName, country, err := f.country(req.Country)
+	if err != nil {
+		return Number{}, err
+	}
+	operator := "any"
+	if req.Operator != "" {
+		operator = req.Operator
+	}
+	apiURL := fmt.Sprintf("%s/v1/user/buy/activation/%s/%s/%s", f.BaseURL, countryName, url.PathEscape(operator), req.Code)
+	number, id, err := serverscalc.ExtractNumberServer2(ctx, apiURL, bearer(cred.APIKey))
+	if err != nil {
+		return Number{}, fiveSimError(err)
+	}
+	return Number{ID: id, Number: nationalNumber(number, country.CallingCode)}, nil
+}
+
+func fiveSimError(err error) error {
+	msg := err.Error()
+	switch {
+	case msg == "BAD_KEY":
+		return wrap(ErrBadKey, err)
+	case strings.Contains(msg, "no free phones"):
+		return wrap(ErrNoNumbers, err)
+	case strings.Contains(msg, "not enough user balance"):
+		return wrap(ErrProviderBalanceLow, err)
+	case strings.Contains(msg, "no product"), strings.Contains(msg, "not enough rating"):
+		return wrap(ErrServiceBanned, err)
+	}
+	return unexpected(err)
+}
+
+func (f *FiveSim) GetOTP(ctx context.Context, cred Credentials, id string) ([]string, error) {
+	apiURL := fmt.Sprintf("%s/v1/user/check/%s", f.BaseURL, id)
+	return serversotpcalc.GetSMSTextsServer2(ctx, apiURL, id, bearer(cred.Token))
+}
+
+func (f *FiveSim) Cancel(ctx context.Context, cred Credentials, id, number string) error {
+	body, err := getOnce(ctx, fmt.Sprintf("%s/v1/user/cancel/%s", f.BaseURL, id), bearer(cred.Token))
+	if err != nil {
+		return unexpected(err)
+	}
+	responseData := string(body)
+	logs.Logger.Infof("Number Cancel Response %+v", responseData)
+
+	if strings.Contains(responseData, "order has sms") {
+		return nil
+	} else if strings.Contains(responseData, "order not found") {
+		return nil
+	}
+	var responseDataJSON map[string]interface{}
+	if err := json.Unmarshal(body, &responseDataJSON); err != nil {
+		return unexpected(fmt.Errorf("failed to parse JSON response: %w", err))
+	}
+	switch responseDataJSON["status"] {
+	case "CANCELED":
+		return nil
+	case "PENDING":
+		return ErrEarlyCancelDenied
+	case "FINISHED", "TIMEOUT", "BANNED":
+		return ErrAlreadyFinished
+	}
+	return unexpected(errors.New(responseData))
+}
+
+func (f *FiveSim) RequestNextSMS(ctx context.Context, cred Credentials, id string) error {
+	return nil
+}
+
+func (f *FiveSim) Balance(ctx context.Context, cred Credentials) (Balance, error) {
+	body, err := get(ctx, f.BaseURL+"/v1/user/profile", bearer(cred.Token))
+	if err != nil {
+		return Balance{}, unexpected(err)
+	}
+	var responseDataJSON struct {
+		Balance float64 `json:"balance"`
+	}
+	if err := json.Unmarshal(body, &responseDataJSON); err != nil {
+		return Balance{}, unexpected(fmt.Errorf("failed to parse JSON response for balance: %w", err))
+	}
+	return balanceIn(responseDataJSON.Balance, f.Currency()), nil
+}
+
+// Currency is RUB, the currency of 5sim prices and balances.
+func (f *FiveSim) Currency() string {
+	return CurrencyRUB
+}
+
+// fiveSimStatuses maps 5sim order statuses to activation states. Orders
+// that timed out or were banned are refunded by 5sim like cancelled ones.
+var fiveSimStatuses = map[string]string{
+	"PENDING":  ActivationActive,
+	"RECEIVED": ActivationActive,
+	"FINISHED": ActivationFinished,
+	"CANCELED": ActivationCancelled,
+	"TIMEOUT":  ActivationCancelled,
+	"BANNED":   ActivationCancelled,
+}
+
+// Activations lists the latest activation orders, newest first.
+func (f *FiveSim) Activations(ctx context.Context, cred Credentials) ([]Activation, error) {
+	apiURL := fmt.Sprintf("%s/v1/user/orders?category=activation&limit=100&order=id&reverse=true", f.BaseURL)
+	body, err := get(ctx, apiURL, bearer(cred.Token))
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	var response struct {
+		Data []struct {
+			ID        int       `json:"id"`
+			Phone     string    `json:"phone"`
+			Product   string    `json:"product"`
+			Status    string    `json:"status"`
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"Data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fiveSimError(errors.New(strings.TrimSpace(string(body))))
+	}
+	activations := make([]Activation, 0, len(response.Data))
+	for _, order := range response.Data {
+		status, ok := fiveSimStatuses[order.Status]
+		if !ok {
+			continue
+		}
+		activations = append(activations, Activation{
+			ID:        fmt.Sprintf("%d", order.ID),
+			Number:    order.Phone,
+			Code:      order.Product,
+			Status:    status,
+			CreatedAt: order.CreatedAt,
+		})
+	}
+	return activations, nil
+}
+
+// ParseWebhook reads the 5sim order webhook, which carries the same order as
+// /v1/user/check.
+func (f *FiveSim) ParseWebhook(body []byte) (string, []string, error) {
+	var payload struct {
+		ID  int `json:"id"`
+		SMS []struct {
+			Text string `json:"text"`
+		} `json:"sms"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", nil, fmt.Errorf("failed to parse webhook: %w", err)
+	}
+	if payload.ID == 0 {
+		return "", nil, errors.New("INVALID_WEBHOOK_PAYLOAD")
+	}
+	sms := []string{}
+	for _, s := range payload.SMS {
+		sms = append(sms, s.Text)
+	}
+	return fmt.Sprintf("%d", payload.ID), sms, nil
+}
+
+// Prices reads the public 5sim price list. A product is priced at its
+// cheapest operator with stock and its stock summed over all operators, and
+// every operator is listed with its own price.
+func (f *FiveSim) Prices(ctx context.Context, cred Credentials, iso string) ([]Price, error) {
+	countryName, _, err := f.country(iso)
+	if err != nil {
+		return nil, err
+	}
+	body, err := get(ctx, fmt.Sprintf("%s/v1/guest/prices?country=%s", f.BaseURL, countryName), map[string]string{})
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	var response map[string]map[string]map[string]struct {
+		Cost  float64 `json:"cost"`
+		Count int     `json:"count"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, unexpected(fmt.Errorf("failed to parse JSON response: %w", err))
+	}
+	prices := []Price{}
+	for product, operators := range response[countryName] {
+		price := Price{Code: product, Cost: -1}
+		for name, operator := range operators {
+			price.Operators = append(price.Operators, OperatorPrice{Name: name, Cost: operator.Cost, Stock: operator.Count})
+			price.Stock += operator.Count
+			if operator.Count > 0 && (price.Cost < 0 || operator.Cost < price.Cost) {
+				price.Cost = operator.Cost
+			}
+		}
+		if price.Cost < 0 {
+			for _, operator := range operators {
+				if price.Cost < 0 || operator.Cost < price.Cost {
+					price.Cost = operator.Cost
+				}
+			}
+		}
+		sort.Slice(price.Operators, func(i, j int) bool {
+			return price.Operators[i].Name < price.Operators[j].Name
+		})
+		prices = append(prices, price)
+	}
+	return prices, nil
+}
@@ -0,0 +1,301 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	serverscalc "github.com/ranjankuldeep/fakeNumber/internal/serversCalc"
+	serversnextotpcalc "github.com/ranjankuldeep/fakeNumber/internal/serversNextOtpCalc"
+	serversotpcalc "github.com/ranjankuldeep/fakeNumber/internal/serversOtpCalc"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+)
+
+// ProtocolHandlerAPI is the sms-activate compatible handler_api.php dialect
+// (getNumber / getStatus / setStatus / getBalance).
+const ProtocolHandlerAPI = "handler_api"
+
+// handlerAPIErrors maps handler_api error responses, matched by prefix, to
+// provider errors.
+var handlerAPIErrors = []struct {
+	prefix string
+	err    *Error
+}{
+	{"NO_NUMBERS", ErrNoNumbers},
+	{"NO_BALANCE", ErrProviderBalanceLow},
+	{"BAD_KEY", ErrBadKey},
+	{"BANNED", ErrBadKey},
+	{"WRONG_MAX_PRICE", ErrPriceAboveMax},
+	{"BAD_SERVICE", ErrServiceBanned},
+	{"EARLY_CANCEL_DENIED", ErrEarlyCancelDenied},
+	{"BAD_STATUS", ErrAlreadyFinished},
+	{"NO_ACTIVATION", ErrAlreadyFinished},
+	{"NO_ID_RENT", ErrAlreadyFinished},
+}
+
+func handlerAPIError(response string) error {
+	for _, known := range handlerAPIErrors {
+		if strings.HasPrefix(response, known.prefix) {
+			if response == known.prefix {
+				return known.err
+			}
+			return wrap(known.err, errors.New(response))
+		}
+	}
+	return unexpected(errors.New(response))
+}
+
+// HandlerAPI is the generic client for every handler_api provider. All
+// differences between providers are carried by its config.
+type HandlerAPI struct {
+	Config models.ProviderConfig
+}
+
+func NewHandlerAPI(cfg models.ProviderConfig) *HandlerAPI {
+	return &HandlerAPI{Config: cfg}
+}
+
+func (h *HandlerAPI) url(apiKey, action string, params url.Values) string {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("api_key", apiKey)
+	params.Set("action", action)
+	return h.Config.BaseURL + "?" + params.Encode()
+}
+
+// country returns the provider's code for an ISO country and the prefix to
+// strip from its numbers.
+func (h *HandlerAPI) country(iso string) (string, string, error) {
+	iso = NormalizeCountry(iso)
+	country, err := LookupCountry(iso)
+	if err != nil && h.Config.Countries[iso] == "" {
+		return "", "", err
+	}
+	code, err := countryCode(iso, h.Config.Countries, h.Config.Country, country.HandlerAPI)
+	if err != nil {
+		return "", "", err
+	}
+	prefix := country.CallingCode
+	if h.Config.NumberPrefix != "" {
+		prefix = h.Config.NumberPrefix
+	}
+	return code, prefix, nil
+}
+
+func (h *HandlerAPI) BuyNumber(ctx context.Context, cred Credentials, req NumberRequest) (Number, error) {
+	country, prefix, err := h.country(req.Country)
+	if err != nil {
+		return Number{}, err
+	}
+	params := url.Values{}
+	for key, value := range h.Config.ExtraParams {
+		params.Set(key, value)
+	}
+	params.Set("service", req.Code)
+	params.Set("country", country)
+	if req.Operator != "" {
+		params.Set("operator", req.Operator)
+	} else if h.Config.Operator != "" {
+		params.Set("operator", h.Config.Operator)
+	}
+	if h.Config.SendMaxPrice && req.MaxPrice != "" {
+		params.Set("maxPrice", req.MaxPrice)
+	}
+	id, number, err := serverscalc.ExtractNumberServerFromAccess(ctx, h.url(cred.APIKey, "getNumber", params), map[string]string{})
+	if err != nil {
+		return Number{}, handlerAPIError(err.Error())
+	}
+	return Number{ID: id, Number: nationalNumber(number, prefix)}, nil
+}
+
+func (h *HandlerAPI) GetOTP(ctx context.Context, cred Credentials, id string) ([]string, error) {
+	params := url.Values{}
+	params.Set("id", id)
+	otp, err := serversotpcalc.GetOTPServer1(ctx, h.url(cred.APIKey, "getStatus", params), map[string]string{}, id)
+	if err != nil {
+		if err.Error() == "ACCESS_CANCEL" {
+			return []string{}, err
+		}
+		return []string{}, unexpected(err)
+	}
+	return otp, nil
+}
+
+func (h *HandlerAPI) Cancel(ctx context.Context, cred Credentials, id, number string) error {
+	params := url.Values{}
+	params.Set("id", id)
+	params.Set("status", "8")
+	body, err := getOnce(ctx, h.url(cred.APIKey, "setStatus", params), map[string]string{})
+	if err != nil {
+		return unexpected(err)
+	}
+	responseData := string(body)
+	logs.Logger.Infof("Number Cancel Response %+v", responseData)
+
+	if strings.HasPrefix(responseData, "ACCESS_CANCEL") {
+		return nil
+	}
+	for _, ok := range h.Config.CancelOK {
+		if strings.HasPrefix(responseData, ok) {
+			return nil
+		}
+	}
+	return handlerAPIError(responseData)
+}
+
+func (h *HandlerAPI) RequestNextSMS(ctx context.Context, cred Credentials, id string) error {
+	if h.Config.NextSMSAck == "" {
+		return nil
+	}
+	params := url.Values{}
+	params.Set("id", id)
+	params.Set("status", "3")
+	nextOtpUrl := h.url(cred.APIKey, "setStatus", params)
+	if h.Config.NextSMSAck == "ACCESS_WAITING" {
+		return serversnextotpcalc.CallNextOTPServerWaiting(ctx, nextOtpUrl, map[string]string{})
+	}
+	return serversnextotpcalc.CallNextOTPServerRetry(ctx, nextOtpUrl, map[string]string{})
+}
+
+func (h *HandlerAPI) Balance(ctx context.Context, cred Credentials) (Balance, error) {
+	body, err := get(ctx, h.url(cred.APIKey, "getBalance", nil), map[string]string{})
+	if err != nil {
+		return Balance{}, unexpected(err)
+	}
+	responseData := strings.TrimSpace(string(body))
+	if !strings.HasPrefix(responseData, "ACCESS_BALANCE:") {
+		return Balance{}, handlerAPIError(responseData)
+	}
+	value, err := strconv.ParseFloat(strings.TrimPrefix(responseData, "ACCESS_BALANCE:"), 64)
+	if err != nil {
+		return Balance{}, unexpected(fmt.Errorf("failed to parse balance: %w", err))
+	}
+	balance := balanceIn(value, h.Currency())
+	if h.Config.Symbol != "" {
+		balance.Symbol = h.Config.Symbol
+	}
+	return balance, nil
+}
+
+// Currency is the configured currency, or the one of the configured symbol
+// for configs that predate currencies.
+func (h *HandlerAPI) Currency() string {
+	if h.Config.Currency != "" {
+		return h.Config.Currency
+	}
+	return currencyOfSymbol(h.Config.Symbol)
+}
+
+// Activations lists the running activations with getActiveActivations.
+// Clones without the action answer BAD_ACTION.
+func (h *HandlerAPI) Activations(ctx context.Context, cred Credentials) ([]Activation, error) {
+	body, err := get(ctx, h.url(cred.APIKey, "getActiveActivations", nil), map[string]string{})
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	var response struct {
+		Status            string `json:"status"`
+		Error             string `json:"error"`
+		ActiveActivations []struct {
+			ActivationID   json.Number `json:"activationId"`
+			ServiceCode    string      `json:"serviceCode"`
+			PhoneNumber    string      `json:"phoneNumber"`
+			ActivationTime string      `json:"activationTime"`
+		} `json:"activeActivations"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		responseData := strings.TrimSpace(string(body))
+		if responseData == "BAD_ACTION" {
+			return nil, fmt.Errorf("ACTIVATIONS_NOT_SUPPORTED")
+		}
+		return nil, handlerAPIError(responseData)
+	}
+	if response.Status != "success" {
+		if response.Error == "NO_ACTIVATIONS" {
+			return []Activation{}, nil
+		}
+		return nil, handlerAPIError(response.Error)
+	}
+	activations := make([]Activation, 0, len(response.ActiveActivations))
+	for _, a := range response.ActiveActivations {
+		createdAt, _ := time.Parse("2006-01-02 15:04:05", a.ActivationTime)
+		activations = append(activations, Activation{
+			ID:        a.ActivationID.String(),
+			Number:    a.PhoneNumber,
+			Code:      a.ServiceCode,
+			Status:    ActivationActive,
+			CreatedAt: createdAt,
+		})
+	}
+	return activations, nil
+}
+
+// ParseWebhook reads the sms-activate style webhook. The code is stored when
+// the provider sends one, as getStatus does, otherwise the full text.
+func (h *HandlerAPI) ParseWebhook(body []byte) (string, []string, error) {
+	var payload struct {
+		ActivationID json.Number `json:"activationId"`
+		Code         string      `json:"code"`
+		Text         string      `json:"text"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", nil, fmt.Errorf("failed to parse webhook: %w", err)
+	}
+	if payload.ActivationID == "" {
+		return "", nil, errors.New("INVALID_WEBHOOK_PAYLOAD")
+	}
+	sms := payload.Code
+	if sms == "" {
+		sms = payload.Text
+	}
+	if sms == "" {
+		return payload.ActivationID.String(), []string{}, nil
+	}
+	return payload.ActivationID.String(), []string{sms}, nil
+}
+
+// handlerAPIPrices is the getPrices and sms-man get-prices answer:
+// country, then service code, then cost and count. Some clones send the
+// numbers as strings.
+type handlerAPIPrices map[string]map[string]struct {
+	Cost  json.Number `json:"cost"`
+	Count json.Number `json:"count"`
+}
+
+func (p handlerAPIPrices) prices(country string) []Price {
+	prices := []Price{}
+	for code, entry := range p[country] {
+		cost, err := entry.Cost.Float64()
+		if err != nil {
+			continue
+		}
+		count, _ := entry.Count.Int64()
+		prices = append(prices, Price{Code: code, Cost: cost, Stock: int(count)})
+	}
+	return prices
+}
+
+func (h *HandlerAPI) Prices(ctx context.Context, cred Credentials, iso string) ([]Price, error) {
+	country, _, err := h.country(iso)
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	params.Set("country", country)
+	body, err := get(ctx, h.url(cred.APIKey, "getPrices", params), map[string]string{})
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	var prices handlerAPIPrices
+	if err := json.Unmarshal(body, &prices); err != nil {
+		return nil, handlerAPIError(strings.TrimSpace(string(body)))
+	}
+	return prices.prices(country), nil
+}
@@ -0,0 +1,170 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handlerAPIRentDate is the layout of dates in rent answers.
+const handlerAPIRentDate = "2006-01-02 15:04:05"
+
+// handlerAPIRentResponse is the JSON answer of the rent actions. Failures
+// carry the error in message, in the same words as the plain text actions;
+// some clones answer them in plain text instead.
+type handlerAPIRentResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Phone   struct {
+		ID     json.Number `json:"id"`
+		Number string      `json:"number"`
+	} `json:"phone"`
+	Values map[string]struct {
+		PhoneFrom string `json:"phoneFrom"`
+		Text      string `json:"text"`
+		Date      string `json:"date"`
+	} `json:"values"`
+}
+
+// rent calls a rent action with fetch, getOnce for actions that charge us.
+func (h *HandlerAPI) rent(ctx context.Context, fetch func(context.Context, string, map[string]string) ([]byte, error), apiKey, action string, params url.Values) (handlerAPIRentResponse, error) {
+	var response handlerAPIRentResponse
+	body, err := fetch(ctx, h.url(apiKey, action, params), map[string]string{})
+	if err != nil {
+		return response, unexpected(err)
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		response.Message = strings.TrimSpace(string(body))
+		return response, handlerAPIError(response.Message)
+	}
+	if response.Status != "success" {
+		return response, handlerAPIError(response.Message)
+	}
+	return response, nil
+}
+
+func (h *HandlerAPI) RentNumber(ctx context.Context, cred Credentials, req RentRequest) (Rental, error) {
+	country, prefix, err := h.country(req.Country)
+	if err != nil {
+		return Rental{}, err
+	}
+	params := url.Values{}
+	params.Set("service", req.Code)
+	params.Set("country", country)
+	params.Set("rent_time", strconv.Itoa(req.Hours))
+	if h.Config.Operator != "" {
+		params.Set("operator", h.Config.Operator)
+	}
+	response, err := h.rent(ctx, getOnce, cred.APIKey, "getRentNumber", params)
+	if err != nil {
+		return Rental{}, err
+	}
+	if response.Phone.ID == "" || response.Phone.Number == "" {
+		return Rental{}, unexpected(errors.New("rent answer without a number"))
+	}
+	return Rental{ID: response.Phone.ID.String(), Number: nationalNumber(response.Phone.Number, prefix)}, nil
+}
+
+// RentStatus reads the rental inbox. Providers answer STATUS_WAIT_CODE
+// while it is empty and STATUS_FINISH or STATUS_CANCEL once it has ended.
+func (h *HandlerAPI) RentStatus(ctx context.Context, cred Credentials, id string) ([]RentMessage, error) {
+	params := url.Values{}
+	params.Set("id", id)
+	response, err := h.rent(ctx, get, cred.APIKey, "getRentStatus", params)
+	if err != nil {
+		switch response.Message {
+		case "STATUS_WAIT_CODE":
+			return []RentMessage{}, nil
+		case "STATUS_FINISH", "STATUS_CANCEL":
+			return nil, ErrAlreadyFinished
+		}
+		return nil, err
+	}
+	keys := make([]int, 0, len(response.Values))
+	for key := range response.Values {
+		n, err := strconv.Atoi(key)
+		if err != nil {
+			continue
+		}
+		keys = append(keys, n)
+	}
+	sort.Ints(keys)
+	messages := make([]RentMessage, 0, len(keys))
+	for _, key := range keys {
+		value := response.Values[strconv.Itoa(key)]
+		// An unreadable date is left zero for the caller to fill in.
+		receivedAt, _ := time.Parse(handlerAPIRentDate, value.Date)
+		messages = append(messages, RentMessage{Text: value.Text, Sender: value.PhoneFrom, ReceivedAt: receivedAt})
+	}
+	// Values are numbered newest first.
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+func (h *HandlerAPI) ExtendRental(ctx context.Context, cred Credentials, id string, hours int) error {
+	params := url.Values{}
+	params.Set("id", id)
+	params.Set("rent_time", strconv.Itoa(hours))
+	_, err := h.rent(ctx, getOnce, cred.APIKey, "continueRentNumber", params)
+	return err
+}
+
+// ReleaseRental cancels the rental with status 2 for a refund, and
+// finishes it with status 1 otherwise.
+func (h *HandlerAPI) ReleaseRental(ctx context.Context, cred Credentials, id string, refund bool) error {
+	params := url.Values{}
+	params.Set("id", id)
+	params.Set("status", "1")
+	if refund {
+		params.Set("status", "2")
+	}
+	_, err := h.rent(ctx, get, cred.APIKey, "setRentStatus", params)
+	return err
+}
+
+func (h *HandlerAPI) RentPrices(ctx context.Context, cred Credentials, iso string, hours int) ([]Price, error) {
+	country, _, err := h.country(iso)
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	params.Set("country", country)
+	params.Set("rent_time", strconv.Itoa(hours))
+	if h.Config.Operator != "" {
+		params.Set("operator", h.Config.Operator)
+	}
+	body, err := get(ctx, h.url(cred.APIKey, "getRentServicesAndCountries", params), map[string]string{})
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	var response struct {
+		Services map[string]struct {
+			Cost  json.Number `json:"cost"`
+			Quant json.Number `json:"quant"`
+		} `json:"services"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, handlerAPIError(strings.TrimSpace(string(body)))
+	}
+	if response.Services == nil {
+		return nil, unexpected(fmt.Errorf("rent price list without services: %s", strings.TrimSpace(string(body))))
+	}
+	prices := []Price{}
+	for code, entry := range response.Services {
+		cost, err := entry.Cost.Float64()
+		if err != nil {
+			continue
+		}
+		stock, _ := entry.Quant.Int64()
+		prices = append(prices, Price{Code: code, Cost: cost, Stock: int(stock)})
+	}
+	return prices, nil
+}
@@ -0,0 +1,413 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Breaker states.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+const (
+	// healthWindow is the number of recent calls the error rate is taken over.
+	healthWindow = 20
+	// minCallsToTrip keeps a couple of early failures from tripping the breaker.
+	minCallsToTrip      = 10
+	errorRateToTrip     = 0.5
+	consecutiveToTrip   = 5
+	breakerOpenDuration = time.Minute
+	// latencyWeight is the weight of the newest call in the latency average.
+	latencyWeight = 0.2
+)
+
+// Health is the tracked state of one upstream server. It is independent of
+// the manual maintenance flag on the server document.
+type Health struct {
+	Server              int       `json:"server"`
+	State               string    `json:"state"`
+	Score               int       `json:"score"`
+	Calls               int64     `json:"calls"`
+	Failures            int64     `json:"failures"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	ErrorRate           float64   `json:"errorRate"`
+	LatencyMs           float64   `json:"latencyMs"`
+	LastError           string    `json:"lastError,omitempty"`
+	OpenedAt            time.Time `json:"openedAt,omitempty"`
+}
+
+type serverHealth struct {
+	Health
+	window  []bool
+	next    int
+	probing bool
+}
+
+var (
+	health     = make(map[int]*serverHealth)
+	healthMu   sync.Mutex
+	breakerFns []func(Health)
+)
+
+// OnBreakerChange registers fn to be called whenever a server's breaker trips
+// open or closes again.
+func OnBreakerChange(fn func(Health)) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	breakerFns = append(breakerFns, fn)
+}
+
+func healthFor(server int) *serverHealth {
+	h, ok := health[server]
+	if !ok {
+		h = &serverHealth{Health: Health{Server: server, State: BreakerClosed, Score: 100}}
+		health[server] = h
+	}
+	return h
+}
+
+// allow reports whether a new purchase may be sent to the server, and
+// whether it is the probe of a half open breaker. Once the open period is
+// over a single probe is let through.
+func allow(server int) (allowed, probe bool) {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	h := healthFor(server)
+	switch h.State {
+	case BreakerOpen:
+		if time.Since(h.OpenedAt) < breakerOpenDuration {
+			return false, false
+		}
+		h.State = BreakerHalfOpen
+		h.probing = true
+		return true, true
+	case BreakerHalfOpen:
+		if h.probing {
+			return false, false
+		}
+		h.probing = true
+		return true, true
+	}
+	return true, false
+}
+
+// record adds the outcome of a call to the server's health. Only the probe,
+// the purchase allow let through, decides whether a half open breaker closes
+// or opens again. A call the caller gave up on says nothing either way; a
+// probe given up on frees the way for the next one.
+func record(server int, latency time.Duration, err error, probe bool) {
+	if errors.Is(err, context.Canceled) {
+		if probe {
+			healthMu.Lock()
+			healthFor(server).probing = false
+			healthMu.Unlock()
+		}
+		return
+	}
+	failed := isUpstreamFailure(err)
+
+	healthMu.Lock()
+	h := healthFor(server)
+	before := h.State
+
+	h.Calls++
+	if len(h.window) < healthWindow {
+		h.window = append(h.window, failed)
+	} else {
+		h.window[h.next] = failed
+		h.next = (h.next + 1) % healthWindow
+	}
+	failures := 0
+	for _, f := range h.window {
+		if f {
+			failures++
+		}
+	}
+	h.ErrorRate = float64(failures) / float64(len(h.window))
+	ms := float64(latency) / float64(time.Millisecond)
+	if h.LatencyMs == 0 {
+		h.LatencyMs = ms
+	} else {
+		h.LatencyMs = latencyWeight*ms + (1-latencyWeight)*h.LatencyMs
+	}
+
+	if failed {
+		h.Failures++
+		h.ConsecutiveFailures++
+		h.LastError = err.Error()
+	} else {
+		h.ConsecutiveFailures = 0
+	}
+
+	switch h.State {
+	case BreakerClosed:
+		if h.ConsecutiveFailures >= consecutiveToTrip ||
+			(len(h.window) >= minCallsToTrip && h.ErrorRate >= errorRateToTrip) {
+			h.State = BreakerOpen
+			h.OpenedAt = time.Now()
+		}
+	case BreakerHalfOpen:
+		if !probe {
+			break
+		}
+		h.probing = false
+		if failed {
+			h.State = BreakerOpen
+			h.OpenedAt = time.Now()
+		} else {
+			h.State = BreakerClosed
+			h.window = nil
+			h.next = 0
+			h.ErrorRate = 0
+		}
+	}
+	h.Score = score(h.Health)
+
+	snapshot := h.Health
+	var fns []func(Health)
+	// Half open is a probe of an already tripped breaker, not a new change.
+	if (before == BreakerClosed) != (h.State == BreakerClosed) {
+		fns = breakerFns
+	}
+	healthMu.Unlock()
+
+	for _, fn := range fns {
+		go fn(snapshot)
+	}
+}
+
+func score(h Health) int {
+	if h.State == BreakerOpen {
+		return 0
+	}
+	s := 100 * (1 - h.ErrorRate)
+	if h.State == BreakerHalfOpen {
+		s /= 2
+	}
+	return int(math.Round(s))
+}
+
+// failureMarkers are error texts that mean the upstream misbehaved, for the
+// calls that do not return provider errors yet.
+var failureMarkers = []string{
+	"unexpected status code",
+	"INVALID_RESPONSE_FORMAT",
+	"UNEXPECTED_RESPONSE",
+	"EMTPY_RESPONSE",
+	"BAD_KEY",
+	"failed to parse",
+	"failed to send request",
+	"error fetching",
+}
+
+// isUpstreamFailure reports whether err means the upstream misbehaved, as
+// opposed to an answer like no numbers or an early cancel.
+func isUpstreamFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	// The caller gave up, e.g. the customer closed the request; that says
+	// nothing about the provider.
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var providerErr *Error
+	if errors.As(err, &providerErr) {
+		return providerErr.Code == CodeBadKey || providerErr.Code == CodeUnexpected
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return true
+	}
+	for _, marker := range failureMarkers {
+		if strings.Contains(err.Error(), marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// HealthOf returns the tracked health of a server.
+func HealthOf(server int) Health {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	return healthFor(server).Health
+}
+
+// HealthReport returns the health of every registered or tracked server.
+func HealthReport() []Health {
+	servers := Servers()
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	for server := range health {
+		if !containsServer(servers, server) {
+			servers = append(servers, server)
+		}
+	}
+	report := make([]Health, 0, len(servers))
+	for _, server := range servers {
+		report = append(report, healthFor(server).Health)
+	}
+	return report
+}
+
+// Available reports whether purchases may be routed to the server: its
+// breaker is closed, or its open period is over and it can be probed.
+func Available(server int) bool {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	h, ok := health[server]
+	return !ok || available(h)
+}
+
+func available(h *serverHealth) bool {
+	switch h.State {
+	case BreakerOpen:
+		return time.Since(h.OpenedAt) >= breakerOpenDuration
+	case BreakerHalfOpen:
+		return !h.probing
+	}
+	return true
+}
+
+// Tripped returns the servers purchases should not be routed to right now.
+func Tripped() []int {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	var servers []int
+	for server, h := range health {
+		if !available(h) {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
+
+func containsServer(servers []int, server int) bool {
+	for _, s := range servers {
+		if s == server {
+			return true
+		}
+	}
+	return false
+}
+
+// monitored records the outcome of every call to a provider and refuses new
+// purchases while the server's breaker is open. Calls for activations that
+// already exist still go through, so they can be finished or refunded. Every
+// call first waits for the server's limits; time spent waiting is not
+// counted as latency and a call given up on is not counted at all. A call
+// rejected for a stale token is retried once with a refreshed token. The
+// exchanges of every call go to the audit trail, except OTP polls that found
+// no SMS.
+type monitored struct {
+	server int
+	Provider
+}
+
+func (m *monitored) BuyNumber(ctx context.Context, cred Credentials, req NumberRequest) (Number, error) {
+	release, err := limiterFor(m.server).acquire(ctx)
+	if err != nil {
+		return Number{}, err
+	}
+	defer release()
+	allowed, probe := allow(m.server)
+	if !allowed {
+		return Number{}, ErrServerDegraded
+	}
+	ctx, audit := traced(ctx, m.server, OpBuyNumber)
+	start := time.Now()
+	var number Number
+	err = m.withFreshToken(ctx, cred, func(cred Credentials) error {
+		number, err = m.Provider.BuyNumber(ctx, cred, req)
+		return err
+	})
+	record(m.server, time.Since(start), err, probe)
+	audit(number.ID)
+	return number, err
+}
+
+func (m *monitored) GetOTP(ctx context.Context, cred Credentials, id string) ([]string, error) {
+	release, err := limiterFor(m.server).acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ctx, audit := traced(ctx, m.server, OpGetOTP)
+	start := time.Now()
+	var otp []string
+	err = m.withFreshToken(ctx, cred, func(cred Credentials) error {
+		otp, err = m.Provider.GetOTP(ctx, cred, id)
+		return err
+	})
+	record(m.server, time.Since(start), err, false)
+	// Orders are polled every few seconds until an SMS arrives; only the
+	// polls that got one or failed are worth keeping.
+	if err != nil || len(otp) != 0 {
+		audit(id)
+	}
+	return otp, err
+}
+
+func (m *monitored) Cancel(ctx context.Context, cred Credentials, id, number string) error {
+	release, err := limiterFor(m.server).acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	ctx, audit := traced(ctx, m.server, OpCancel)
+	defer audit(id)
+	start := time.Now()
+	err = m.withFreshToken(ctx, cred, func(cred Credentials) error {
+		return m.Provider.Cancel(ctx, cred, id, number)
+	})
+	record(m.server, time.Since(start), err, false)
+	return err
+}
+
+func (m *monitored) RequestNextSMS(ctx context.Context, cred Credentials, id string) error {
+	release, err := limiterFor(m.server).acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	ctx, audit := traced(ctx, m.server, OpNextSMS)
+	defer audit(id)
+	start := time.Now()
+	err = m.withFreshToken(ctx, cred, func(cred Credentials) error {
+		return m.Provider.RequestNextSMS(ctx, cred, id)
+	})
+	record(m.server, time.Since(start), err, false)
+	return err
+}
+
+func (m *monitored) Balance(ctx context.Context, cred Credentials) (Balance, error) {
+	release, err := limiterFor(m.server).acquire(ctx)
+	if err != nil {
+		return Balance{}, err
+	}
+	defer release()
+	ctx, audit := traced(ctx, m.server, OpBalance)
+	defer audit("")
+	start := time.Now()
+	var balance Balance
+	err = m.withFreshToken(ctx, cred, func(cred Credentials) error {
+		balance, err = m.Provider.Balance(ctx, cred)
+		return err
+	})
+	record(m.server, time.Since(start), err, false)
+	return balance, err
+}
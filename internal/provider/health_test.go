@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreakerTripsAndRecovers(t *testing.T) {
+	const server = 901
+	failure := unexpected(errors.New("unexpected status code 502"))
+
+	for i := 0; i < consecutiveToTrip-1; i++ {
+		record(server, time.Millisecond, failure, false)
+	}
+	if state := HealthOf(server).State; state != BreakerClosed {
+		t.Fatalf("state %s after %d failures, want closed", state, consecutiveToTrip-1)
+	}
+	record(server, time.Millisecond, failure, false)
+	if state := HealthOf(server).State; state != BreakerOpen {
+		t.Fatalf("state %s after %d failures, want open", state, consecutiveToTrip)
+	}
+	if allowed, _ := allow(server); allowed || Available(server) {
+		t.Fatal("open breaker let a purchase through")
+	}
+
+	// Let the open period run out: one probe goes through, the next waits.
+	healthMu.Lock()
+	healthFor(server).OpenedAt = time.Now().Add(-breakerOpenDuration)
+	healthMu.Unlock()
+	if allowed, probe := allow(server); !allowed || !probe {
+		t.Fatal("breaker did not let a probe through after the open period")
+	}
+	if allowed, _ := allow(server); allowed {
+		t.Fatal("breaker let a second probe through")
+	}
+	// Other calls made meanwhile, such as a balance check, decide nothing.
+	record(server, time.Millisecond, nil, false)
+	if state := HealthOf(server).State; state != BreakerHalfOpen {
+		t.Fatalf("state %s after a call other than the probe, want half open", state)
+	}
+	record(server, time.Millisecond, nil, true)
+	if h := HealthOf(server); h.State != BreakerClosed || h.Score != 100 {
+		t.Fatalf("got %s with score %d after a good probe, want closed with 100", h.State, h.Score)
+	}
+}
+
+func TestBreakerIgnoresAnswers(t *testing.T) {
+	const server = 902
+	for i := 0; i < healthWindow; i++ {
+		record(server, time.Millisecond, ErrNoNumbers, false)
+		record(server, time.Millisecond, ErrEarlyCancelDenied, false)
+	}
+	if h := HealthOf(server); h.State != BreakerClosed || h.Failures != 0 {
+		t.Fatalf("got %s with %d failures for no stock answers, want closed with none", h.State, h.Failures)
+	}
+}
+
+func TestBreakerIgnoresCancelledProbe(t *testing.T) {
+	const server = 905
+	failure := unexpected(errors.New("unexpected status code 502"))
+	for i := 0; i < consecutiveToTrip; i++ {
+		record(server, time.Millisecond, failure, false)
+	}
+	healthMu.Lock()
+	healthFor(server).OpenedAt = time.Now().Add(-breakerOpenDuration)
+	healthMu.Unlock()
+
+	if allowed, probe := allow(server); !allowed || !probe {
+		t.Fatal("breaker did not let a probe through after the open period")
+	}
+	record(server, time.Millisecond, context.Canceled, true)
+	if h := HealthOf(server); h.State != BreakerHalfOpen || h.Calls != consecutiveToTrip {
+		t.Fatalf("got %s after %d calls for a cancelled probe, want half open after %d", h.State, h.Calls, consecutiveToTrip)
+	}
+	if allowed, probe := allow(server); !allowed || !probe {
+		t.Fatal("breaker did not let a new probe through after a cancelled one")
+	}
+	record(server, time.Millisecond, failure, true)
+	if state := HealthOf(server).State; state != BreakerOpen {
+		t.Fatalf("state %s after a failed probe, want open", state)
+	}
+}
@@ -0,0 +1,224 @@
+package provider
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LimitStats are the configured outbound limits of a server and how often
+// calls had to wait for them since start up.
+type LimitStats struct {
+	Server      int     `json:"server"`
+	RateLimit   float64 `json:"rateLimit"`
+	MaxInFlight int     `json:"maxInFlight"`
+	InFlight    int     `json:"inFlight"`
+	Calls       int64   `json:"calls"`
+	// Throttled counts calls delayed by the rate limit, Queued calls that
+	// waited for an in-flight slot and Rejected calls whose context ended
+	// before they got through.
+	Throttled int64   `json:"throttled"`
+	Queued    int64   `json:"queued"`
+	Rejected  int64   `json:"rejected"`
+	WaitMs    float64 `json:"waitMs"`
+}
+
+// limiter caps the calls made to one server: a token bucket of RateLimit
+// requests a second, with a burst of one second's worth, and at most
+// MaxInFlight calls at a time. Zero disables either limit.
+type limiter struct {
+	mu      sync.Mutex
+	stats   LimitStats
+	tokens  float64
+	last    time.Time
+	freed   chan struct{}
+	waitDur time.Duration
+}
+
+var (
+	limiters   = make(map[int]*limiter)
+	limitersMu sync.Mutex
+)
+
+func limiterFor(server int) *limiter {
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+	l, ok := limiters[server]
+	if !ok {
+		l = &limiter{stats: LimitStats{Server: server}, freed: make(chan struct{})}
+		limiters[server] = l
+	}
+	return l
+}
+
+// SetLimits configures the outbound limits of a server. ForServer and
+// CatalogerFor apply the limits stored on the server document, so changes
+// take effect on the next call.
+func SetLimits(server int, rateLimit float64, maxInFlight int) {
+	l := limiterFor(server)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stats.RateLimit != rateLimit {
+		l.stats.RateLimit = rateLimit
+		l.tokens = burst(rateLimit)
+		l.last = time.Now()
+	}
+	if l.stats.MaxInFlight != maxInFlight {
+		l.stats.MaxInFlight = maxInFlight
+		// A higher cap may let queued calls through.
+		close(l.freed)
+		l.freed = make(chan struct{})
+	}
+}
+
+func burst(rateLimit float64) float64 {
+	return math.Max(1, math.Ceil(rateLimit))
+}
+
+// acquire waits until a call to the server is allowed, or fails with
+// ErrRateLimited once ctx ends. The returned func must be called when the
+// call is done.
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	start := time.Now()
+	if err := l.waitRate(ctx); err != nil {
+		l.reject(start)
+		return nil, err
+	}
+	if err := l.waitSlot(ctx); err != nil {
+		l.reject(start)
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.stats.Calls++
+	l.waitDur += time.Since(start)
+	l.mu.Unlock()
+	return l.release, nil
+}
+
+// waitRate takes a token from the bucket, waiting for one to be refilled.
+func (l *limiter) waitRate(ctx context.Context) error {
+	l.mu.Lock()
+	rateLimit := l.stats.RateLimit
+	if rateLimit <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	l.tokens = math.Min(burst(rateLimit), l.tokens+now.Sub(l.last).Seconds()*rateLimit)
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	wait := time.Duration(-l.tokens / rateLimit * float64(time.Second))
+	l.stats.Throttled++
+	l.mu.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		l.giveBack()
+		return wrap(ErrRateLimited, context.DeadlineExceeded)
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.giveBack()
+		return wrap(ErrRateLimited, ctx.Err())
+	}
+}
+
+func (l *limiter) giveBack() {
+	l.mu.Lock()
+	l.tokens++
+	l.mu.Unlock()
+}
+
+// waitSlot takes an in-flight slot, queueing until one is released.
+func (l *limiter) waitSlot(ctx context.Context) error {
+	queued := false
+	for {
+		l.mu.Lock()
+		if l.stats.MaxInFlight <= 0 || l.stats.InFlight < l.stats.MaxInFlight {
+			l.stats.InFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		if !queued {
+			queued = true
+			l.stats.Queued++
+		}
+		freed := l.freed
+		l.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return wrap(ErrRateLimited, ctx.Err())
+		}
+	}
+}
+
+func (l *limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.InFlight--
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
+
+func (l *limiter) reject(start time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stats.Rejected++
+	l.waitDur += time.Since(start)
+}
+
+// LimitReport returns the limits and limit metrics of every server called
+// so far, by server number.
+func LimitReport() []LimitStats {
+	limitersMu.Lock()
+	servers := make([]*limiter, 0, len(limiters))
+	for _, l := range limiters {
+		servers = append(servers, l)
+	}
+	limitersMu.Unlock()
+
+	report := make([]LimitStats, 0, len(servers))
+	for _, l := range servers {
+		l.mu.Lock()
+		stats := l.stats
+		if waited := stats.Calls + stats.Rejected; waited > 0 {
+			stats.WaitMs = float64(l.waitDur) / float64(time.Millisecond) / float64(waited)
+		}
+		l.mu.Unlock()
+		report = append(report, stats)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].Server < report[j].Server
+	})
+	return report
+}
+
+// limitedCataloger applies a server's limits to its price list calls and
+// sends their exchanges to the audit trail.
+type limitedCataloger struct {
+	server int
+	Cataloger
+}
+
+func (c *limitedCataloger) Prices(ctx context.Context, cred Credentials, country string) ([]Price, error) {
+	release, err := limiterFor(c.server).acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ctx, audit := traced(ctx, c.server, OpPrices)
+	defer audit("")
+	return c.Cataloger.Prices(ctx, cred, country)
+}
@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiterCapsInFlightCalls(t *testing.T) {
+	const server = 903
+	SetLimits(server, 0, 1)
+	l := limiterFor(server)
+
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("first call: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("got %v for a call over the cap, want ErrRateLimited", err)
+	}
+
+	// A queued call gets the slot as soon as it is released.
+	acquired := make(chan error)
+	go func() {
+		release, err := l.acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+	release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("queued call: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queued call did not get the released slot")
+	}
+
+	stats := l.stats
+	if stats.Calls != 2 || stats.Rejected != 1 || stats.InFlight != 0 {
+		t.Fatalf("got %+v, want 2 calls, 1 rejected and none in flight", stats)
+	}
+}
+
+func TestLimiterRateLimit(t *testing.T) {
+	const server = 904
+	SetLimits(server, 2, 0)
+	l := limiterFor(server)
+
+	for i := 0; i < 2; i++ {
+		release, err := l.acquire(context.Background())
+		if err != nil {
+			t.Fatalf("call %d within the burst: %v", i+1, err)
+		}
+		release()
+	}
+	// The next token is half a second away, past this deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("got %v for a call over the rate, want ErrRateLimited", err)
+	}
+	if l.stats.Throttled != 1 {
+		t.Fatalf("got %d throttled calls, want 1", l.stats.Throttled)
+	}
+}
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	serverscalc "github.com/ranjankuldeep/fakeNumber/internal/serversCalc"
+	serversotpcalc "github.com/ranjankuldeep/fakeNumber/internal/serversOtpCalc"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+)
+
+// PhantomUnion speaks the phantomunion pickCode API (buyCandy / sweetWrapper).
+// Cancellation and balance go through our ccpay bridge, which keys
+// activations by phone number instead of serial number. phantomunion takes ISO
+// country codes; Country is the one used for the default country.
+type PhantomUnion struct {
+	BaseURL   string
+	BridgeURL string
+	Country   string
+}
+
+func (p *PhantomUnion) BuyNumber(ctx context.Context, cred Credentials, req NumberRequest) (Number, error) {
+	iso := NormalizeCountry(req.Country)
+	country, err := LookupCountry(iso)
+	if err != nil {
+		return Number{}, err
+	}
+	if req.Operator != "" {
+		return Number{}, ErrOperatorNotSupported
+	}
+	code, _ := countryCode(iso, nil, p.Country, iso)
+	params := url.Values{}
+	params.Set("token", cred.Token)
+	params.Set("businessCode", req.Code)
+	params.Set("quantity", "1")
+	params.Set("country", code)
+	params.Set("effectiveTime", "10")
+	number, id, err := serverscalc.ExtractNumberServer9(ctx, p.BaseURL+"/pickCode-api/push/buyCandy?"+params.Encode(), map[string]string{})
+	if err != nil {
+		switch err.Error() {
+		case "NO_NUMBERS":
+			return Number{}, ErrNoNumbers
+		case "BAD_KEY":
+			return Number{}, ErrBadKey
+		}
+		return Number{}, unexpected(err)
+	}
+	return Number{ID: id, Number: nationalNumber(number, country.CallingCode)}, nil
+}
+
+func (p *PhantomUnion) GetOTP(ctx context.Context, cred Credentials, id string) ([]string, error) {
+	params := url.Values{}
+	params.Set("token", cred.Token)
+	params.Set("serialNumber", id)
+	otp, err := serversotpcalc.FetchTokenAndOTP(ctx, p.BaseURL+"/pickCode-api/push/sweetWrapper?"+params.Encode(), id, map[string]string{})
+	if err != nil && err.Error() == "BAD_KEY" {
+		return otp, ErrBadKey
+	}
+	return otp, err
+}
+
+func (p *PhantomUnion) Cancel(ctx context.Context, cred Credentials, id, number string) error {
+	body, err := getOnce(ctx, fmt.Sprintf("%s?type=cancel&number=%s", p.BridgeURL, url.QueryEscape(number)), map[string]string{})
+	if err != nil {
+		return unexpected(err)
+	}
+	responseData := string(body)
+	logs.Logger.Infof("Number Cancel Response %+v", responseData)
+	if strings.HasPrefix(responseData, "success") {
+		return nil
+	}
+	return unexpected(errors.New(responseData))
+}
+
+func (p *PhantomUnion) RequestNextSMS(ctx context.Context, cred Credentials, id string) error {
+	return nil
+}
+
+func (p *PhantomUnion) Balance(ctx context.Context, cred Credentials) (Balance, error) {
+	body, err := get(ctx, p.BridgeURL+"?type=balance", map[string]string{})
+	if err != nil {
+		return Balance{}, unexpected(err)
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(string(body)), 64)
+	if err != nil {
+		return Balance{}, unexpected(fmt.Errorf("failed to parse balance: %w", err))
+	}
+	return balanceIn(value, p.Currency()), nil
+}
+
+// Currency is RUB; the bridge reports the balance in roubles.
+func (p *PhantomUnion) Currency() string {
+	return CurrencyRUB
+}
+
+// phantomTokenLifetime is how long a pickCode ticket is trusted for.
+const phantomTokenLifetime = 2 * time.Hour
+
+// RefreshToken exchanges the API key for a new pickCode ticket.
+func (p *PhantomUnion) RefreshToken(ctx context.Context, cred Credentials) (Token, error) {
+	params := url.Values{}
+	params.Set("key", cred.APIKey)
+	body, err := get(ctx, p.BaseURL+"/pickCode-api/push/ticket?"+params.Encode(), map[string]string{})
+	if err != nil {
+		return Token{}, unexpected(err)
+	}
+	var response struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+		Data    struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return Token{}, unexpected(fmt.Errorf("failed to parse token response: %w", err))
+	}
+	switch {
+	case response.Code == "210":
+		return Token{}, ErrBadKey
+	case response.Code != "200" || response.Data.Token == "":
+		return Token{}, unexpected(errors.New(response.Message))
+	}
+	return Token{Value: response.Data.Token}, nil
+}
+
+func (p *PhantomUnion) TokenLifetime() time.Duration {
+	return phantomTokenLifetime
+}
@@ -0,0 +1,122 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Credentials holds the secrets stored on a server document that a provider
+// needs to authenticate against its upstream API.
+type Credentials struct {
+	APIKey string
+	Token  string
+}
+
+// NumberRequest describes a number purchase. Country is an ISO code, empty
+// for DefaultCountry. Operator is the carrier, empty for any.
+type NumberRequest struct {
+	Code     string
+	Country  string
+	Operator string
+	MaxPrice string
+	Multiple bool
+}
+
+// Number is an activation returned by a provider. Number is the national
+// number, without the country calling code.
+type Number struct {
+	ID     string
+	Number string
+}
+
+// Balance is the account balance we hold with a provider, in the currency
+// it bills in.
+type Balance struct {
+	Value    float64
+	Symbol   string
+	Currency string
+}
+
+// Provider is implemented by every upstream SMS provider.
+type Provider interface {
+	// BuyNumber orders a new activation for the given service code.
+	BuyNumber(ctx context.Context, cred Credentials, req NumberRequest) (Number, error)
+	// GetOTP returns the SMS received so far for an activation. An empty
+	// slice with a nil error means the provider is still waiting for SMS.
+	GetOTP(ctx context.Context, cred Credentials, id string) ([]string, error)
+	// Cancel releases an activation on the provider side.
+	Cancel(ctx context.Context, cred Credentials, id, number string) error
+	// RequestNextSMS asks the provider to keep the activation open for
+	// another SMS. Providers without multiple SMS support return nil.
+	RequestNextSMS(ctx context.Context, cred Credentials, id string) error
+	// Balance returns our balance with the provider.
+	Balance(ctx context.Context, cred Credentials) (Balance, error)
+}
+
+// WebhookParser is implemented by providers that can push incoming SMS to
+// us instead of waiting to be polled.
+type WebhookParser interface {
+	// ParseWebhook returns the activation id and the SMS carried by a
+	// webhook request body.
+	ParseWebhook(body []byte) (id string, sms []string, err error)
+}
+
+// Price is the provider's price and stock for one service code, in the
+// provider's currency. Providers that price carriers separately list them in
+// Operators.
+type Price struct {
+	Code      string
+	Cost      float64
+	Stock     int
+	Operators []OperatorPrice
+}
+
+// OperatorPrice is the price and stock of one carrier.
+type OperatorPrice struct {
+	Name  string
+	Cost  float64
+	Stock int
+}
+
+// Cataloger is implemented by providers that publish their prices and stock.
+type Cataloger interface {
+	// Prices lists the prices for a country, given by ISO code.
+	Prices(ctx context.Context, cred Credentials, country string) ([]Price, error)
+}
+
+var (
+	registry   = make(map[int]Provider)
+	registryMu sync.RWMutex
+)
+
+// Register adds a provider for a server number, replacing any existing one.
+func Register(server int, p Provider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[server] = p
+}
+
+// Get returns the provider registered for a server number.
+func Get(server int) (Provider, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	p, ok := registry[server]
+	if !ok {
+		return nil, fmt.Errorf("INVALID_SERVER_CHOICE")
+	}
+	return p, nil
+}
+
+// Servers returns the registered server numbers in ascending order.
+func Servers() []int {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	servers := make([]int, 0, len(registry))
+	for server := range registry {
+		servers = append(servers, server)
+	}
+	sort.Ints(servers)
+	return servers
+}
@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"net/url"
+	"sync"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+)
+
+var (
+	redirectURL string
+	redirectMu  sync.RWMutex
+)
+
+// Redirect points every provider at a single host, such as the local provider
+// simulator, so the whole number flow can run offline. The upstream paths are
+// kept, only the scheme and host are replaced.
+func Redirect(baseURL string) {
+	redirectMu.Lock()
+	redirectURL = baseURL
+	redirectMu.Unlock()
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for server, p := range registry {
+		registry[server] = redirect(p, baseURL)
+	}
+}
+
+func redirect(p Provider, baseURL string) Provider {
+	switch p := p.(type) {
+	case *HandlerAPI:
+		return NewHandlerAPI(redirectConfig(p.Config, baseURL))
+	case *FiveSim:
+		return &FiveSim{BaseURL: baseURL, Country: p.Country}
+	case *PhantomUnion:
+		return &PhantomUnion{BaseURL: baseURL, BridgeURL: baseURL + "/ccpay.php", Country: p.Country}
+	case *SmsMan:
+		return &SmsMan{BaseURL: baseURL, StatusURL: baseURL, CountryID: p.CountryID}
+	}
+	return p
+}
+
+func redirectConfig(cfg models.ProviderConfig, baseURL string) models.ProviderConfig {
+	path := ""
+	if parsed, err := url.Parse(cfg.BaseURL); err == nil {
+		path = parsed.Path
+	}
+	cfg.BaseURL = baseURL + path
+	return cfg
+}
+
+// redirected returns the redirect host, if any.
+func redirected() string {
+	redirectMu.RLock()
+	defer redirectMu.RUnlock()
+	return redirectURL
+}
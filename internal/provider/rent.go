@@ -0,0 +1,172 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+)
+
+// Operations on rentals recorded in the upstream audit trail.
+const (
+	OpRentNumber    = "rent_number"
+	OpRentStatus    = "rent_status"
+	OpExtendRental  = "extend_rental"
+	OpReleaseRental = "release_rental"
+	OpRentPrices    = "rent_prices"
+)
+
+// RentDurations are the rental periods we sell, in hours.
+var RentDurations = map[string]int{
+	"day":  24,
+	"week": 168,
+}
+
+// RentRequest describes a rental. Country is an ISO code, empty for
+// DefaultCountry.
+type RentRequest struct {
+	Code    string
+	Country string
+	Hours   int
+}
+
+// Rental is a number rented from a provider. Number is the national number,
+// without the country calling code.
+type Rental struct {
+	ID     string
+	Number string
+}
+
+// RentMessage is an SMS received on a rented number.
+type RentMessage struct {
+	Text       string
+	Sender     string
+	ReceivedAt time.Time
+}
+
+// Renter is implemented by providers that rent numbers for days instead of
+// selling single activations.
+type Renter interface {
+	// RentNumber rents a number for the given service code.
+	RentNumber(ctx context.Context, cred Credentials, req RentRequest) (Rental, error)
+	// RentStatus returns every SMS received on a rental so far, oldest
+	// first. An ended rental fails with ErrAlreadyFinished.
+	RentStatus(ctx context.Context, cred Credentials, id string) ([]RentMessage, error)
+	// ExtendRental adds hours to a running rental.
+	ExtendRental(ctx context.Context, cred Credentials, id string, hours int) error
+	// ReleaseRental ends a rental before its time is up. With refund it is
+	// cancelled and our money returned, which providers only allow in the
+	// first minutes of a rental.
+	ReleaseRental(ctx context.Context, cred Credentials, id string, refund bool) error
+	// RentPrices lists the rental prices for a country, given by ISO code,
+	// and a rental period.
+	RentPrices(ctx context.Context, cred Credentials, country string, hours int) ([]Price, error)
+}
+
+// RenterFor returns the rental API of a server's provider, held to the
+// server's limits and health like ForServer.
+func RenterFor(server models.Server) (Renter, error) {
+	p, err := resolve(server)
+	if err != nil {
+		return nil, err
+	}
+	renter, ok := p.(Renter)
+	if !ok || !rents(p) {
+		return nil, fmt.Errorf("RENT_NOT_SUPPORTED")
+	}
+	SetLimits(server.ServerNumber, server.RateLimit, server.MaxInFlight)
+	return &monitoredRenter{monitored: &monitored{server: server.ServerNumber, Provider: p}, Renter: renter}, nil
+}
+
+// rents reports whether the provider has rentals enabled. handler_api
+// providers only rent when their config says so, since not every clone
+// implements the rent actions.
+func rents(p Provider) bool {
+	if h, ok := p.(*HandlerAPI); ok {
+		return h.Config.Rent
+	}
+	return true
+}
+
+// monitoredRenter is monitored for rentals: a new rental is refused while
+// the server's breaker is open, calls on existing rentals still go through.
+type monitoredRenter struct {
+	*monitored
+	Renter
+}
+
+// call runs a call on an existing rental with the server's limits, token
+// refresh, health and audit trail.
+func (m *monitoredRenter) call(ctx context.Context, cred Credentials, op, id string, fn func(context.Context, Credentials) error) error {
+	release, err := limiterFor(m.server).acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	ctx, audit := traced(ctx, m.server, op)
+	defer audit(id)
+	start := time.Now()
+	err = m.withFreshToken(ctx, cred, func(cred Credentials) error {
+		return fn(ctx, cred)
+	})
+	record(m.server, time.Since(start), err, false)
+	return err
+}
+
+func (m *monitoredRenter) RentNumber(ctx context.Context, cred Credentials, req RentRequest) (Rental, error) {
+	release, err := limiterFor(m.server).acquire(ctx)
+	if err != nil {
+		return Rental{}, err
+	}
+	defer release()
+	allowed, probe := allow(m.server)
+	if !allowed {
+		return Rental{}, ErrServerDegraded
+	}
+	ctx, audit := traced(ctx, m.server, OpRentNumber)
+	start := time.Now()
+	var rental Rental
+	err = m.withFreshToken(ctx, cred, func(cred Credentials) error {
+		rental, err = m.Renter.RentNumber(ctx, cred, req)
+		return err
+	})
+	record(m.server, time.Since(start), err, probe)
+	audit(rental.ID)
+	return rental, err
+}
+
+func (m *monitoredRenter) RentStatus(ctx context.Context, cred Credentials, id string) ([]RentMessage, error) {
+	var messages []RentMessage
+	err := m.call(ctx, cred, OpRentStatus, id, func(ctx context.Context, cred Credentials) error {
+		var err error
+		messages, err = m.Renter.RentStatus(ctx, cred, id)
+		return err
+	})
+	return messages, err
+}
+
+func (m *monitoredRenter) ExtendRental(ctx context.Context, cred Credentials, id string, hours int) error {
+	return m.call(ctx, cred, OpExtendRental, id, func(ctx context.Context, cred Credentials) error {
+		return m.Renter.ExtendRental(ctx, cred, id, hours)
+	})
+}
+
+func (m *monitoredRenter) ReleaseRental(ctx context.Context, cred Credentials, id string, refund bool) error {
+	return m.call(ctx, cred, OpReleaseRental, id, func(ctx context.Context, cred Credentials) error {
+		return m.Renter.ReleaseRental(ctx, cred, id, refund)
+	})
+}
+
+// RentPrices is limited and audited like price lists, without counting
+// towards the server's health.
+func (m *monitoredRenter) RentPrices(ctx context.Context, cred Credentials, country string, hours int) ([]Price, error) {
+	release, err := limiterFor(m.server).acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	ctx, audit := traced(ctx, m.server, OpRentPrices)
+	defer audit("")
+	return m.Renter.RentPrices(ctx, cred, country, hours)
+}
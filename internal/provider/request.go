@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
+)
+
+// get performs an idempotent GET request through the shared upstream client
+// and returns the raw response body.
+func get(ctx context.Context, apiURL string, headers map[string]string) ([]byte, error) {
+	body, _, err := httpclient.Get(ctx, apiURL, headers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch API: %w", err)
+	}
+	if strings.TrimSpace(string(body)) == "" {
+		return nil, errors.New("RECEIVED_EMTPY_RESPONSE_FROM_THIRD_PARTY_SERVER")
+	}
+	return body, nil
+}
+
+// getOnce is get without retries, for calls that change state upstream.
+func getOnce(ctx context.Context, apiURL string, headers map[string]string) ([]byte, error) {
+	body, _, err := httpclient.GetOnce(ctx, apiURL, headers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch API: %w", err)
+	}
+	if strings.TrimSpace(string(body)) == "" {
+		return nil, errors.New("RECEIVED_EMTPY_RESPONSE_FROM_THIRD_PARTY_SERVER")
+	}
+	return body, nil
+}
+
+func bearer(token string) map[string]string {
+	return map[string]string{
+		"Authorization": fmt.Sprintf("Bearer %s", token),
+		"Accept":        "application/json",
+	}
+}
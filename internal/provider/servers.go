@@ -0,0 +1,83 @@
+package provider
+
+import "github.com/ranjankuldeep/fakeNumber/internal/database/models"
+
+// handlerAPIServers are the built-in handler_api providers. A server document
+// carrying its own provider config takes precedence over these.
+var handlerAPIServers = map[int]models.ProviderConfig{
+	1: {
+		BaseURL:    "https://fastsms.su/stubs/handler_api.php",
+		Country:    "22",
+		NextSMSAck: "ACCESS_WAITING",
+		CancelOK:   []string{"ACCESS_APPROVED", "STATUS_CANCEL"},
+		Currency:   CurrencyRUB,
+	},
+	3: {
+		BaseURL:      "https://smshub.org/stubs/handler_api.php",
+		Country:      "22",
+		Operator:     "any",
+		SendMaxPrice: true,
+		NextSMSAck:   "ACCESS_RETRY_GET",
+		CancelOK:     []string{"ALREADY_CANCELLED", "ACCESS_ACTIVATION"},
+		Currency:     CurrencyUSD,
+	},
+	4: {
+		BaseURL:  "https://api.tiger-sms.com/stubs/handler_api.php",
+		Country:  "22",
+		Currency: CurrencyRUB,
+	},
+	5: {
+		BaseURL:    "https://api.grizzlysms.com/stubs/handler_api.php",
+		Country:    "22",
+		NextSMSAck: "ACCESS_RETRY_GET",
+		Currency:   CurrencyRUB,
+	},
+	6: {
+		BaseURL:  "https://tempnum.org/stubs/handler_api.php",
+		Country:  "22",
+		Currency: CurrencyRUB,
+	},
+	7: {
+		BaseURL:      "https://smsbower.online/stubs/handler_api.php",
+		Country:      "22",
+		SendMaxPrice: true,
+		NextSMSAck:   "ACCESS_RETRY_GET",
+		Currency:     CurrencyRUB,
+	},
+	8: {
+		BaseURL:    "https://api.sms-activate.guru/stubs/handler_api.php",
+		Country:    "22",
+		Operator:   "any",
+		NextSMSAck: "ACCESS_RETRY_GET",
+		Currency:   CurrencyRUB,
+		Rent:       true,
+	},
+	10: {
+		BaseURL:  "https://sms-activation-service.pro/stubs/handler_api",
+		Country:  "22",
+		Operator: "any",
+		Currency: CurrencyUSD,
+	},
+}
+
+// The built-in providers, keyed by the server number customers see.
+func init() {
+	for server, cfg := range handlerAPIServers {
+		cfg.Protocol = ProtocolHandlerAPI
+		Register(server, NewHandlerAPI(cfg))
+	}
+	Register(2, &FiveSim{
+		BaseURL: "https://5sim.net",
+		Country: "india",
+	})
+	Register(9, &PhantomUnion{
+		BaseURL:   "http://www.phantomunion.com:10023",
+		BridgeURL: "https://php.paidsms.in/ccpay.php",
+		Country:   "IN",
+	})
+	Register(11, &SmsMan{
+		BaseURL:   "https://api.sms-man.com",
+		StatusURL: "https://api2.sms-man.com",
+		CountryID: "14",
+	})
+}
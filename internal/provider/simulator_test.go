@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/simulator"
+)
+
+// sim is the simulator every provider is redirected to while testing.
+var sim *simulator.Server
+
+func TestMain(m *testing.M) {
+	sim = simulator.New(simulator.DefaultScenario())
+	server := httptest.NewServer(sim)
+	Redirect(server.URL)
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+// TestSimulatorFlow runs get-number, get-otp and cancel against the
+// simulator for every protocol.
+func TestSimulatorFlow(t *testing.T) {
+	late := simulator.DefaultScenario()
+	late.SMSDelay = time.Hour
+	sim.SetServiceScenario("late", late)
+
+	for _, server := range []int{1, 2, 9, 11} {
+		p, err := ForServer(models.Server{ServerNumber: server})
+		if err != nil {
+			t.Fatalf("server %d: %v", server, err)
+		}
+		ctx := context.Background()
+		cred := Credentials{APIKey: "key", Token: "token"}
+
+		number, err := p.BuyNumber(ctx, cred, NumberRequest{Code: "tg"})
+		if err != nil {
+			t.Fatalf("server %d: buy: %v", server, err)
+		}
+		if number.ID == "" || number.Number == "" {
+			t.Fatalf("server %d: bought %+v", server, number)
+		}
+		otp, err := p.GetOTP(ctx, cred, number.ID)
+		if err != nil {
+			t.Fatalf("server %d: get otp: %v", server, err)
+		}
+		if len(otp) != 1 || !strings.Contains(otp[0], "123456") {
+			t.Fatalf("server %d: got otp %q", server, otp)
+		}
+
+		number, err = p.BuyNumber(ctx, cred, NumberRequest{Code: "late"})
+		if err != nil {
+			t.Fatalf("server %d: buy: %v", server, err)
+		}
+		otp, err = p.GetOTP(ctx, cred, number.ID)
+		if err != nil {
+			t.Fatalf("server %d: get otp: %v", server, err)
+		}
+		if len(otp) != 0 {
+			t.Fatalf("server %d: got otp %q before any SMS", server, otp)
+		}
+		if err := p.Cancel(ctx, cred, number.ID, number.Number); err != nil {
+			t.Fatalf("server %d: cancel: %v", server, err)
+		}
+	}
+}
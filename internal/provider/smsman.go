@@ -0,0 +1,162 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	serverscalc "github.com/ranjankuldeep/fakeNumber/internal/serversCalc"
+	serversnextotpcalc "github.com/ranjankuldeep/fakeNumber/internal/serversNextOtpCalc"
+	serversotpcalc "github.com/ranjankuldeep/fakeNumber/internal/serversOtpCalc"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+)
+
+// SmsMan speaks the sms-man.com control API. Status changes are served from
+// a separate host. CountryID is the sms-man id of India, the default country.
+type SmsMan struct {
+	BaseURL   string
+	StatusURL string
+	CountryID string
+}
+
+func (s *SmsMan) country(iso string) (string, Country, error) {
+	iso = NormalizeCountry(iso)
+	country, err := LookupCountry(iso)
+	if err != nil {
+		return "", Country{}, err
+	}
+	id, err := countryCode(iso, nil, s.CountryID, country.SmsMan)
+	return id, country, err
+}
+
+func (s *SmsMan) BuyNumber(ctx context.Context, cred Credentials, req NumberRequest) (Number, error) {
+	countryID, country, err := s.country(req.Country)
+	if err != nil {
+		return Number{}, err
+	}
+	if req.Operator != "" {
+		return Number{}, ErrOperatorNotSupported
+	}
+	params := url.Values{}
+	params.Set("token", cred.APIKey)
+	params.Set("application_id", req.Code)
+	params.Set("country_id", countryID)
+	params.Set("hasMultipleSms", strconv.FormatBool(req.Multiple))
+	number, id, err := serverscalc.ExtractNumberServer11(ctx, s.BaseURL+"/control/get-number?"+params.Encode())
+	if err != nil {
+		return Number{}, smsManError(err)
+	}
+	return Number{ID: id, Number: nationalNumber(number, country.CallingCode)}, nil
+}
+
+// smsManErrors maps sms-man error codes to provider errors.
+var smsManErrors = map[string]*Error{
+	"no_numbers":           ErrNoNumbers,
+	"no_money":             ErrProviderBalanceLow,
+	"wrong_token":          ErrBadKey,
+	"wrong_application_id": ErrServiceBanned,
+	"cancel_denied":        ErrEarlyCancelDenied,
+	"wrong_status":         ErrAlreadyFinished,
+}
+
+func smsManError(err error) error {
+	if known, ok := smsManErrors[err.Error()]; ok {
+		return known
+	}
+	return unexpected(err)
+}
+
+func (s *SmsMan) GetOTP(ctx context.Context, cred Credentials, id string) ([]string, error) {
+	params := url.Values{}
+	params.Set("token", cred.APIKey)
+	params.Set("request_id", id)
+	return serversotpcalc.GetOTPServer11(ctx, s.BaseURL+"/control/get-sms?"+params.Encode(), id)
+}
+
+func (s *SmsMan) setStatusURL(cred Credentials, id, status string) string {
+	params := url.Values{}
+	params.Set("token", cred.APIKey)
+	params.Set("request_id", id)
+	params.Set("status", status)
+	return s.StatusURL + "/control/set-status?" + params.Encode()
+}
+
+func (s *SmsMan) Cancel(ctx context.Context, cred Credentials, id, number string) error {
+	body, err := getOnce(ctx, s.setStatusURL(cred, id, "reject"), map[string]string{})
+	if err != nil {
+		return unexpected(err)
+	}
+	logs.Logger.Infof("Number Cancel Response %+v", string(body))
+
+	var responseDataJSON map[string]interface{}
+	if err := json.Unmarshal(body, &responseDataJSON); err != nil {
+		return unexpected(fmt.Errorf("failed to parse JSON response: %w", err))
+	}
+	if success, ok := responseDataJSON["success"].(bool); ok && success {
+		return nil
+	} else if responseDataJSON["error_code"] == "change_status" {
+		return nil
+	}
+	if errorCode, ok := responseDataJSON["error_code"].(string); ok {
+		return smsManError(errors.New(errorCode))
+	}
+	return unexpected(errors.New(string(body)))
+}
+
+func (s *SmsMan) RequestNextSMS(ctx context.Context, cred Credentials, id string) error {
+	return serversnextotpcalc.CallNextOTPServerUnMarshalling(ctx, s.setStatusURL(cred, id, "retrysms"), map[string]string{})
+}
+
+func (s *SmsMan) Balance(ctx context.Context, cred Credentials) (Balance, error) {
+	params := url.Values{}
+	params.Set("token", cred.APIKey)
+	body, err := get(ctx, s.BaseURL+"/control/get-balance?"+params.Encode(), map[string]string{})
+	if err != nil {
+		return Balance{}, unexpected(err)
+	}
+	var responseDataJSON struct {
+		Balance   string `json:"balance"`
+		ErrorCode string `json:"error_code"`
+	}
+	if err := json.Unmarshal(body, &responseDataJSON); err != nil {
+		return Balance{}, unexpected(fmt.Errorf("failed to parse JSON response: %w", err))
+	}
+	if responseDataJSON.ErrorCode != "" {
+		return Balance{}, smsManError(errors.New(responseDataJSON.ErrorCode))
+	}
+	floatValue, _ := strconv.ParseFloat(responseDataJSON.Balance, 64)
+	return balanceIn(floatValue, s.Currency()), nil
+}
+
+// Currency is RUB, which SMS-Man bills Indian numbers in.
+func (s *SmsMan) Currency() string {
+	return CurrencyRUB
+}
+
+func (s *SmsMan) Prices(ctx context.Context, cred Credentials, iso string) ([]Price, error) {
+	countryID, _, err := s.country(iso)
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	params.Set("token", cred.APIKey)
+	params.Set("country_id", countryID)
+	body, err := get(ctx, s.BaseURL+"/control/get-prices?"+params.Encode(), map[string]string{})
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	var prices handlerAPIPrices
+	if err := json.Unmarshal(body, &prices); err != nil {
+		var errorResponse struct {
+			ErrorCode string `json:"error_code"`
+		}
+		if json.Unmarshal(body, &errorResponse) == nil && errorResponse.ErrorCode != "" {
+			return nil, smsManError(errors.New(errorResponse.ErrorCode))
+		}
+		return nil, unexpected(fmt.Errorf("failed to parse JSON response: %w", err))
+	}
+	return prices.prices(countryID), nil
+}
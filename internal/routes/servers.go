@@ -17,4 +17,27 @@ func RegisterServerRoutes(e *echo.Echo) {
 	serverGroup.GET("get-token-server9", handlers.GetTokenForServer9)
 	serverGroup.POST("add-exchange-rate-margin-server", handlers.UpdateExchangeRateAndMargin)
 	serverGroup.POST("service-data-block-unblock", handlers.BlocKServer)
+	serverGroup.POST("service-operators", handlers.UpdateServiceOperators)
+	serverGroup.POST("server-provider", handlers.UpdateServerProvider)
+	serverGroup.GET("server-health", handlers.GetServerHealth)
+	serverGroup.GET("upstream-stats", handlers.GetUpstreamStats)
+	serverGroup.POST("server-rate-limit", handlers.UpdateServerRateLimit)
+	serverGroup.GET("server-limits", handlers.GetServerLimits)
+	serverGroup.GET("upstream-audit", handlers.GetUpstreamAudit)
+	serverGroup.GET("server-credentials", handlers.GetServerCredentials)
+	serverGroup.POST("server-credentials/refresh", handlers.RefreshServerCredentials)
+	serverGroup.GET("reconciliations", handlers.GetReconciliations)
+	serverGroup.POST("reconciliations/run", handlers.RunReconciliation)
+	serverGroup.GET("profit-report", handlers.GetProfitReport)
+	serverGroup.GET("exchange-rates", handlers.GetExchangeRates)
+	serverGroup.POST("exchange-rates/refresh", handlers.RefreshExchangeRates)
+	serverGroup.GET("pricing-rules", handlers.GetPricingRules)
+	serverGroup.POST("pricing-rules", handlers.SavePricingRule)
+	serverGroup.DELETE("pricing-rules", handlers.DeletePricingRule)
+	serverGroup.POST("pricing-rules/dry-run", handlers.DryRunPricing)
+	serverGroup.POST("pricing-rules/apply", handlers.ApplyPricingRules)
+	serverGroup.POST("server-balance-alert", handlers.UpdateServerBalanceAlert)
+	serverGroup.GET("server-balance-history", handlers.GetServerBalanceHistory)
+	serverGroup.POST("server-webhook-secret", handlers.UpdateWebhookSecret)
+	serverGroup.POST("webhooks/:server", handlers.HandleProviderWebhook)
 }
@@ -11,5 +11,17 @@ func RegisterServiceRoutes(e *echo.Echo) {
 	e.GET("/api/check-otp", handlers.HandleCheckOTP)
 	e.POST("/api/cancel-order", handlers.HandleCancelOrder)
 	e.GET("/api/get-otp", handlers.HandleGetOtp)
+	e.GET("/api/otp-stream", handlers.StreamOrderEvents)
+	e.GET("/api/otp-ws", handlers.StreamOrderEventsWS)
 	e.GET("/api/number-cancel", handlers.HandleNumberCancel)
+	e.GET("/api/rent-number", handlers.HandleRentNumber)
+	e.GET("/api/rentals", handlers.HandleListRentals)
+	e.GET("/api/rental-inbox", handlers.HandleRentalInbox)
+	e.GET("/api/extend-rental", handlers.HandleExtendRental)
+	e.GET("/api/release-rental", handlers.HandleReleaseRental)
+	e.GET("/api/customer-webhooks", handlers.GetCustomerWebhooks)
+	e.POST("/api/customer-webhooks", handlers.SaveCustomerWebhook)
+	e.DELETE("/api/customer-webhooks", handlers.DeleteCustomerWebhook)
+	e.GET("/api/customer-webhook-deliveries", handlers.GetWebhookDeliveries)
+	e.POST("/api/customer-webhook-deliveries/replay", handlers.ReplayWebhookDelivery)
 }
@@ -26,6 +26,7 @@ func RegisterUserRoutes(e *echo.Echo) {
 	e.GET("/api/blocked-user", handlers.BlockedUser)
 	e.GET("/api/get-all-blocked-users", handlers.GetAllBlockedUsers)
 	e.GET("/api/orders", handlers.GetOrdersByUserId)
+	e.GET("/api/order-history", handlers.GetOrderHistory)
 	e.POST("/api/edit-balance", handlers.UpdateWalletBalanceHandler)
 	e.POST("/api/edit-recharge", handlers.UpdateRechargeHandler)
 }
@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// auditQueueSize is how many provider calls can wait to be written before
+	// new ones are dropped, so a slow database never holds up provider calls.
+	auditQueueSize = 1000
+	auditBatchSize = 100
+	auditFlush     = 2 * time.Second
+)
+
+// StartUpstreamAudit persists the exchanges of every provider call to the
+// upstreamAudit collection.
+func StartUpstreamAudit(db *mongo.Database) {
+	collection := models.InitializeUpstreamAuditCollection(db)
+	queue := make(chan []provider.Exchange, auditQueueSize)
+	provider.OnExchanges(func(exchanges []provider.Exchange) {
+		select {
+		case queue <- exchanges:
+		default:
+			log.Printf("Upstream audit queue full, dropping %d exchanges of server %d", len(exchanges), exchanges[0].Server)
+		}
+	})
+
+	go func() {
+		ticker := time.NewTicker(auditFlush)
+		defer ticker.Stop()
+		var batch []interface{}
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if _, err := collection.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false)); err != nil {
+				log.Printf("Error writing upstream audit: %v", err)
+			}
+			batch = nil
+		}
+		for {
+			select {
+			case exchanges := <-queue:
+				for _, exchange := range exchanges {
+					batch = append(batch, models.UpstreamAudit{
+						Server:       exchange.Server,
+						Operation:    exchange.Operation,
+						ActivationID: exchange.ActivationID,
+						Method:       exchange.Method,
+						URL:          exchange.URL,
+						Status:       exchange.Status,
+						LatencyMs:    exchange.Latency.Milliseconds(),
+						Attempt:      exchange.Attempt,
+						Body:         exchange.Body,
+						Error:        exchange.Error,
+						CreatedAt:    exchange.StartedAt,
+					})
+				}
+				if len(batch) >= auditBatchSize {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+}
@@ -0,0 +1,153 @@
+package runner
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
+	"github.com/ranjankuldeep/fakeNumber/internal/services"
+	"github.com/ranjankuldeep/fakeNumber/internal/utils"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// lowBalanceServers are the servers already alerted as low, so each drop
+// below the threshold is only reported once.
+var lowBalanceServers = make(map[int]bool)
+
+// StartBalanceMonitor samples every server's provider balance every
+// BALANCE_MONITOR_INTERVAL (default 10m).
+func StartBalanceMonitor(db *mongo.Database) {
+	interval := 10 * time.Minute
+	if value := os.Getenv("BALANCE_MONITOR_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid BALANCE_MONITOR_INTERVAL %q, using %s", value, interval)
+		} else {
+			interval = parsed
+		}
+	}
+	for {
+		if err := CheckServerBalances(db); err != nil {
+			log.Printf("Error in CheckServerBalances: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// CheckServerBalances stores a balance sample for every server and alerts on
+// servers whose balance crossed their LowBalanceThreshold. Servers with
+// AutoMaintenance are put into maintenance while low, and taken out again
+// once the balance is back above the threshold.
+func CheckServerBalances(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	serverCollection := models.InitializeServerCollection(db)
+	cursor, err := serverCollection.Find(ctx, bson.M{"server": bson.M{"$ne": 0}})
+	if err != nil {
+		return err
+	}
+	var servers []models.Server
+	if err := cursor.All(ctx, &servers); err != nil {
+		return err
+	}
+
+	balanceCollection := models.InitializeServerBalanceCollection(db)
+	for _, serverInfo := range servers {
+		if serverInfo.Block {
+			continue
+		}
+		prov, err := provider.ForServer(serverInfo)
+		if err != nil {
+			continue
+		}
+		balance, err := prov.Balance(context.Background(), provider.Credentials{APIKey: serverInfo.APIKey, Token: serverInfo.Token})
+		if err != nil {
+			logs.Logger.Errorf("failed to fetch balance for server %d: %v", serverInfo.ServerNumber, err)
+			continue
+		}
+		_, err = balanceCollection.InsertOne(ctx, models.ServerBalance{
+			Server:    serverInfo.ServerNumber,
+			Balance:   balance.Value,
+			Symbol:    balance.Symbol,
+			Currency:  balance.Currency,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			logs.Logger.Error(err)
+		}
+
+		if serverInfo.LowBalanceThreshold <= 0 {
+			continue
+		}
+		low := balance.Value < serverInfo.LowBalanceThreshold
+		details := services.ServerBalanceDetails{
+			Server:    serverInfo.ServerNumber,
+			Balance:   balance.Value,
+			Symbol:    balance.Symbol,
+			Threshold: serverInfo.LowBalanceThreshold,
+			Recovered: !low,
+		}
+
+		switch {
+		case low && !lowBalanceServers[serverInfo.ServerNumber]:
+			lowBalanceServers[serverInfo.ServerNumber] = true
+			if serverInfo.AutoMaintenance && !serverInfo.Maintenance {
+				_, err := serverCollection.UpdateOne(ctx, bson.M{"server": serverInfo.ServerNumber}, bson.M{
+					"$set": bson.M{"maintainance": true, "balanceMaintenance": true},
+				})
+				if err != nil {
+					logs.Logger.Error(err)
+				} else {
+					details.Maintenance = true
+				}
+			}
+			sendBalanceAlert(details)
+		case !low && (lowBalanceServers[serverInfo.ServerNumber] || serverInfo.BalanceMaintenance):
+			delete(lowBalanceServers, serverInfo.ServerNumber)
+			if serverInfo.BalanceMaintenance {
+				_, err := serverCollection.UpdateOne(ctx, bson.M{"server": serverInfo.ServerNumber}, bson.M{
+					"$set":   bson.M{"maintainance": false},
+					"$unset": bson.M{"balanceMaintenance": ""},
+				})
+				if err != nil {
+					logs.Logger.Error(err)
+				} else {
+					details.Maintenance = true
+				}
+			}
+			sendBalanceAlert(details)
+		}
+	}
+	return nil
+}
+
+// sendBalanceAlert notifies the admins on Telegram and, when
+// BALANCE_ALERT_EMAILS lists addresses, by email.
+func sendBalanceAlert(details services.ServerBalanceDetails) {
+	if err := services.ServerBalanceTeleBot(details); err != nil {
+		logs.Logger.Error(err)
+	}
+	var to []string
+	for _, email := range strings.Split(os.Getenv("BALANCE_ALERT_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			to = append(to, email)
+		}
+	}
+	if len(to) == 0 {
+		return
+	}
+	subject := "Server Balance Low"
+	if details.Recovered {
+		subject = "Server Balance Restored"
+	}
+	if err := utils.SendEmail(to, subject, services.ServerBalanceMessage(details)); err != nil {
+		logs.Logger.Error(err)
+	}
+}
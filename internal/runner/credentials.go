@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StartCredentialRotation stores every provider token refresh on its server
+// document and refreshes tokens ahead of expiry, checking every
+// CREDENTIAL_CHECK_INTERVAL (default 5m).
+func StartCredentialRotation(db *mongo.Database) {
+	interval := 5 * time.Minute
+	if value := os.Getenv("CREDENTIAL_CHECK_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid CREDENTIAL_CHECK_INTERVAL %q, using %s", value, interval)
+		} else {
+			interval = parsed
+		}
+	}
+	provider.OnTokenRefresh(func(refresh provider.TokenRefresh) {
+		storeTokenRefresh(db, refresh)
+	})
+	for {
+		if err := RotateCredentials(db); err != nil {
+			log.Printf("Error in RotateCredentials: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// RotateCredentials refreshes the token of every server whose provider
+// hands out tokens and whose token is missing or close to expiry.
+func RotateCredentials(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	cursor, err := models.InitializeServerCollection(db).Find(ctx, bson.M{"server": bson.M{"$ne": 0}})
+	if err != nil {
+		return err
+	}
+	var servers []models.Server
+	if err := cursor.All(ctx, &servers); err != nil {
+		return err
+	}
+	for _, server := range servers {
+		refresher, err := provider.TokenRefresherFor(server)
+		if err != nil || server.APIKey == "" || !provider.TokenDue(server, refresher) {
+			continue
+		}
+		if _, err := provider.RefreshToken(ctx, server); err != nil {
+			log.Printf("Error refreshing token for server %d: %v", server.ServerNumber, err)
+		}
+	}
+	return nil
+}
+
+func storeTokenRefresh(db *mongo.Database, refresh provider.TokenRefresh) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var update bson.M
+	if refresh.Err != nil {
+		update = bson.M{"$set": bson.M{"tokenError": refresh.Err.Error()}}
+	} else {
+		update = bson.M{
+			"$set": bson.M{
+				"token":            refresh.Token.Value,
+				"tokenExpiresAt":   refresh.Token.ExpiresAt,
+				"tokenRefreshedAt": refresh.At,
+				"updatedAt":        refresh.At,
+			},
+			"$unset": bson.M{"tokenError": ""},
+		}
+	}
+	_, err := models.InitializeServerCollection(db).UpdateOne(ctx, bson.M{"server": refresh.Server}, update)
+	if err != nil {
+		log.Printf("Error storing token for server %d: %v", refresh.Server, err)
+	}
+}
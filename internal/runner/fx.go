@@ -0,0 +1,41 @@
+package runner
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StartExchangeRateUpdater fetches exchange rates every FX_RATES_INTERVAL
+// (default 6h) and moves the exchange rate of servers without a manual
+// override, repricing their catalog when the rate moved far enough.
+func StartExchangeRateUpdater(db *mongo.Database) {
+	interval := 6 * time.Hour
+	if value := os.Getenv("FX_RATES_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid FX_RATES_INTERVAL %q, using %s", value, interval)
+		} else {
+			interval = parsed
+		}
+	}
+	for {
+		time.Sleep(interval)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		updates, err := handlers.UpdateExchangeRates(ctx, db)
+		cancel()
+		if err != nil {
+			log.Printf("Error in UpdateExchangeRates: %v", err)
+			continue
+		}
+		for _, update := range updates {
+			if update.Skipped == "" {
+				log.Printf("Exchange rate of server %d moved from %.4f to %.4f, %d entries repriced", update.Server, update.OldRate, update.Rate, update.Repriced)
+			}
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package runner
 
 import (
+	"container/heap"
 	"context"
+	"errors"
 	"log"
-	"math"
+	"os"
 	"strconv"
 	"time"
 
@@ -13,76 +15,149 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// expiryQueue is a min-heap of orders by expiration time.
+type expiryQueue []models.Order
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].ExpirationTime.Before(q[j].ExpirationTime) }
+func (q expiryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *expiryQueue) Push(x any)        { *q = append(*q, x.(models.Order)) }
+func (q *expiryQueue) Pop() any {
+	old := *q
+	order := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return order
+}
+
+// MonitorOrders expires orders at their deadline. Every
+// ORDER_EXPIRY_INTERVAL (default 30s) it loads the active orders expiring
+// within the next two intervals, by the status and expirationTime index, into
+// a heap, and hands each to one of ORDER_EXPIRY_WORKERS (default 8) workers
+// when its deadline passes. Orders live at least minutes, so none expires
+// before a load has seen it.
+//
+// Ending an order is a conditional state transition, so when several
+// instances run, or an order is cancelled as it expires, only one of them
+// refunds it and cancels its number.
 func MonitorOrders(db *mongo.Database) {
-	orderCollection := models.InitializeOrderCollection(db)
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ticker.C:
-			var orders []models.Order
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			cursor, err := orderCollection.Find(ctx, bson.M{})
-			if err != nil {
-				log.Printf("Error finding orders: %v", err)
-				continue
-			}
-			defer cursor.Close(ctx)
+	interval := 30 * time.Second
+	if value := os.Getenv("ORDER_EXPIRY_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid ORDER_EXPIRY_INTERVAL %q, using %s", value, interval)
+		} else {
+			interval = parsed
+		}
+	}
+	workers := 8
+	if value := os.Getenv("ORDER_EXPIRY_WORKERS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid ORDER_EXPIRY_WORKERS %q, using %d", value, workers)
+		} else {
+			workers = parsed
+		}
+	}
 
-			if err := cursor.All(ctx, &orders); err != nil {
-				log.Printf("Error decoding orders: %v", err)
-				continue
+	due := make(chan models.Order)
+	done := make(chan primitive.ObjectID)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for order := range due {
+				expireOrder(order, db)
+				done <- order.ID
 			}
+		}()
+	}
 
-			for _, order := range orders {
-				go handleOrder(order.UserID, db)
+	var queue expiryQueue
+	// scheduled holds the orders queued or being expired, so a load does not
+	// queue them twice.
+	scheduled := make(map[primitive.ObjectID]bool)
+	load := func() {
+		orders, err := loadExpiringOrders(db, time.Now().Add(2*interval))
+		if err != nil {
+			log.Printf("Error loading expiring orders: %v", err)
+			return
+		}
+		for _, order := range orders {
+			if !scheduled[order.ID] {
+				scheduled[order.ID] = true
+				heap.Push(&queue, order)
 			}
 		}
 	}
-}
 
-func handleOrder(userId primitive.ObjectID, db *mongo.Database) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("Recovered from panic in OTP handling goroutine: %v", r)
+	load()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	var ready []models.Order
+	for {
+		now := time.Now()
+		for queue.Len() > 0 && !queue[0].ExpirationTime.After(now) {
+			ready = append(ready, heap.Pop(&queue).(models.Order))
+		}
+		if queue.Len() > 0 {
+			timer.Reset(queue[0].ExpirationTime.Sub(now))
+		} else {
+			timer.Reset(interval)
 		}
-	}()
 
-	orderCollection := models.InitializeOrderCollection(db)
+		var send chan models.Order
+		var next models.Order
+		if len(ready) > 0 {
+			send, next = due, ready[0]
+		}
+		select {
+		case send <- next:
+			ready = ready[1:]
+		case id := <-done:
+			delete(scheduled, id)
+		case <-ticker.C:
+			load()
+		case <-timer.C:
+		}
+	}
+}
+
+// loadExpiringOrders returns the active orders expiring by a time, soonest
+// first.
+func loadExpiringOrders(db *mongo.Database, by time.Time) ([]models.Order, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	orderFilter := bson.M{"userId": userId}
-	cursor, err := orderCollection.Find(ctx, orderFilter)
+	filter := models.ActiveOrders()
+	filter["expirationTime"] = bson.M{"$lte": by}
+	opts := options.Find().SetSort(bson.D{{Key: "expirationTime", Value: 1}}).SetLimit(5000)
+	cursor, err := models.InitializeOrderCollection(db).Find(ctx, filter, opts)
 	if err != nil {
-		return
+		return nil, err
 	}
-	defer cursor.Close(ctx)
-
 	var orders []models.Order
-	for cursor.Next(ctx) {
-		var order models.Order
-		if err := cursor.Decode(&order); err != nil {
-			log.Printf("Error decoding order: %v", err)
-			return
-		}
-		orders = append(orders, order)
-	}
-
-	if err := cursor.Err(); err != nil {
-		log.Printf("Cursor error: %v", err)
-		return
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
 	}
+	return orders, nil
+}
 
-	for _, order := range orders {
-		go processOrder(order, db)
-	}
+// expireOrder runs processOrder, recovering from a panic so a worker
+// survives it.
+func expireOrder(order models.Order, db *mongo.Database) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic expiring order %s: %v", order.NumberID, r)
+		}
+	}()
+	processOrder(order, db)
 }
 
-// processOrder handles expiration logic and checks OTP status for an order
+// processOrder ends an order once it expires: FINISHED when an OTP arrived,
+// else EXPIRED and refunded, with the number cancelled at the provider.
 func processOrder(order models.Order, db *mongo.Database) {
 	expirationTime := order.ExpirationTime
 	currentTime := time.Now()
@@ -95,105 +170,109 @@ func processOrder(order models.Order, db *mongo.Database) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// The order was queued a while ago; skip it if it ended since, such as
+	// by the customer cancelling it.
+	filter := models.ActiveOrders()
+	filter["_id"] = order.ID
+	err := models.InitializeOrderCollection(db).FindOne(ctx, filter).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return
+	}
+	if err != nil {
+		log.Printf("Error reloading order %s: %v", order.NumberID, err)
+		return
+	}
+
 	transactionFilter := bson.M{
 		"userId": order.UserID.Hex(),
 		"id":     order.NumberID,
 	}
 
 	var transactionData models.TransactionHistory
-	err := transactionCollection.FindOne(ctx, transactionFilter).Decode(&transactionData)
+	err = transactionCollection.FindOne(ctx, transactionFilter).Decode(&transactionData)
 	if err != nil {
 		return
 	}
 
+	var serverInfo models.Server
+	serverCollection := models.InitializeServerCollection(db)
+	err = serverCollection.FindOne(ctx, bson.M{"server": order.Server}).Decode(&serverInfo)
+	if err != nil {
+		log.Printf("Error finding server info for order %s: %v", order.NumberID, err)
+		return
+	}
+
 	otpArrived := false
 	if len(transactionData.OTP) != 0 {
 		otpArrived = true
-	}
-
-	formattedData := handlers.FormatDateTime()
-	if otpArrived {
-		orderCollection := models.InitializeOrderCollection(db)
-		_, err = orderCollection.DeleteOne(ctx, bson.M{"numberId": order.NumberID})
+	} else {
+		// Last look for an SMS that arrived since the poller's last round.
+		otps, err := handlers.PollOrder(ctx, db, serverInfo, order)
 		if err != nil {
-			logs.Logger.Error(err)
-			return
+			log.Printf("Error polling OTP of expiring order %s: %v", order.NumberID, err)
 		}
-		return
-	}
-
-	// Refund the balnce
-	var apiWalletUser models.ApiWalletUser
-	apiWalletColl := models.InitializeApiWalletuserCollection(db)
-	err = apiWalletColl.FindOne(ctx, bson.M{"userId": order.UserID}).Decode(&apiWalletUser)
-	if err != nil || err == mongo.ErrEmptySlice {
-		logs.Logger.Error(err)
-		return
+		otpArrived = len(otps) != 0
 	}
 
-	var existingCancelledTransaction models.TransactionHistory
-	err = transactionCollection.FindOne(ctx, bson.M{"id": order.NumberID}).Decode(&existingCancelledTransaction)
-	if err != nil {
-		logs.Logger.Error(err)
-		return
-	}
-
-	transactionUpdateFilter := bson.M{"id": order.NumberID}
-	transactionpdate := bson.M{
-		"$set": bson.M{
-			"status":    "CANCELLED",
-			"date_time": formattedData,
-		},
-	}
-
-	_, err = transactionCollection.UpdateOne(ctx, transactionUpdateFilter, transactionpdate)
-	if err != nil {
-		logs.Logger.Error(err)
+	if otpArrived {
+		finishOrder(ctx, db, order)
 		return
 	}
 
 	// Refund the balance if no otp arrived
-	price, err := strconv.ParseFloat(existingCancelledTransaction.Price, 64)
-	newBalance := apiWalletUser.Balance + price
-	newBalance = math.Round(newBalance*100) / 100
-
-	update := bson.M{
-		"$set": bson.M{"balance": newBalance},
+	err = handlers.RefundOrder(ctx, db, order, models.StateExpired, "expired without sms")
+	if errors.Is(err, handlers.ErrInvalidTransition) {
+		// An SMS may have been stored since the order was read; such an
+		// order is finished rather than left active.
+		if current, ok := reloadActiveOrder(ctx, db, order); ok {
+			log.Printf("Order %s in %s refused %s, finishing it", order.NumberID, current.Status, models.StateExpired)
+			finishOrder(ctx, db, current)
+		}
+		return
 	}
-	balanceFilter := bson.M{"userId": apiWalletUser.UserID}
-
-	_, err = apiWalletColl.UpdateOne(ctx, balanceFilter, update)
 	if err != nil {
 		logs.Logger.Error(err)
 		return
 	}
 
 	// Perform third-party cancellation
-	var serverInfo models.Server
-	serverCollection := models.InitializeServerCollection(db)
-	err = serverCollection.FindOne(ctx, bson.M{"server": order.Server}).Decode(&serverInfo)
+	err = handlers.CancelNumberThirdParty(context.Background(), serverInfo, order.NumberID, order.Number)
 	if err != nil {
-		log.Printf("Error finding server info for order %s: %v", order.NumberID, err)
-		return
-	}
-
-	server := strconv.Itoa(serverInfo.ServerNumber)
-	constructedNumberRequest, err := handlers.ConstructNumberUrl(server, serverInfo.APIKey, serverInfo.Token, order.NumberID, order.Number)
-	if err != nil {
-		log.Printf("Error constructing third-party request: %v", err)
+		log.Printf("Error canceling number via third party: %v", err)
 		return
 	}
+}
 
-	orderCollection := models.InitializeOrderCollection(db)
-	_, err = orderCollection.DeleteOne(ctx, bson.M{"numberId": order.NumberID})
-	if err != nil {
-		logs.Logger.Error(err)
-		return
+// finishOrder ends an expired order that got an SMS. An order moved by
+// someone else meanwhile is finished from the state it is in now. One it
+// still cannot finish is logged with the state that refused it; it stays
+// due, so the next load retries it.
+func finishOrder(ctx context.Context, db *mongo.Database, order models.Order) {
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err := handlers.FinishOrder(ctx, db, order, "expired")
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, handlers.ErrInvalidTransition) {
+			logs.Logger.Error(err)
+			return
+		}
+		current, ok := reloadActiveOrder(ctx, db, order)
+		if !ok {
+			return
+		}
+		log.Printf("Order %s in %s refused %s", order.NumberID, current.Status, models.StateFinished)
+		order = current
 	}
+}
 
-	err = handlers.CancelNumberThirdParty(constructedNumberRequest.URL, server, order.NumberID, db, constructedNumberRequest.Headers)
-	if err != nil {
-		log.Printf("Error canceling number via third party: %v", err)
-		return
+// reloadActiveOrder returns the order as stored now, if it is still active.
+func reloadActiveOrder(ctx context.Context, db *mongo.Database, order models.Order) (models.Order, bool) {
+	filter := models.ActiveOrders()
+	filter["_id"] = order.ID
+	var current models.Order
+	if err := models.InitializeOrderCollection(db).FindOne(ctx, filter).Decode(&current); err != nil {
+		return order, false
 	}
+	return current, true
 }
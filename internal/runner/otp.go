@@ -0,0 +1,173 @@
+package runner
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// otpPollConcurrency is how many orders of one server are polled at a
+	// time, on top of the server's own outbound limits.
+	otpPollConcurrency = 4
+	// maxOtpPollBackoff caps how long a failing server is left alone.
+	maxOtpPollBackoff = 2 * time.Minute
+)
+
+// otpPollBackoff is how a server's recent polls went.
+type otpPollBackoff struct {
+	failures int
+	until    time.Time
+}
+
+// StartOtpPoller fetches the SMS of every active order from its provider
+// every OTP_POLL_INTERVAL (default 5s), so OTPs are recorded whether or not
+// the customer is still polling get-otp. Servers are polled independently;
+// one whose poll fails is skipped for twice as long after each consecutive
+// failure, up to two minutes. An order is leased for an interval before it
+// is polled, so however many instances run, each order is polled once an
+// interval.
+func StartOtpPoller(db *mongo.Database) {
+	interval := 5 * time.Second
+	if value := os.Getenv("OTP_POLL_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid OTP_POLL_INTERVAL %q, using %s", value, interval)
+		} else {
+			interval = parsed
+		}
+	}
+
+	var mu sync.Mutex
+	backoff := make(map[int]*otpPollBackoff)
+	polling := make(map[int]bool)
+	for {
+		time.Sleep(interval)
+		orders, err := loadPollableOrders(db)
+		if err != nil {
+			log.Printf("Error loading orders to poll: %v", err)
+			continue
+		}
+		byServer := make(map[int][]models.Order)
+		for _, order := range orders {
+			byServer[order.Server] = append(byServer[order.Server], order)
+		}
+
+		now := time.Now()
+		mu.Lock()
+		for server, serverOrders := range byServer {
+			state, ok := backoff[server]
+			if !ok {
+				state = &otpPollBackoff{}
+				backoff[server] = state
+			}
+			if polling[server] || now.Before(state.until) {
+				continue
+			}
+			polling[server] = true
+			go func(server int, serverOrders []models.Order) {
+				err := pollServerOrders(db, server, serverOrders, interval)
+				mu.Lock()
+				defer mu.Unlock()
+				polling[server] = false
+				state := backoff[server]
+				if err == nil {
+					state.failures = 0
+					state.until = time.Time{}
+					return
+				}
+				state.failures++
+				wait := interval << state.failures
+				if wait > maxOtpPollBackoff || wait <= 0 {
+					wait = maxOtpPollBackoff
+				}
+				state.until = time.Now().Add(wait)
+				log.Printf("Error polling OTPs of server %d, backing off %s: %v", server, wait, err)
+			}(server, serverOrders)
+		}
+		mu.Unlock()
+	}
+}
+
+// loadPollableOrders returns the active orders that have not expired yet.
+func loadPollableOrders(db *mongo.Database) ([]models.Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := models.ActiveOrders()
+	filter["expirationTime"] = bson.M{"$gt": time.Now()}
+	cursor, err := models.InitializeOrderCollection(db).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var orders []models.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// pollServerOrders polls the orders of one server it can lease for lease, a
+// few at a time, and returns the first error a poll failed with.
+func pollServerOrders(db *mongo.Database, server int, orders []models.Order, lease time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var serverInfo models.Server
+	err := models.InitializeServerCollection(db).FindOne(ctx, bson.M{"server": server}).Decode(&serverInfo)
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	slots := make(chan struct{}, otpPollConcurrency)
+	for _, order := range orders {
+		leased, err := leaseOrderPoll(ctx, db, order, lease)
+		if err != nil {
+			once.Do(func() { firstErr = err })
+			break
+		}
+		if !leased {
+			continue
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(order models.Order) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if _, err := handlers.PollOrder(ctx, db, serverInfo, order); err != nil {
+				once.Do(func() { firstErr = err })
+			}
+		}(order)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// leaseOrderPoll claims the next poll of an order for lease, unless another
+// instance holds it.
+func leaseOrderPoll(ctx context.Context, db *mongo.Database, order models.Order, lease time.Duration) (bool, error) {
+	now := time.Now()
+	result, err := models.InitializeOrderCollection(db).UpdateOne(ctx,
+		bson.M{"_id": order.ID, "$or": bson.A{
+			bson.M{"pollLeaseUntil": bson.M{"$exists": false}},
+			bson.M{"pollLeaseUntil": bson.M{"$lte": now}},
+		}},
+		bson.M{"$set": bson.M{"pollLeaseUntil": now.Add(lease)}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
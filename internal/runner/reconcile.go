@@ -0,0 +1,43 @@
+package runner
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StartReconciler compares our orders with every provider's activations
+// every RECONCILE_INTERVAL (default 15m). Drift is only recorded unless
+// RECONCILE_AUTOFIX is "true", which also cancels stray activations
+// upstream.
+func StartReconciler(db *mongo.Database) {
+	interval := 15 * time.Minute
+	if value := os.Getenv("RECONCILE_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid RECONCILE_INTERVAL %q, using %s", value, interval)
+		} else {
+			interval = parsed
+		}
+	}
+	fix := os.Getenv("RECONCILE_AUTOFIX") == "true"
+	for {
+		time.Sleep(interval)
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		reports, err := handlers.Reconcile(ctx, db, fix)
+		cancel()
+		if err != nil {
+			log.Printf("Error in Reconcile: %v", err)
+			continue
+		}
+		for _, report := range reports {
+			if len(report.Drifts) > 0 {
+				log.Printf("Reconciled server %d: %d activations, %d drifted", report.Server, report.Activations, len(report.Drifts))
+			}
+		}
+	}
+}
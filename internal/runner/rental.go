@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const rentalExpiryInterval = time.Minute
+
+// StartRentalExpiry marks rentals whose time is up as expired, once a
+// minute. The inbox of each is read a last time first, so SMS received just
+// before the end are kept.
+func StartRentalExpiry(db *mongo.Database) {
+	ticker := time.NewTicker(rentalExpiryInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ExpireRentals(db)
+	}
+}
+
+// ExpireRentals marks every active rental past its end as expired.
+func ExpireRentals(db *mongo.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), rentalExpiryInterval)
+	defer cancel()
+
+	rentalCollection := models.InitializeRentalCollection(db)
+	cursor, err := rentalCollection.Find(ctx, bson.M{"status": models.RentalActive, "endsAt": bson.M{"$lte": time.Now()}})
+	if err != nil {
+		log.Printf("Error finding expired rentals: %v", err)
+		return
+	}
+	var rentals []models.Rental
+	if err := cursor.All(ctx, &rentals); err != nil {
+		log.Printf("Error decoding expired rentals: %v", err)
+		return
+	}
+
+	for _, rental := range rentals {
+		if _, err := handlers.SyncRentalInbox(ctx, db, rental); err != nil {
+			log.Printf("Error reading final inbox of rental %s: %v", rental.ID.Hex(), err)
+		}
+		_, err := rentalCollection.UpdateOne(ctx,
+			bson.M{"_id": rental.ID, "status": models.RentalActive, "endsAt": rental.EndsAt},
+			bson.M{"$set": bson.M{"status": models.RentalExpired, "updatedAt": time.Now()}},
+		)
+		if err != nil {
+			log.Printf("Error expiring rental %s: %v", rental.ID.Hex(), err)
+		}
+	}
+}
@@ -122,6 +122,19 @@ func SendSellingUpdate(db *mongo.Database) (services.SellingUpdateDetails, error
 		details.ServerUpdates[serverNumber] = result.Count
 	}
 
+	// Revenue, provider cost and gross profit of the numbers sold
+	profitRows, err := handlers.ProfitReport(ctx, db, "server", startOfDayStr, endOfDayStr)
+	if err != nil {
+		return details, fmt.Errorf("failed to aggregate profit data: %w", err)
+	}
+	for _, row := range profitRows {
+		details.ProfitDetails.Revenue += row.Revenue
+		details.ProfitDetails.Cost += row.Cost
+	}
+	details.ProfitDetails.Revenue = math.Round(details.ProfitDetails.Revenue*100) / 100
+	details.ProfitDetails.Cost = math.Round(details.ProfitDetails.Cost*100) / 100
+	details.ProfitDetails.Profit = math.Round((details.ProfitDetails.Revenue-details.ProfitDetails.Cost)*100) / 100
+
 	// 3. Fetch Recharge Details
 	rechargeCollection := models.InitializeRechargeHistoryCollection(db)
 
@@ -217,7 +230,7 @@ func SendSellingUpdate(db *mongo.Database) (services.SellingUpdateDetails, error
 		serverID := strconv.Itoa(i)
 
 		// Call GetServerBalance for each server
-		balance, err := handlers.GetServerBalance(db, serverID)
+		balance, err := handlers.GetServerBalance(context.Background(), db, serverID)
 		if err != nil {
 			logs.Logger.Warnf("Failed to fetch balance for server %d: %v", i, err)
 			continue // Skip this server and move to the next one
@@ -2,106 +2,276 @@ package runner
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"strconv"
+	"os"
+	"sort"
 	"time"
 
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
 	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
+	"github.com/ranjankuldeep/fakeNumber/internal/provider"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type ServerDataUpload struct {
-	Server int    `bson:"server" json:"server"`
-	Price  string `bson:"price" json:"price"`
-	Code   string `bson:"code" json:"code"`
-	Otp    string `bson:"otp" json:"otp"`
+type serverCode struct {
+	server  int
+	code    string
+	country string
 }
 
-type ServerListUpload struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty"`
-	Name         string             `bson:"name" json:"name"`
-	Service_Code string             `bson:"service_code" json:"service_code"`
-	Servers      []ServerDataUpload `bson:"servers" json:"servers"`
-	CreatedAt    time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
-	UpdatedAt    time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
-}
-
-func FetchServerData(url string) ([]ServerListUpload, error) {
-	resp, err := http.Get(url)
+// UpdateServerData rebuilds the service list from each provider's own price
+// and stock list. Provider codes are mapped to our service names through the
+// existing service list first and the serviceCodes collection second; codes
+// we cannot map are skipped. Every country a server sells in is synced as its
+// own entries. Servers whose provider has no price list, whose price list
+// cannot be fetched or that have no exchange rate keep their current entries.
+// Services no server lists any more are only removed when every price list
+// was fetched, so a partial sync removes nothing. Servers that rent numbers
+// also get their rent prices by rental period. Prices are set by the pricing
+// engine.
+func UpdateServerData(db *mongo.Database, ctx context.Context) error {
+	serverListCollection := models.InitializeServerListCollection(db)
+	cursor, err := serverListCollection.Find(ctx, bson.M{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch data: %w", err)
+		return fmt.Errorf("failed to load service list: %w", err)
+	}
+	var existing []models.ServerList
+	if err := cursor.All(ctx, &existing); err != nil {
+		return fmt.Errorf("failed to decode service list: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	names := make(map[serverCode]string)
+	current := make(map[serverCode]models.ServerData)
+	serviceCodes := make(map[string]string)
+	for _, service := range existing {
+		if service.Service_Code != "" {
+			serviceCodes[service.Name] = service.Service_Code
+		}
+		for _, server := range service.Servers {
+			key := serverCode{server.Server, server.Code, provider.NormalizeCountry(server.Country)}
+			names[key] = service.Name
+			current[key] = server
+		}
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	codeNames := make(map[string]string)
+	cursor, err = models.InitializeServiceCodeCollection(db).Find(ctx, bson.M{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return fmt.Errorf("failed to load service codes: %w", err)
 	}
-
-	var serverData []ServerListUpload
-	if err := json.Unmarshal(body, &serverData); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
+	var codes []models.ServiceCode
+	if err := cursor.All(ctx, &codes); err != nil {
+		return fmt.Errorf("failed to decode service codes: %w", err)
+	}
+	for _, code := range codes {
+		codeNames[code.Code] = code.Name
+		if _, ok := serviceCodes[code.Name]; !ok {
+			serviceCodes[code.Name] = code.Code
+		}
 	}
-	return serverData, nil
-}
 
-func UpdateServerData(db *mongo.Database, ctx context.Context) error {
-	url := "https://php.paidsms.in/final.php"
-	serverData, err := FetchServerData(url)
+	marginMap, exchangeMap, err := handlers.FetchMarginAndExchangeRate(ctx, db)
 	if err != nil {
 		logs.Logger.Error(err)
 		return err
 	}
-	marginMap, exchangeMap, err := handlers.FetchMarginAndExchangeRate(ctx, db)
+	engine, err := handlers.LoadPricingEngine(ctx, db)
 	if err != nil {
-		logs.Logger.Error(err)
 		return err
 	}
 
-	for serviceIndex, service := range serverData {
-		for serverIndex, server := range service.Servers {
-			priceFloat, err := strconv.ParseFloat(server.Price, 64)
+	cursor, err = models.InitializeServerCollection(db).Find(ctx, bson.M{"server": bson.M{"$ne": 0}})
+	if err != nil {
+		return fmt.Errorf("failed to load servers: %w", err)
+	}
+	var servers []models.Server
+	if err := cursor.All(ctx, &servers); err != nil {
+		return fmt.Errorf("failed to decode servers: %w", err)
+	}
+
+	type serverCountry struct {
+		server  int
+		country string
+	}
+	catalog := make(map[string][]models.ServerData)
+	synced := make(map[serverCountry]bool)
+	complete := true
+	for _, serverInfo := range servers {
+		cataloger, err := provider.CatalogerFor(serverInfo)
+		if err != nil {
+			continue
+		}
+		exchange, margin := exchangeMap[serverInfo.ServerNumber], marginMap[serverInfo.ServerNumber]
+		if exchange <= 0 {
+			logs.Logger.Errorf("server %d has no exchange rate, keeping its prices", serverInfo.ServerNumber)
+			complete = false
+			continue
+		}
+		countries := serverInfo.Countries
+		if len(countries) == 0 {
+			countries = []string{provider.DefaultCountry}
+		}
+		for _, country := range countries {
+			country = provider.NormalizeCountry(country)
+			prices, err := cataloger.Prices(ctx, provider.Credentials{APIKey: serverInfo.APIKey, Token: serverInfo.Token}, country)
 			if err != nil {
-				fmt.Printf("Invalid price for server %d: %v\n", server.Server, err)
+				logs.Logger.Errorf("failed to fetch %s prices for server %d: %v", country, serverInfo.ServerNumber, err)
+				complete = false
 				continue
 			}
-			serverData[serviceIndex].Servers[serverIndex].Price = fmt.Sprintf("%.2f", priceFloat*exchangeMap[server.Server]+marginMap[server.Server])
+			synced[serverCountry{serverInfo.ServerNumber, country}] = true
+			rentPrices, rentSynced := rentPriceList(ctx, serverInfo, country)
+
+			for _, price := range prices {
+				key := serverCode{serverInfo.ServerNumber, price.Code, country}
+				name, ok := names[key]
+				if !ok {
+					name, ok = codeNames[price.Code]
+				}
+				if !ok {
+					continue
+				}
+				entry, ok := current[key]
+				if !ok {
+					entry = models.ServerData{Server: serverInfo.ServerNumber, Code: price.Code, Otp: "Single Otp"}
+				}
+				item := handlers.PriceItem{Server: serverInfo.ServerNumber, Service: name, Country: country}
+				if len(price.Operators) > 0 {
+					entry.Operators = operatorPrices(engine, item, price.Operators, exchange, margin)
+				}
+				stock := price.Stock
+				entry.Country = country
+				entry.Stock = &stock
+				entry.Cost = price.Cost
+				item.Stock = &stock
+				entry.Price = engine.SellPrice(item, price.Cost, exchange, margin)
+				if rentSynced {
+					entry.Rent, entry.RentCost = nil, nil
+					rentItem := handlers.PriceItem{Server: serverInfo.ServerNumber, Service: name, Country: country}
+					for duration, cost := range rentPrices[price.Code] {
+						if entry.Rent == nil {
+							entry.Rent = make(map[string]string)
+							entry.RentCost = make(map[string]float64)
+						}
+						entry.Rent[duration] = engine.SellPrice(rentItem, cost, exchange, margin)
+						entry.RentCost[duration] = cost
+					}
+				}
+				catalog[name] = append(catalog[name], entry)
+			}
 		}
 	}
 
-	serverListCollection := models.InitializeServerListCollection(db)
-	_, err = serverListCollection.DeleteMany(ctx, bson.M{})
-	if err != nil {
-		return fmt.Errorf("failed to clear server list collection: %w", err)
+	for key, entry := range current {
+		if !synced[serverCountry{key.server, key.country}] {
+			catalog[names[key]] = append(catalog[names[key]], entry)
+		}
+	}
+	if len(catalog) == 0 {
+		return fmt.Errorf("no prices fetched from any server")
 	}
 
-	var documents []interface{}
-	for _, data := range serverData {
-		data.CreatedAt = time.Now()
-		data.UpdatedAt = time.Now()
-		documents = append(documents, data)
+	now := time.Now()
+	var writes []mongo.WriteModel
+	for name, entries := range catalog {
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].Server != entries[j].Server {
+				return entries[i].Server < entries[j].Server
+			}
+			return provider.NormalizeCountry(entries[i].Country) < provider.NormalizeCountry(entries[j].Country)
+		})
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"name": name}).
+			SetUpdate(bson.M{
+				"$set": bson.M{
+					"service_code": serviceCodes[name],
+					"servers":      entries,
+					"updatedAt":    now,
+				},
+				"$setOnInsert": bson.M{"createdAt": now},
+			}).
+			SetUpsert(true))
+	}
+	if complete {
+		catalogNames := make([]string, 0, len(catalog))
+		for name := range catalog {
+			catalogNames = append(catalogNames, name)
+		}
+		writes = append(writes, mongo.NewDeleteManyModel().SetFilter(bson.M{"name": bson.M{"$nin": catalogNames}}))
 	}
-	_, err = serverListCollection.InsertMany(ctx, documents)
+
+	_, err = serverListCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
 	if err != nil {
-		return fmt.Errorf("failed to insert data in batch: %w", err)
+		return fmt.Errorf("failed to write service list: %w", err)
 	}
-	logs.Logger.Info("ServiceList Update Done")
+	logs.Logger.Infof("ServiceList Update Done: %d services from %d price lists", len(catalog), len(synced))
 	return nil
 }
 
+// rentPriceList returns the provider's rental cost of every service code by
+// rental period, and whether every period could be fetched. Entries of
+// servers that do not rent numbers, or whose rent prices failed, keep their
+// current rent prices.
+func rentPriceList(ctx context.Context, serverInfo models.Server, country string) (map[string]map[string]float64, bool) {
+	renter, err := provider.RenterFor(serverInfo)
+	if err != nil {
+		return nil, false
+	}
+	costs := make(map[string]map[string]float64)
+	for duration, hours := range provider.RentDurations {
+		prices, err := renter.RentPrices(ctx, provider.Credentials{APIKey: serverInfo.APIKey, Token: serverInfo.Token}, country, hours)
+		if err != nil {
+			logs.Logger.Errorf("failed to fetch %s %s rent prices for server %d: %v", country, duration, serverInfo.ServerNumber, err)
+			return nil, false
+		}
+		for _, price := range prices {
+			if price.Stock <= 0 {
+				continue
+			}
+			if costs[price.Code] == nil {
+				costs[price.Code] = make(map[string]float64)
+			}
+			costs[price.Code][duration] = price.Cost
+		}
+	}
+	return costs, true
+}
+
+// operatorPrices prices provider operators like entries, on the operator's
+// own stock. Entries of providers that do not price operators keep their
+// configured operators.
+func operatorPrices(engine *handlers.PricingEngine, item handlers.PriceItem, operators []provider.OperatorPrice, exchange, margin float64) []models.OperatorPrice {
+	prices := make([]models.OperatorPrice, 0, len(operators))
+	for _, operator := range operators {
+		stock := operator.Stock
+		item.Stock = &stock
+		prices = append(prices, models.OperatorPrice{
+			Name:  operator.Name,
+			Price: engine.SellPrice(item, operator.Cost, exchange, margin),
+			Stock: &stock,
+			Cost:  operator.Cost,
+		})
+	}
+	return prices
+}
+
+// StartUpdateServerDataTicker syncs the service list every
+// CATALOG_SYNC_INTERVAL (e.g. "30m", "6h"), or once a night at 00:10 IST
+// when it is not set.
 func StartUpdateServerDataTicker(db *mongo.Database) {
+	var interval time.Duration
+	if value := os.Getenv("CATALOG_SYNC_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Printf("Invalid CATALOG_SYNC_INTERVAL %q, syncing nightly: %v", value, err)
+		} else {
+			interval = parsed
+		}
+	}
 	istLocation, err := time.LoadLocation("Asia/Kolkata")
 	if err != nil {
 		log.Fatalf("Failed to load IST timezone: %v", err)
@@ -109,11 +279,13 @@ func StartUpdateServerDataTicker(db *mongo.Database) {
 
 	go func() {
 		for {
-			now := time.Now().In(istLocation)
-			nextMidnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 10, 0, 0, istLocation)
-			durationUntilMidnight := time.Until(nextMidnight)
-
-			time.Sleep(durationUntilMidnight)
+			if interval > 0 {
+				time.Sleep(interval)
+			} else {
+				now := time.Now().In(istLocation)
+				nextMidnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 10, 0, 0, istLocation)
+				time.Sleep(time.Until(nextMidnight))
+			}
 
 			if err := UpdateServerData(db, context.TODO()); err != nil {
 				log.Printf("Error in UpdateServerData: %v", err)
@@ -0,0 +1,39 @@
+package runner
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StartWebhookDispatcher retries the customer webhook deliveries that are
+// due every WEBHOOK_DISPATCH_INTERVAL (default 10s). First attempts are made
+// when an event happens; this only picks up the ones that failed.
+func StartWebhookDispatcher(db *mongo.Database) {
+	interval := 10 * time.Second
+	if value := os.Getenv("WEBHOOK_DISPATCH_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid WEBHOOK_DISPATCH_INTERVAL %q, using %s", value, interval)
+		} else {
+			interval = parsed
+		}
+	}
+	for {
+		time.Sleep(interval)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		attempted, err := handlers.DispatchWebhooks(ctx, db)
+		cancel()
+		if err != nil {
+			log.Printf("Error in DispatchWebhooks: %v", err)
+			continue
+		}
+		if attempted > 0 {
+			log.Printf("Retried %d webhook deliveries", attempted)
+		}
+	}
+}
@@ -1,13 +1,12 @@
 package serverscalc
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"strings"
 
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 )
 
@@ -23,15 +22,8 @@ type APIResponseServer11 struct {
 }
 
 // FetchNumber fetches the number and ID from the given API
-func ExtractNumberServer11(url string) (string, string, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		logs.Logger.Error(err)
-		return "", "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
+func ExtractNumberServer11(ctx context.Context, url string) (string, string, error) {
+	body, _, err := httpclient.GetOnce(ctx, url, nil)
 	if err != nil {
 		logs.Logger.Error(err)
 		return "", "", err
@@ -44,9 +36,8 @@ func ExtractNumberServer11(url string) (string, string, error) {
 		return "", "", err
 	}
 
-	phone := strings.TrimPrefix(apiResponse.Number, "91")
 	if apiResponse.RequestID != 0 && apiResponse.Number != "" {
-		return phone, fmt.Sprintf("%d", apiResponse.RequestID), nil
+		return apiResponse.Number, fmt.Sprintf("%d", apiResponse.RequestID), nil
 	}
 	return "", "", errors.New(apiResponse.ErrorCode)
 }
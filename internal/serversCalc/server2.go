@@ -1,13 +1,14 @@
 package serverscalc
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strings"
 
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 )
 
@@ -20,30 +21,16 @@ type Response struct {
 	CreatedAt string `json:"created_at"`
 }
 
-func ExtractNumberServer2(url string, headers map[string]string) (string, string, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", "", err
-	}
-
-	// Add headers
-	for key, value := range headers {
-		req.Header.Add(key, value)
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
+func ExtractNumberServer2(ctx context.Context, url string, headers map[string]string) (string, string, error) {
+	body, status, err := httpclient.GetOnce(ctx, url, headers)
 	if err != nil {
 		return "", "", err
 	}
 	logs.Logger.Debug(string(body))
 
+	if status == http.StatusUnauthorized {
+		return "", "", errors.New("BAD_KEY")
+	}
 	if strings.Contains(string(body), "no free phones") {
 		return "", "", errors.New("no number available: no free phones")
 	}
@@ -56,8 +43,6 @@ func ExtractNumberServer2(url string, headers map[string]string) (string, string
 		logs.Logger.Error(err)
 		return "", "", err
 	}
-	phone := strings.TrimPrefix(response.Phone, "+91")
-
 	// Return the ID and Phone
-	return fmt.Sprintf("%s", phone), fmt.Sprintf("%d", response.ID), nil
+	return response.Phone, fmt.Sprintf("%d", response.ID), nil
 }
@@ -1,13 +1,12 @@
 package serverscalc
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"strings"
 
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 )
 
@@ -37,27 +36,11 @@ type NumberResponse struct {
 	} `json:"data"`
 }
 
-func ExtractNumberServer9(fullURL string, headers map[string]string) (string, string, error) {
-	req, err := http.NewRequest("GET", fullURL, nil)
-	if err != nil {
-		return "", "", fmt.Errorf("error creating request: %w", err)
-	}
-
-	for key, value := range headers {
-		req.Header.Add(key, value)
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func ExtractNumberServer9(ctx context.Context, fullURL string, headers map[string]string) (string, string, error) {
+	body, _, err := httpclient.GetOnce(ctx, fullURL, headers)
 	if err != nil {
 		return "", "", fmt.Errorf("error fetching number: %w", err)
 	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", "", fmt.Errorf("error reading number response: %w", err)
-	}
 	logs.Logger.Debug(string(body))
 
 	var numberResponse NumberResponse
@@ -66,7 +49,10 @@ func ExtractNumberServer9(fullURL string, headers map[string]string) (string, st
 	}
 
 	if numberResponse.Code == "221" {
-		return "", "", errors.New(numberResponse.Message)
+		return "", "", errors.New("NO_NUMBERS")
+	}
+	if numberResponse.Code == "210" {
+		return "", "", errors.New("BAD_KEY")
 	}
 	if numberResponse.Code != "200" {
 		return "", "", errors.New(numberResponse.Message)
@@ -76,6 +62,5 @@ func ExtractNumberServer9(fullURL string, headers map[string]string) (string, st
 		return "", "", errors.New("no phone number found in response")
 	}
 	phoneData := numberResponse.Data.PhoneNumber[0]
-	phone := strings.TrimPrefix(phoneData.Number, "+91")
-	return phone, phoneData.SerialNumber, nil
+	return phoneData.Number, phoneData.SerialNumber, nil
 }
@@ -1,33 +1,17 @@
 package serverscalc
 
 import (
+	"context"
 	"errors"
-	"io/ioutil"
-	"net/http"
 	"strings"
 
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
+
 	"github.com/ranjankuldeep/fakeNumber/logs"
 )
 
-func ExtractNumberServerFromAccess(url string, headers map[string]string) (string, string, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", "", err
-	}
-
-	for key, value := range headers {
-		req.Header.Add(key, value)
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", "", err
-	}
-	defer resp.Body.Close()
-
-	// Read the response body
-	body, err := ioutil.ReadAll(resp.Body)
+func ExtractNumberServerFromAccess(ctx context.Context, url string, headers map[string]string) (string, string, error) {
+	body, _, err := httpclient.GetOnce(ctx, url, headers)
 	if err != nil {
 		return "", "", err
 	}
@@ -42,11 +26,14 @@ func ExtractNumberServerFromAccess(url string, headers map[string]string) (strin
 		return "", "", errors.New("BAD_KEY_FROM_SERVER")
 	}
 
+	if !strings.HasPrefix(responseData, "ACCESS_NUMBER") {
+		return "", "", errors.New(strings.TrimSpace(responseData))
+	}
 	responseParts := strings.Split(responseData, ":")
 	if len(responseParts) < 3 {
 		return "", "", errors.New("INVALID_RESPONSE_FORMAT")
 	}
 	id := responseParts[1]
-	number := responseParts[2][2:] // Remove the first 2 characters
+	number := responseParts[2]
 	return id, number, nil
 }
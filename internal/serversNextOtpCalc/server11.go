@@ -1,12 +1,12 @@
 package serversnextotpcalc
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 )
 
@@ -15,29 +15,12 @@ type Response struct {
 	Success   bool `json:"success"`
 }
 
-func CallNextOTPServerUnMarshalling(otpURL string, headers map[string]string) error {
-	req, err := http.NewRequest("GET", otpURL, nil)
-	if err != nil {
-		fmt.Printf("Error creating the HTTP request: %v\n", err)
-		return err
-	}
-
-	for key, value := range headers {
-		req.Header.Set(key, value)
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func CallNextOTPServerUnMarshalling(ctx context.Context, otpURL string, headers map[string]string) error {
+	body, _, err := httpclient.GetOnce(ctx, otpURL, headers)
 	if err != nil {
 		fmt.Printf("Error making the API call: %v\n", err)
 		return err
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("Error reading response body: %v\n", err)
-		return err
-	}
 	logs.Logger.Info(string(body))
 	var apiResponse Response
 	err = json.Unmarshal(body, &apiResponse)
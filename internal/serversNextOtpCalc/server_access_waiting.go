@@ -1,37 +1,20 @@
 package serversnextotpcalc
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"strings"
-)
-
-func CallNextOTPServerWaiting(otpURL string, headers map[string]string) error {
-	req, err := http.NewRequest("GET", otpURL, nil)
-	if err != nil {
-		fmt.Printf("Error creating the HTTP request: %v\n", err)
-		return err
-	}
 
-	for key, value := range headers {
-		req.Header.Set(key, value)
-	}
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
+)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func CallNextOTPServerWaiting(ctx context.Context, otpURL string, headers map[string]string) error {
+	body, _, err := httpclient.GetOnce(ctx, otpURL, headers)
 	if err != nil {
 		fmt.Printf("Error making the API call: %v\n", err)
 		return err
 	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("Error reading response body: %v\n", err)
-		return err
-	}
 	responseString := string(body)
 	fmt.Printf("Response: %s\n", responseString)
 	if strings.Contains(responseString, "ACCESS_WAITING") {
@@ -1,37 +1,22 @@
 package serversotpcalc
 
 import (
+	"context"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"strings"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
 )
 
 // GetOTPServer1 fetches the OTP status from the given URL
-func GetOTPServer1(otpUrl string, headers map[string]string, id string) ([]string, error) {
-	req, err := http.NewRequest("GET", otpUrl, nil)
-	if err != nil {
-		return []string{}, fmt.Errorf("failed to create request: %w", err)
-	}
-	if len(headers) > 0 {
-		for key, value := range headers {
-			req.Header.Add(key, value)
-		}
-	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func GetOTPServer1(ctx context.Context, otpUrl string, headers map[string]string, id string) ([]string, error) {
+	body, status, err := httpclient.Get(ctx, otpUrl, headers)
 	if err != nil {
 		return []string{}, fmt.Errorf("failed to send request: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return []string{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return []string{}, fmt.Errorf("failed to read response body: %w", err)
+	if status != http.StatusOK {
+		return []string{}, fmt.Errorf("unexpected status code: %d", status)
 	}
 
 	responseText := string(body)
@@ -1,12 +1,14 @@
 package serversotpcalc
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
+
 	"github.com/ranjankuldeep/fakeNumber/logs"
 )
 
@@ -30,22 +32,15 @@ type OTPServer11ResponseInt struct {
 	SMSCode       string `json:"sms_code,omitempty"`   // For OTP case
 }
 
-func GetOTPServer11(otpURL string, requestID string) ([]string, error) {
-	logs.Logger.Info(otpURL)
+func GetOTPServer11(ctx context.Context, otpURL string, requestID string) ([]string, error) {
+	logs.Logger.Info(httpclient.Redact(otpURL))
 
-	resp, err := http.Get(otpURL)
+	body, status, err := httpclient.Get(ctx, otpURL, nil)
 	if err != nil {
 		return []string{}, fmt.Errorf("failed to fetch OTP: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return []string{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return []string{}, fmt.Errorf("failed to read response body: %w", err)
+	if status != http.StatusOK {
+		return []string{}, fmt.Errorf("unexpected status code: %d", status)
 	}
 
 	logs.Logger.Infof("Response Body: %s", string(body))
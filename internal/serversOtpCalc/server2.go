@@ -1,10 +1,12 @@
 package serversotpcalc
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
 )
 
 // OTPResponse represents the structure of the response from the API
@@ -27,32 +29,13 @@ type OTPResponse struct {
 	Country   string `json:"country"`
 }
 
-func GetSMSTextsServer2(otpURL string, id string, headers map[string]string) ([]string, error) {
-	req, err := http.NewRequest("GET", otpURL, nil)
-	if err != nil {
-		return []string{}, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	if len(headers) > 0 {
-		for key, value := range headers {
-			req.Header.Add(key, value)
-		}
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func GetSMSTextsServer2(ctx context.Context, otpURL string, id string, headers map[string]string) ([]string, error) {
+	body, status, err := httpclient.Get(ctx, otpURL, headers)
 	if err != nil {
 		return []string{}, fmt.Errorf("failed to send request: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return []string{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return []string{}, fmt.Errorf("failed to read response body: %w", err)
+	if status != http.StatusOK {
+		return []string{}, fmt.Errorf("unexpected status code: %d", status)
 	}
 	var otpResponse OTPResponse
 	err = json.Unmarshal(body, &otpResponse)
@@ -1,12 +1,14 @@
 package serversotpcalc
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
+
 	"github.com/ranjankuldeep/fakeNumber/logs"
 )
 
@@ -33,32 +35,14 @@ type OTPServer9Response struct {
 }
 
 // FetchTokenAndOTP fetches the token and then fetches the OTP using the token
-func FetchTokenAndOTP(otpURL, serialNumber string, headers map[string]string) ([]string, error) {
-	logs.Logger.Info(otpURL)
-	req, err := http.NewRequest("GET", otpURL, nil)
-	if err != nil {
-		return []string{}, fmt.Errorf("failed to create OTP request: %w", err)
-	}
-
-	if len(headers) > 0 {
-		for key, value := range headers {
-			req.Header.Add(key, value)
-		}
-	}
-
-	otpResp, err := http.DefaultClient.Do(req)
+func FetchTokenAndOTP(ctx context.Context, otpURL, serialNumber string, headers map[string]string) ([]string, error) {
+	logs.Logger.Info(httpclient.Redact(otpURL))
+	otpBody, status, err := httpclient.Get(ctx, otpURL, headers)
 	if err != nil {
 		return []string{}, fmt.Errorf("failed to fetch OTP: %w", err)
 	}
-	defer otpResp.Body.Close()
-
-	if otpResp.StatusCode != http.StatusOK {
-		return []string{}, fmt.Errorf("unexpected status code while fetching OTP: %d", otpResp.StatusCode)
-	}
-
-	otpBody, err := ioutil.ReadAll(otpResp.Body)
-	if err != nil {
-		return []string{}, fmt.Errorf("failed to read OTP response: %w", err)
+	if status != http.StatusOK {
+		return []string{}, fmt.Errorf("unexpected status code while fetching OTP: %d", status)
 	}
 
 	var otpResponse OTPServer9Response
@@ -69,7 +53,7 @@ func FetchTokenAndOTP(otpURL, serialNumber string, headers map[string]string) ([
 	logs.Logger.Infof("OTP response code  %+v", otpResponse.Code)
 
 	if otpResponse.Code == "210" {
-		return []string{}, errors.New(otpResponse.Message)
+		return []string{}, errors.New("BAD_KEY")
 	} else if otpResponse.Code == "245" {
 		return []string{}, fmt.Errorf("ACCESS_CANCEL")
 	} else if otpResponse.Code != "200" {
@@ -1,11 +1,14 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
 )
 
 type BlockUserDetails struct {
@@ -45,17 +48,16 @@ func sendBlockMessage(message string) error {
 		"https://api.telegram.org/bot6868379504:AAEyCD-0YPsJBtNRhxWk1uSDBCh71H1c5Lg/sendMessage?chat_id=6769991787&text=%s",
 		encodedMessage,
 	)
-	resp, err := http.Get(apiURL)
+	body, status, err := httpclient.GetOnce(context.Background(), apiURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to send message: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP error! status: %d in sending message through TeleBot", resp.StatusCode)
+	if status != http.StatusOK {
+		return fmt.Errorf("HTTP error! status: %d in sending message through TeleBot", status)
 	}
 	var response numberResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	if err := json.Unmarshal(body, &response); err != nil {
 		return fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 	if response.Ok == false {
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -142,17 +143,16 @@ func sendRCMessage(message string) error {
 		"https://api.telegram.org/bot6740130325:AAEp1cTpT2o6qgIR4Mb3T2j4s6VDjSVV5Jo/sendMessage?chat_id=6769991787&text=%s",
 		encodedMessage,
 	)
-	resp, err := http.Get(apiURL)
+	body, status, err := httpclient.GetOnce(context.Background(), apiURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to send message: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP error! status: %d in sending message through TeleBot", resp.StatusCode)
+	if status != http.StatusOK {
+		return fmt.Errorf("HTTP error! status: %d in sending message through TeleBot", status)
 	}
 	var response numberResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	if err := json.Unmarshal(body, &response); err != nil {
 		return fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 	if response.Ok == false {
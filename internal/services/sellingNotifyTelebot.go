@@ -1,12 +1,15 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
 	"sort"
 	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
 )
 
 // Struct for selling update details
@@ -16,6 +19,7 @@ type SellingUpdateDetails struct {
 	TotalPending    int
 	ServerUpdates   map[int]int
 	RechargeDetails RechargeDetailsSelling
+	ProfitDetails   ProfitDetailsSelling
 	ServersBalance  map[string]string
 	WebsiteBalance  float64
 	TotalUserCount  int
@@ -29,6 +33,13 @@ type RechargeDetailsSelling struct {
 	AdminAdded float64
 }
 
+// Struct for the revenue, provider cost and gross profit of the numbers sold
+type ProfitDetailsSelling struct {
+	Revenue float64
+	Cost    float64
+	Profit  float64
+}
+
 func SellingTeleBot(details SellingUpdateDetails) error {
 	result := fmt.Sprintf("Date => %s\n\n", time.Now().Format("02-01-2006 03:04:05pm"))
 
@@ -61,6 +72,12 @@ func SellingTeleBot(details SellingUpdateDetails) error {
 	result += fmt.Sprintf("Upi   => %.2f\n", details.RechargeDetails.Upi)
 	result += fmt.Sprintf("Admin Added => %.2f\n\n", details.RechargeDetails.AdminAdded)
 
+	// Profit Update
+	result += "Profit Update\n"
+	result += fmt.Sprintf("Revenue => %.2f\n", details.ProfitDetails.Revenue)
+	result += fmt.Sprintf("Cost    => %.2f\n", details.ProfitDetails.Cost)
+	result += fmt.Sprintf("Profit  => %.2f\n\n", details.ProfitDetails.Profit)
+
 	// Servers Balance
 	result += "Servers Balance\n"
 	serverOrder := []string{
@@ -94,17 +111,16 @@ func sendSellingMessage(message string) error {
 		"https://api.telegram.org/bot7311200292:AAF7NYfNP-DUcCRFevOKU4TYg4i-z2X8jtw/sendMessage?chat_id=6769991787&text=%s",
 		encodedMessage,
 	)
-	resp, err := http.Get(apiURL)
+	body, status, err := httpclient.GetOnce(context.Background(), apiURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to send message: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP error! status: %d in sending message through TeleBot", resp.StatusCode)
+	if status != http.StatusOK {
+		return fmt.Errorf("HTTP error! status: %d in sending message through TeleBot", status)
 	}
 	var response numberResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	if err := json.Unmarshal(body, &response); err != nil {
 		return fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 	if response.Ok == false {
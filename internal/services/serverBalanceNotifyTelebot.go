@@ -0,0 +1,41 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+type ServerBalanceDetails struct {
+	Server      int
+	Balance     float64
+	Symbol      string
+	Threshold   float64
+	Recovered   bool
+	Maintenance bool
+}
+
+// ServerBalanceTeleBot alerts admins when a server's provider balance drops
+// below its threshold or is topped up again.
+func ServerBalanceTeleBot(details ServerBalanceDetails) error {
+	return sendSellingMessage(ServerBalanceMessage(details))
+}
+
+// ServerBalanceMessage is the alert text, shared with the email alert.
+func ServerBalanceMessage(details ServerBalanceDetails) string {
+	result := "Server Balance Low\n\n"
+	if details.Recovered {
+		result = "Server Balance Restored\n\n"
+	}
+	result += fmt.Sprintf("Date => %s\n\n", time.Now().Format("02-01-2006 03:04:05PM"))
+	result += fmt.Sprintf("Server => %d\n\n", details.Server)
+	result += fmt.Sprintf("Balance => %.2f%s\n\n", details.Balance, details.Symbol)
+	result += fmt.Sprintf("Threshold => %.2f%s\n\n", details.Threshold, details.Symbol)
+	if details.Maintenance {
+		if details.Recovered {
+			result += "Maintenance => lifted\n\n"
+		} else {
+			result += "Maintenance => on\n\n"
+		}
+	}
+	return result
+}
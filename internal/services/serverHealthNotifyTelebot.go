@@ -0,0 +1,34 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+type ServerHealthDetails struct {
+	Server              int
+	State               string
+	ErrorRate           float64
+	LatencyMs           float64
+	ConsecutiveFailures int
+	LastError           string
+}
+
+// ServerHealthTeleBot alerts admins when a server's circuit breaker trips or
+// recovers.
+func ServerHealthTeleBot(details ServerHealthDetails) error {
+	result := "Server Degraded\n\n"
+	if details.State == "closed" {
+		result = "Server Recovered\n\n"
+	}
+	result += fmt.Sprintf("Date => %s\n\n", time.Now().Format("02-01-2006 03:04:05PM"))
+	result += fmt.Sprintf("Server => %d\n\n", details.Server)
+	result += fmt.Sprintf("Breaker => %s\n\n", details.State)
+	result += fmt.Sprintf("Error Rate => %.0f%%\n\n", details.ErrorRate*100)
+	result += fmt.Sprintf("Latency => %.0fms\n\n", details.LatencyMs)
+	result += fmt.Sprintf("Consecutive Failures => %d\n\n", details.ConsecutiveFailures)
+	if details.LastError != "" {
+		result += fmt.Sprintf("Last Error => %s\n\n", details.LastError)
+	}
+	return sendSellingMessage(result)
+}
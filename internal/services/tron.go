@@ -1,11 +1,12 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 )
 
@@ -17,19 +18,13 @@ type TronAddressResponse struct {
 
 func GenerateTronAddress() (string, string, error) {
 	apiURL := "https://php.paidsms.in/tron/?type=address"
-	resp, err := http.Get(apiURL)
+	body, status, err := httpclient.GetOnce(context.Background(), apiURL, nil)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to fetch Tron address: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to read response body: %w", err)
+	if status != http.StatusOK {
+		return "", "", fmt.Errorf("unexpected status code: %d", status)
 	}
 
 	// Parse the JSON response
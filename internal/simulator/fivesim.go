@@ -0,0 +1,125 @@
+package simulator
+
+import (
+	"net/http"
+	"time"
+)
+
+type fiveSimSMS struct {
+	CreatedAt string `json:"created_at"`
+	Date      string `json:"date"`
+	Sender    string `json:"sender"`
+	Text      string `json:"text"`
+	Code      string `json:"code"`
+}
+
+type fiveSimOrder struct {
+	ID        int          `json:"id"`
+	Phone     string       `json:"phone"`
+	Product   string       `json:"product"`
+	Status    string       `json:"status"`
+	Country   string       `json:"country"`
+	CreatedAt string       `json:"created_at"`
+	SMS       []fiveSimSMS `json:"sms"`
+}
+
+// fiveSimAuthorized rejects requests the way 5sim does for a bad bearer token.
+func (s *Server) fiveSimAuthorized(w http.ResponseWriter, r *http.Request, service string) bool {
+	if s.scenarioFor(service).BadKey || r.Header.Get("Authorization") == "" {
+		writeText(w, http.StatusUnauthorized, "Unauthorized")
+		return false
+	}
+	return true
+}
+
+func (s *Server) fiveSimOrder(a *activation) fiveSimOrder {
+	order := fiveSimOrder{
+		ID:        a.id,
+		Phone:     "+" + a.number,
+		Product:   a.service,
+		Status:    "PENDING",
+		Country:   "india",
+		CreatedAt: a.createdAt.Format(time.RFC3339),
+		SMS:       []fiveSimSMS{},
+	}
+	for _, text := range s.received(a) {
+		order.SMS = append(order.SMS, fiveSimSMS{
+			CreatedAt: time.Now().Format(time.RFC3339),
+			Date:      time.Now().Format(time.RFC3339),
+			Sender:    a.service,
+			Text:      text,
+		})
+	}
+	if len(order.SMS) > 0 {
+		order.Status = "RECEIVED"
+	}
+	if s.isCancelled(a) {
+		order.Status = "CANCELED"
+	}
+	return order
+}
+
+// fiveSimBuy serves /v1/user/buy/activation/{country}/{operator}/{product}.
+func (s *Server) fiveSimBuy(w http.ResponseWriter, r *http.Request) {
+	service := lastSegment(r.URL.Path)
+	if !s.fiveSimAuthorized(w, r, service) {
+		return
+	}
+	if s.scenarioFor(service).NoStock {
+		writeText(w, http.StatusBadRequest, "no free phones")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.fiveSimOrder(s.buy(service)))
+}
+
+func (s *Server) fiveSimCheck(w http.ResponseWriter, r *http.Request) {
+	if !s.fiveSimAuthorized(w, r, "") {
+		return
+	}
+	a := s.find(lastSegment(r.URL.Path))
+	if a == nil {
+		writeText(w, http.StatusNotFound, "order not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.fiveSimOrder(a))
+}
+
+func (s *Server) fiveSimCancel(w http.ResponseWriter, r *http.Request) {
+	if !s.fiveSimAuthorized(w, r, "") {
+		return
+	}
+	a := s.find(lastSegment(r.URL.Path))
+	if a == nil {
+		writeText(w, http.StatusNotFound, "order not found")
+		return
+	}
+	if !s.cancel(a) && len(s.received(a)) > 0 {
+		writeText(w, http.StatusBadRequest, "order has sms")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.fiveSimOrder(a))
+}
+
+// fiveSimOrders serves /v1/user/orders, every order newest first.
+func (s *Server) fiveSimOrders(w http.ResponseWriter, r *http.Request) {
+	if !s.fiveSimAuthorized(w, r, "") {
+		return
+	}
+	orders := []fiveSimOrder{}
+	for _, a := range s.list() {
+		orders = append(orders, s.fiveSimOrder(a))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"Data": orders, "Total": len(orders)})
+}
+
+func (s *Server) fiveSimProfile(w http.ResponseWriter, r *http.Request) {
+	if !s.fiveSimAuthorized(w, r, "") {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":      1,
+		"email":   "simulator@example.com",
+		"balance": s.scenarioFor("").Balance,
+		"rating":  96,
+	})
+}
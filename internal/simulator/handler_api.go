@@ -0,0 +1,97 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+func (s *Server) handlerAPI(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	action := query.Get("action")
+	service := query.Get("service")
+	if s.scenarioFor(service).BadKey {
+		writeText(w, http.StatusOK, "BAD_KEY")
+		return
+	}
+
+	switch action {
+	case "getNumber":
+		if s.scenarioFor(service).NoStock {
+			writeText(w, http.StatusOK, "NO_NUMBERS")
+			return
+		}
+		a := s.buy(service)
+		writeText(w, http.StatusOK, fmt.Sprintf("ACCESS_NUMBER:%d:%s", a.id, a.number))
+	case "getStatus":
+		a := s.find(query.Get("id"))
+		if a == nil {
+			writeText(w, http.StatusOK, "NO_ACTIVATION")
+			return
+		}
+		if s.isCancelled(a) {
+			writeText(w, http.StatusOK, "STATUS_CANCEL")
+			return
+		}
+		sms := s.received(a)
+		if len(sms) == 0 {
+			writeText(w, http.StatusOK, "STATUS_WAIT_CODE")
+			return
+		}
+		writeText(w, http.StatusOK, "STATUS_OK:"+sms[len(sms)-1])
+	case "setStatus":
+		a := s.find(query.Get("id"))
+		if a == nil {
+			writeText(w, http.StatusOK, "NO_ACTIVATION")
+			return
+		}
+		switch query.Get("status") {
+		case "3":
+			s.next(a)
+			writeText(w, http.StatusOK, a.scenario.NextSMSAck)
+		case "8":
+			if !s.cancel(a) {
+				if a.scenario.EarlyCancelDenied && len(s.received(a)) == 0 {
+					writeText(w, http.StatusOK, "EARLY_CANCEL_DENIED")
+					return
+				}
+				writeText(w, http.StatusOK, "BAD_STATUS")
+				return
+			}
+			writeText(w, http.StatusOK, "ACCESS_CANCEL")
+		default:
+			writeText(w, http.StatusOK, "BAD_STATUS")
+		}
+	case "getPrices":
+		s.handlerAPIPrices(w, query.Get("country"))
+	case "getRentNumber", "getRentStatus", "continueRentNumber", "setRentStatus", "getRentServicesAndCountries":
+		s.handlerAPIRent(w, action, query)
+	case "getActiveActivations":
+		active := []map[string]string{}
+		for _, a := range s.list() {
+			if s.isCancelled(a) {
+				continue
+			}
+			active = append(active, map[string]string{
+				"activationId":   fmt.Sprintf("%d", a.id),
+				"serviceCode":    a.service,
+				"phoneNumber":    a.number,
+				"activationTime": a.createdAt.Format("2006-01-02 15:04:05"),
+			})
+		}
+		if len(active) == 0 {
+			writeJSON(w, http.StatusOK, map[string]string{"status": "error", "error": "NO_ACTIVATIONS"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "success", "activeActivations": active})
+	case "getBalance":
+		writeText(w, http.StatusOK, fmt.Sprintf("ACCESS_BALANCE:%.2f", s.scenarioFor("").Balance))
+	default:
+		writeText(w, http.StatusOK, "BAD_ACTION")
+	}
+}
+
+// lastSegment returns the final path element, e.g. the id in /v1/user/check/{id}.
+func lastSegment(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
@@ -0,0 +1,99 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type phantomResponse struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+func (s *Server) phantomBuy(w http.ResponseWriter, r *http.Request) {
+	service := r.URL.Query().Get("businessCode")
+	scenario := s.scenarioFor(service)
+	if scenario.BadKey {
+		writeJSON(w, http.StatusOK, phantomResponse{Code: "210", Message: "token invalid"})
+		return
+	}
+	if scenario.NoStock {
+		writeJSON(w, http.StatusOK, phantomResponse{Code: "221", Message: "no numbers available"})
+		return
+	}
+	a := s.buy(service)
+	writeJSON(w, http.StatusOK, phantomResponse{
+		Code:    "200",
+		Message: "success",
+		Data: map[string]interface{}{
+			"phoneNumber": []map[string]string{{
+				"number":       "+" + a.number,
+				"businessCode": service,
+				"serialNumber": strconv.Itoa(a.id),
+				"country":      r.URL.Query().Get("country"),
+			}},
+			"balance": fmt.Sprintf("%.2f", scenario.Balance),
+		},
+	})
+}
+
+func (s *Server) phantomOTP(w http.ResponseWriter, r *http.Request) {
+	if s.scenarioFor("").BadKey {
+		writeJSON(w, http.StatusOK, phantomResponse{Code: "210", Message: "token invalid"})
+		return
+	}
+	serial := r.URL.Query().Get("serialNumber")
+	a := s.find(serial)
+	if a == nil || s.isCancelled(a) {
+		writeJSON(w, http.StatusOK, phantomResponse{Code: "245", Message: "number released"})
+		return
+	}
+	vc := ""
+	if sms := s.received(a); len(sms) > 0 {
+		vc = sms[len(sms)-1]
+	}
+	writeJSON(w, http.StatusOK, phantomResponse{
+		Code:    "200",
+		Message: "success",
+		Data: map[string]interface{}{
+			"verificationCode": []map[string]string{{
+				"serialNumber": serial,
+				"vc":           vc,
+				"businessCode": a.service,
+			}},
+		},
+	})
+}
+
+// phantomTicket hands out a new token for the API key.
+func (s *Server) phantomTicket(w http.ResponseWriter, r *http.Request) {
+	if s.scenarioFor("").BadKey || r.URL.Query().Get("key") == "" {
+		writeJSON(w, http.StatusOK, phantomResponse{Code: "210", Message: "key invalid"})
+		return
+	}
+	writeJSON(w, http.StatusOK, phantomResponse{
+		Code:    "200",
+		Message: "success",
+		Data:    map[string]string{"token": fmt.Sprintf("sim-%d", time.Now().UnixNano())},
+	})
+}
+
+// phantomBridge stands in for the ccpay bridge, which cancels by number.
+func (s *Server) phantomBridge(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Query().Get("type") {
+	case "cancel":
+		a := s.findNumber(r.URL.Query().Get("number"))
+		if a == nil || !s.cancel(a) {
+			writeText(w, http.StatusOK, "failed")
+			return
+		}
+		writeText(w, http.StatusOK, "success")
+	case "balance":
+		writeText(w, http.StatusOK, fmt.Sprintf("%.2f", s.scenarioFor("").Balance))
+	default:
+		writeText(w, http.StatusBadRequest, "invalid type")
+	}
+}
@@ -0,0 +1,53 @@
+package simulator
+
+import (
+	"net/http"
+)
+
+type priceEntry struct {
+	Cost  float64 `json:"cost"`
+	Count int     `json:"count"`
+}
+
+// prices lists every catalogued service code. Services scripted with NoStock
+// are listed with a count of zero.
+func (s *Server) prices() map[string]priceEntry {
+	s.mu.Lock()
+	codes := append([]string{}, s.scenario.Catalog...)
+	for code := range s.services {
+		codes = append(codes, code)
+	}
+	s.mu.Unlock()
+
+	prices := make(map[string]priceEntry)
+	for _, code := range codes {
+		scenario := s.scenarioFor(code)
+		entry := priceEntry{Cost: scenario.Price, Count: 100}
+		if scenario.NoStock {
+			entry.Count = 0
+		}
+		prices[code] = entry
+	}
+	return prices
+}
+
+func (s *Server) handlerAPIPrices(w http.ResponseWriter, country string) {
+	writeJSON(w, http.StatusOK, map[string]map[string]priceEntry{country: s.prices()})
+}
+
+func (s *Server) fiveSimPrices(w http.ResponseWriter, r *http.Request) {
+	country := r.URL.Query().Get("country")
+	products := make(map[string]map[string]priceEntry)
+	for code, entry := range s.prices() {
+		products[code] = map[string]priceEntry{"virtual21": entry}
+	}
+	writeJSON(w, http.StatusOK, map[string]map[string]map[string]priceEntry{country: products})
+}
+
+func (s *Server) smsManPrices(w http.ResponseWriter, r *http.Request) {
+	if s.scenarioFor("").BadKey {
+		smsManError(w, "wrong_token", "Wrong token!")
+		return
+	}
+	s.handlerAPIPrices(w, r.URL.Query().Get("country_id"))
+}
@@ -0,0 +1,99 @@
+package simulator
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// handlerAPIRent answers the handler_api rent actions. A rental is an
+// activation that receives every scripted SMS without being asked for the
+// next one.
+func (s *Server) handlerAPIRent(w http.ResponseWriter, action string, query url.Values) {
+	fail := func(message string) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "error", "message": message})
+	}
+	switch action {
+	case "getRentNumber":
+		service := query.Get("service")
+		if s.scenarioFor(service).NoStock {
+			fail("NO_NUMBERS")
+			return
+		}
+		a := s.buy(service)
+		s.mu.Lock()
+		a.released = len(a.scenario.SMS)
+		s.mu.Unlock()
+		hours, _ := strconv.Atoi(query.Get("rent_time"))
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status": "success",
+			"phone": map[string]interface{}{
+				"id":      a.id,
+				"number":  a.number,
+				"endDate": time.Now().Add(time.Duration(hours) * time.Hour).Format("2006-01-02T15:04:05"),
+			},
+		})
+	case "getRentStatus":
+		a := s.find(query.Get("id"))
+		if a == nil {
+			fail("NO_ID_RENT")
+			return
+		}
+		if s.isCancelled(a) {
+			fail("STATUS_CANCEL")
+			return
+		}
+		sms := s.received(a)
+		if len(sms) == 0 {
+			fail("STATUS_WAIT_CODE")
+			return
+		}
+		// Values are numbered newest first.
+		values := make(map[string]map[string]string)
+		for i, text := range sms {
+			values[strconv.Itoa(len(sms)-1-i)] = map[string]string{
+				"phoneFrom": a.service,
+				"text":      text,
+				"date":      a.createdAt.Add(a.scenario.SMSDelay * time.Duration(i+1)).Format("2006-01-02 15:04:05"),
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status":   "success",
+			"quantity": strconv.Itoa(len(sms)),
+			"values":   values,
+		})
+	case "continueRentNumber":
+		a := s.find(query.Get("id"))
+		if a == nil || s.isCancelled(a) {
+			fail("NO_ID_RENT")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"status": "success",
+			"phone":  map[string]interface{}{"id": a.id, "number": a.number},
+		})
+	case "setRentStatus":
+		a := s.find(query.Get("id"))
+		if a == nil {
+			fail("NO_ID_RENT")
+			return
+		}
+		if query.Get("status") == "2" && !s.cancel(a) {
+			fail("CANT_CANCEL")
+			return
+		}
+		s.mu.Lock()
+		a.cancelled = true
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+	case "getRentServicesAndCountries":
+		hours, _ := strconv.Atoi(query.Get("rent_time"))
+		services := make(map[string]map[string]float64)
+		for code, entry := range s.prices() {
+			// Rentals cost a tenth of an activation per hour.
+			services[code] = map[string]float64{"cost": entry.Cost * float64(hours) / 10, "quant": float64(entry.Count)}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"services": services})
+	}
+}
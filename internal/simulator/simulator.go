@@ -0,0 +1,270 @@
+// Package simulator is a fake upstream SMS provider. It speaks every protocol
+// the provider package does (handler_api, 5sim v1, phantomunion and sms-man)
+// from a single host, so the get-number, get-otp and cancel flow can run
+// without touching a live third party.
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/logs"
+)
+
+// Scenario scripts how the simulator answers.
+type Scenario struct {
+	// NoStock answers every purchase with the protocol's no numbers response.
+	NoStock bool `json:"noStock"`
+	// BadKey rejects every request as unauthorised.
+	BadKey bool `json:"badKey"`
+	// EarlyCancelDenied refuses to cancel activations that have no SMS yet.
+	EarlyCancelDenied bool `json:"earlyCancelDenied"`
+	// SMS are delivered in order, one every SMSDelay. Only the first one is
+	// released until the next SMS is requested. SMSDelay is nanoseconds in JSON.
+	SMS      []string      `json:"sms"`
+	SMSDelay time.Duration `json:"smsDelay"`
+	// NextSMSAck is the handler_api answer to a next SMS request.
+	NextSMSAck string  `json:"nextSmsAck"`
+	Balance    float64 `json:"balance"`
+	// Price is the cost of one number in the price lists. Catalog names the
+	// service codes listed besides those scripted with SetServiceScenario.
+	Price   float64  `json:"price"`
+	Catalog []string `json:"catalog"`
+}
+
+// DefaultScenario delivers a single SMS right away.
+func DefaultScenario() Scenario {
+	return Scenario{
+		SMS:        []string{"Your verification code is 123456"},
+		NextSMSAck: "ACCESS_RETRY_GET",
+		Balance:    1000,
+		Price:      10,
+		Catalog:    []string{"tg", "wa", "go"},
+	}
+}
+
+type activation struct {
+	id        int
+	number    string
+	service   string
+	scenario  Scenario
+	createdAt time.Time
+	released  int
+	cancelled bool
+}
+
+// received returns the SMS delivered so far.
+func (a *activation) received(now time.Time) []string {
+	sms := []string{}
+	for i, text := range a.scenario.SMS {
+		if i >= a.released {
+			break
+		}
+		if now.Before(a.createdAt.Add(a.scenario.SMSDelay * time.Duration(i+1))) {
+			break
+		}
+		sms = append(sms, text)
+	}
+	return sms
+}
+
+// Server is the simulator. It is an http.Handler, so it can be served with
+// httptest.NewServer as well as from cmd/simulator.
+type Server struct {
+	mu          sync.Mutex
+	scenario    Scenario
+	services    map[string]Scenario
+	activations map[int]*activation
+	nextID      int
+	mux         *http.ServeMux
+}
+
+func New(scenario Scenario) *Server {
+	s := &Server{
+		scenario:    scenario,
+		services:    make(map[string]Scenario),
+		activations: make(map[int]*activation),
+		nextID:      100000,
+		mux:         http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/stubs/handler_api.php", s.handlerAPI)
+	s.mux.HandleFunc("/stubs/handler_api", s.handlerAPI)
+	s.mux.HandleFunc("/v1/user/buy/activation/", s.fiveSimBuy)
+	s.mux.HandleFunc("/v1/user/check/", s.fiveSimCheck)
+	s.mux.HandleFunc("/v1/user/cancel/", s.fiveSimCancel)
+	s.mux.HandleFunc("/v1/user/profile", s.fiveSimProfile)
+	s.mux.HandleFunc("/v1/user/orders", s.fiveSimOrders)
+	s.mux.HandleFunc("/v1/guest/prices", s.fiveSimPrices)
+	s.mux.HandleFunc("/pickCode-api/push/buyCandy", s.phantomBuy)
+	s.mux.HandleFunc("/pickCode-api/push/sweetWrapper", s.phantomOTP)
+	s.mux.HandleFunc("/pickCode-api/push/ticket", s.phantomTicket)
+	s.mux.HandleFunc("/ccpay.php", s.phantomBridge)
+	s.mux.HandleFunc("/control/get-number", s.smsManGetNumber)
+	s.mux.HandleFunc("/control/get-sms", s.smsManGetSMS)
+	s.mux.HandleFunc("/control/set-status", s.smsManSetStatus)
+	s.mux.HandleFunc("/control/get-balance", s.smsManBalance)
+	s.mux.HandleFunc("/control/get-prices", s.smsManPrices)
+	s.mux.HandleFunc("/simulator/scenario", s.scenarioHandler)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logs.Logger.Debugf("simulator %s %s", r.Method, r.URL.String())
+	s.mux.ServeHTTP(w, r)
+}
+
+// SetScenario replaces the scenario used for services without their own.
+func (s *Server) SetScenario(scenario Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenario = scenario
+}
+
+// SetServiceScenario scripts a single service code.
+func (s *Server) SetServiceScenario(service string, scenario Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.services[service] = scenario
+}
+
+func (s *Server) scenarioFor(service string) Scenario {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if scenario, ok := s.services[service]; ok {
+		return scenario
+	}
+	return s.scenario
+}
+
+func (s *Server) buy(service string) *activation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scenario, ok := s.services[service]
+	if !ok {
+		scenario = s.scenario
+	}
+	s.nextID++
+	a := &activation{
+		id:        s.nextID,
+		number:    fmt.Sprintf("91%d", 6000000000+rand.Int63n(3999999999)),
+		service:   service,
+		scenario:  scenario,
+		createdAt: time.Now(),
+		released:  1,
+	}
+	s.activations[a.id] = a
+	return a
+}
+
+func (s *Server) find(id string) *activation {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activations[n]
+}
+
+func (s *Server) findNumber(number string) *activation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.activations {
+		if a.number == number || a.number == "91"+number {
+			return a
+		}
+	}
+	return nil
+}
+
+// received, cancel and next lock the server since activations are shared
+// between concurrent requests.
+func (s *Server) received(a *activation) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return a.received(time.Now())
+}
+
+// cancel reports whether the activation could be cancelled.
+func (s *Server) cancel(a *activation) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a.cancelled {
+		return true
+	}
+	if len(a.received(time.Now())) > 0 {
+		return false
+	}
+	if a.scenario.EarlyCancelDenied {
+		return false
+	}
+	a.cancelled = true
+	return true
+}
+
+func (s *Server) next(a *activation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a.released < len(a.scenario.SMS) {
+		a.released++
+	}
+}
+
+// list returns every activation, newest first.
+func (s *Server) list() []*activation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activations := make([]*activation, 0, len(s.activations))
+	for _, a := range s.activations {
+		activations = append(activations, a)
+	}
+	sort.Slice(activations, func(i, j int) bool {
+		return activations[i].id > activations[j].id
+	})
+	return activations
+}
+
+func (s *Server) isCancelled(a *activation) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return a.cancelled
+}
+
+func (s *Server) scenarioHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		s.mu.Lock()
+		scenario := s.scenario
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, scenario)
+		return
+	}
+	var scenario Scenario
+	if err := json.NewDecoder(r.Body).Decode(&scenario); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+		return
+	}
+	if service := r.URL.Query().Get("service"); service != "" {
+		s.SetServiceScenario(service, scenario)
+	} else {
+		s.SetScenario(scenario)
+	}
+	writeJSON(w, http.StatusOK, scenario)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeText(w http.ResponseWriter, status int, text string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(status)
+	w.Write([]byte(text))
+}
@@ -0,0 +1,96 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func smsManError(w http.ResponseWriter, code, msg string) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":    false,
+		"error_code": code,
+		"error_msg":  msg,
+	})
+}
+
+func (s *Server) smsManGetNumber(w http.ResponseWriter, r *http.Request) {
+	service := r.URL.Query().Get("application_id")
+	scenario := s.scenarioFor(service)
+	if scenario.BadKey {
+		smsManError(w, "wrong_token", "Wrong token!")
+		return
+	}
+	if scenario.NoStock {
+		smsManError(w, "no_numbers", "No numbers available")
+		return
+	}
+	a := s.buy(service)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"request_id": a.id,
+		"number":     a.number,
+	})
+}
+
+func (s *Server) smsManGetSMS(w http.ResponseWriter, r *http.Request) {
+	if s.scenarioFor("").BadKey {
+		smsManError(w, "wrong_token", "Wrong token!")
+		return
+	}
+	a := s.find(r.URL.Query().Get("request_id"))
+	if a == nil || s.isCancelled(a) {
+		smsManError(w, "wrong_status", "Wrong status")
+		return
+	}
+	sms := s.received(a)
+	if len(sms) == 0 {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"request_id": a.id,
+			"error_code": "wait_sms",
+			"error_msg":  "Still waiting...",
+		})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"request_id": a.id,
+		"number":     a.number,
+		"sms_code":   sms[len(sms)-1],
+	})
+}
+
+func (s *Server) smsManSetStatus(w http.ResponseWriter, r *http.Request) {
+	if s.scenarioFor("").BadKey {
+		smsManError(w, "wrong_token", "Wrong token!")
+		return
+	}
+	a := s.find(r.URL.Query().Get("request_id"))
+	if a == nil {
+		smsManError(w, "wrong_request_id", "Wrong request id")
+		return
+	}
+	switch r.URL.Query().Get("status") {
+	case "reject":
+		if !s.cancel(a) {
+			smsManError(w, "cancel_denied", "Activation can not be cancelled")
+			return
+		}
+	case "retrysms":
+		s.next(a)
+	default:
+		smsManError(w, "wrong_status", "Wrong status")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"request_id": a.id,
+		"success":    true,
+	})
+}
+
+func (s *Server) smsManBalance(w http.ResponseWriter, r *http.Request) {
+	if s.scenarioFor("").BadKey {
+		smsManError(w, "wrong_token", "Wrong token!")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"balance": fmt.Sprintf("%.2f", s.scenarioFor("").Balance),
+	})
+}
@@ -1,27 +1,29 @@
 package utils
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
 )
 
 func FetchTRXPrice() (float64, error) {
 	apiURL := "https://min-api.cryptocompare.com/data/price?fsym=TRX&tsyms=INR"
-	resp, err := http.Get(apiURL)
+	body, status, err := httpclient.Get(context.Background(), apiURL, nil)
 	if err != nil {
 		return 0, fmt.Errorf("failed to fetch TRX price: %v", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("received non-200 status code: %d", resp.StatusCode)
+	if status != http.StatusOK {
+		return 0, fmt.Errorf("received non-200 status code: %d", status)
 	}
 
 	var responseData struct {
 		INR float64 `json:"INR"`
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&responseData); err != nil {
+	if err := json.Unmarshal(body, &responseData); err != nil {
 		return 0, fmt.Errorf("failed to decode response: %v", err)
 	}
 
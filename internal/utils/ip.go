@@ -4,9 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/httpclient"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 )
 
@@ -40,12 +40,11 @@ func ExtractIpDetails(c echo.Context) (string, error) {
 	logs.Logger.Info(ip)
 
 	apiURL := fmt.Sprintf("http://ip-api.com/json/%s", ip)
-	resp, err := http.Get(apiURL)
+	body, _, err := httpclient.Get(c.Request().Context(), apiURL, nil)
 	if err != nil {
 		return "", errors.New("unbale to fetch ip details")
 	}
 
-	defer resp.Body.Close()
 	var data struct {
 		Status     string `json:"status"`
 		Message    string `json:"message"`
@@ -57,7 +56,7 @@ func ExtractIpDetails(c echo.Context) (string, error) {
 		Query      string `json:"query"`
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+	if err := json.Unmarshal(body, &data); err != nil {
 		return "", fmt.Errorf("Unable to parse ip details")
 	}
 
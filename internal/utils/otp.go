@@ -43,6 +43,13 @@ func SendOTPByEmail(email, otp, text, subject string) error {
 	return nil
 }
 
+// SendEmail sends a plain text email.
+func SendEmail(to []string, subject, text string) error {
+	auth := smtp.PlainAuth("", mailUser, mailPass, smtpHost)
+	msg := []byte("Subject: " + subject + "\r\n\r\n" + text + "\r\n")
+	return smtp.SendMail(smtpHost+":"+smtpPort, auth, mailUser, to, msg)
+}
+
 // StoreOTP stores OTP for an email in OTPStore
 func StoreOTP(email, otp string) error {
 	// Check if OTP already exists for the email